@@ -0,0 +1,72 @@
+package adaptive
+
+import (
+	"sync"
+	"time"
+)
+
+// AIMD 加性增乘性减: 请求失败或者超时时按比例降低并发上限,
+// 否则在并发上限被充分使用时加 1. 只根据失败调整, 对延迟的上升不敏感.
+type AIMD struct {
+	mu    sync.Mutex
+	limit float64
+
+	minLimit int64
+	maxLimit int64
+	// 请求失败时并发上限乘以 backoffRatio
+	backoffRatio float64
+	// 耗时超过 timeout 的请求视为失败
+	timeout time.Duration
+}
+
+// NewAIMD 默认并发上限在 [1, 1000] 之间, 失败时乘以 0.9, 耗时超过 5s 视为失败.
+func NewAIMD(initialLimit int64) *AIMD {
+	return &AIMD{
+		limit:        float64(initialLimit),
+		minLimit:     1,
+		maxLimit:     1000,
+		backoffRatio: 0.9,
+		timeout:      5 * time.Second,
+	}
+}
+
+func (a *AIMD) SetLimitBounds(minLimit, maxLimit int64) *AIMD {
+	a.minLimit, a.maxLimit = minLimit, maxLimit
+	return a
+}
+
+// SetBackoffRatio 设置请求失败时降低并发上限的比例, 取值在 (0, 1) 之间.
+func (a *AIMD) SetBackoffRatio(ratio float64) *AIMD {
+	a.backoffRatio = ratio
+	return a
+}
+
+func (a *AIMD) SetTimeout(timeout time.Duration) *AIMD {
+	a.timeout = timeout
+	return a
+}
+
+func (a *AIMD) Limit() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int64(a.limit)
+}
+
+func (a *AIMD) OnSample(rtt time.Duration, inflight int64, dropped bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case dropped || rtt > a.timeout:
+		if float64(inflight) > a.limit {
+			// 请求开始时的活跃请求数超过了当前的并发上限, 失败是之前更高的并发上限导致的
+			return
+		}
+		a.limit *= a.backoffRatio
+	case float64(inflight)*2 >= a.limit:
+		// 并发上限没有被充分使用时不增加, 否则空闲的时候会无限增长
+		a.limit++
+	default:
+		return
+	}
+	a.limit = clamp(a.limit, a.minLimit, a.maxLimit)
+}
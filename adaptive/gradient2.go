@@ -0,0 +1,122 @@
+package adaptive
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Gradient2 比较短期平均耗时和长期平均耗时的比值(梯度), 耗时上升时按比例降低并发上限:
+// limit = limit * gradient + queueSize.
+// 两个平均耗时都使用指数移动平均, 短期平均耗时过滤掉个别慢请求,
+// 长期平均耗时可以适应服务本身耗时的缓慢变化, 不需要像 Vegas 一样探测.
+// 和 Netflix 的实现不同, 请求失败时也会降低并发上限.
+type Gradient2 struct {
+	mu    sync.Mutex
+	limit float64
+	// 短期和长期平均耗时, 单位为纳秒
+	shortRtt float64
+	longRtt  float64
+
+	minLimit int64
+	maxLimit int64
+	// 短期和长期平均耗时的窗口, 也就是指数移动平均的样本数
+	shortWindow int
+	longWindow  int
+	// 允许短期耗时比长期平均耗时高多少倍, 超过之后才降低并发上限
+	tolerance float64
+	// 允许排队的请求数, 也就是梯度为 1 时每次增加多少并发上限
+	queueSize float64
+	// 平滑系数, 越小并发上限变化得越慢
+	smoothing float64
+}
+
+// NewGradient2 默认并发上限在 [1, 1000] 之间.
+func NewGradient2(initialLimit int64) *Gradient2 {
+	return &Gradient2{
+		limit:       float64(initialLimit),
+		minLimit:    1,
+		maxLimit:    1000,
+		shortWindow: 10,
+		longWindow:  600,
+		tolerance:   1.5,
+		queueSize:   4,
+		smoothing:   0.2,
+	}
+}
+
+func (g *Gradient2) SetLimitBounds(minLimit, maxLimit int64) *Gradient2 {
+	g.minLimit, g.maxLimit = minLimit, maxLimit
+	return g
+}
+
+// SetTolerance 设置允许短期耗时比长期平均耗时高多少倍, 不能小于 1.
+func (g *Gradient2) SetTolerance(tolerance float64) *Gradient2 {
+	g.tolerance = tolerance
+	return g
+}
+
+func (g *Gradient2) SetQueueSize(queueSize int) *Gradient2 {
+	g.queueSize = float64(queueSize)
+	return g
+}
+
+// SetSmoothing 设置平滑系数, 取值在 (0, 1] 之间.
+func (g *Gradient2) SetSmoothing(smoothing float64) *Gradient2 {
+	g.smoothing = smoothing
+	return g
+}
+
+// SetShortWindow 设置短期平均耗时的样本数, 为 1 时只看最近一个请求的耗时.
+func (g *Gradient2) SetShortWindow(window int) *Gradient2 {
+	g.shortWindow = window
+	return g
+}
+
+// SetLongWindow 设置长期平均耗时的样本数.
+func (g *Gradient2) SetLongWindow(window int) *Gradient2 {
+	g.longWindow = window
+	return g
+}
+
+func (g *Gradient2) Limit() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return int64(g.limit)
+}
+
+func (g *Gradient2) OnSample(rtt time.Duration, inflight int64, dropped bool) {
+	if rtt <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	sample := float64(rtt)
+	if g.longRtt == 0 {
+		g.shortRtt, g.longRtt = sample, sample
+	} else {
+		g.shortRtt += (sample - g.shortRtt) / float64(g.shortWindow)
+		g.longRtt += (sample - g.longRtt) / float64(g.longWindow)
+	}
+	shortRtt := g.shortRtt
+	// 短期耗时远低于长期平均耗时, 说明服务本身变快了, 让平均值尽快降下来, 否则感知不到之后的拥塞
+	if g.longRtt/shortRtt > 2 {
+		g.longRtt *= 0.95
+	}
+	if float64(inflight) < g.limit/2 {
+		// 并发上限没有被充分使用, 耗时不能说明问题
+		return
+	}
+	gradient := math.Max(0.5, math.Min(1, g.tolerance*g.longRtt/shortRtt))
+	if dropped {
+		// 超时的请求耗时不再增长, 只看耗时感知不到拥塞, 按照最小的梯度降低
+		gradient = 0.5
+	}
+	newLimit := g.limit*gradient + g.queueSize
+	newLimit = g.limit*(1-g.smoothing) + newLimit*g.smoothing
+	if newLimit < g.limit && float64(inflight) > g.limit {
+		// 请求开始时的活跃请求数超过了当前的并发上限, 耗时是之前更高的并发上限导致的
+		return
+	}
+	g.limit = clamp(newLimit, g.minLimit, g.maxLimit)
+}
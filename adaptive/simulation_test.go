@@ -0,0 +1,193 @@
+package adaptive
+
+import (
+	"container/heap"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+// server 模拟的服务, 活跃请求数超过 capacity 之后开始拥塞,
+// 每多 capacity/10 个活跃请求耗时翻倍, 超过 timeout 之后请求失败
+type server struct {
+	capacity int64
+	baseRtt  time.Duration
+	timeout  time.Duration
+}
+
+func (s *server) rtt(inflight int64) (time.Duration, bool) {
+	if inflight <= s.capacity {
+		return s.baseRtt, false
+	}
+	exp := float64(inflight-s.capacity) / (float64(s.capacity) / 10)
+	rtt := float64(s.baseRtt) * math.Pow(2, exp)
+	if rtt > float64(s.timeout) {
+		return s.timeout, true
+	}
+	return time.Duration(rtt), false
+}
+
+// completion 模拟的请求结束事件
+type completion struct {
+	start    time.Time
+	end      time.Time
+	inflight int64
+	dropped  bool
+}
+
+type completionHeap []completion
+
+func (h completionHeap) Len() int           { return len(h) }
+func (h completionHeap) Less(i, j int) bool { return h[i].end.Before(h[j].end) }
+func (h completionHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *completionHeap) Push(x any)        { *h = append(*h, x.(completion)) }
+func (h *completionHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// simulate 请求量一直大于并发上限, 每个请求结束之后立刻发出新的请求, 直到达到并发上限.
+// 使用假的时钟推进时间, 返回 [from, to) 期间每个请求结束时的并发上限.
+func simulate(algo Algorithm, s *server, from, to time.Time) []int64 {
+	var (
+		events   completionHeap
+		inflight int64
+		limits   []int64
+	)
+	fill := func(now time.Time) {
+		for inflight < algo.Limit() {
+			inflight++
+			rtt, dropped := s.rtt(inflight)
+			heap.Push(&events, completion{start: now, end: now.Add(rtt),
+				inflight: inflight, dropped: dropped})
+		}
+	}
+	fill(from)
+	for events.Len() > 0 {
+		c := heap.Pop(&events).(completion)
+		if !c.end.Before(to) {
+			break
+		}
+		inflight--
+		algo.OnSample(c.end.Sub(c.start), c.inflight, c.dropped)
+		limits = append(limits, algo.Limit())
+		fill(c.end)
+	}
+	return limits
+}
+
+func TestAlgorithms_Simulation(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name string
+		algo Algorithm
+		// 容量为 100 和容量减半之后, 并发上限平均值的范围
+		wantRange     [2]int64
+		wantHalfRange [2]int64
+	}{
+		{
+			name: "AIMD",
+			// 耗时超过 2 倍时视为失败
+			algo:          NewAIMD(10).SetTimeout(20 * time.Millisecond),
+			wantRange:     [2]int64{100, 150},
+			wantHalfRange: [2]int64{50, 75},
+		},
+		{
+			name:          "Vegas",
+			algo:          NewVegas(10),
+			wantRange:     [2]int64{100, 150},
+			wantHalfRange: [2]int64{50, 100},
+		},
+		{
+			name: "Gradient2",
+			// 允许耗时上升到 1.5 倍, 所以会超出容量更多
+			algo:          NewGradient2(10),
+			wantRange:     [2]int64{100, 250},
+			wantHalfRange: [2]int64{50, 125},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &server{capacity: 100, baseRtt: 10 * time.Millisecond, timeout: time.Second}
+			limits := simulate(tc.algo, s, start, start.Add(10*time.Second))
+			// 只看最后 20% 的样本, 也就是收敛之后的并发上限
+			before := assertConverged(t, limits[len(limits)*4/5:], tc.wantRange)
+
+			// 服务变慢, 容量减半之后并发上限跟着降低
+			s.capacity = 50
+			limits = simulate(tc.algo, s, start.Add(10*time.Second), start.Add(20*time.Second))
+			after := assertConverged(t, limits[len(limits)*4/5:], tc.wantHalfRange)
+			assert.Less(t, after, before)
+		})
+	}
+}
+
+// assertConverged 并发上限的平均值在 [want[0], want[1]] 之间, 返回平均值
+func assertConverged(t *testing.T, limits []int64, want [2]int64) int64 {
+	t.Helper()
+	var sum int64
+	for _, l := range limits {
+		sum += l
+	}
+	avg := sum / int64(len(limits))
+	assert.GreaterOrEqual(t, avg, want[0])
+	assert.LessOrEqual(t, avg, want[1])
+	return avg
+}
+
+func TestAIMD_OnSample(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rtt      time.Duration
+		inflight int64
+		dropped  bool
+		want     int64
+	}{
+		{name: "并发上限被充分使用时加 1", rtt: time.Millisecond, inflight: 10, want: 21},
+		{name: "空闲时不变", rtt: time.Millisecond, inflight: 1, want: 20},
+		{name: "失败时按比例降低", rtt: time.Millisecond, inflight: 10, dropped: true, want: 18},
+		{name: "超时视为失败", rtt: time.Second, inflight: 10, want: 18},
+		{name: "不低于下限", rtt: time.Second, inflight: 10, dropped: true, want: 18},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAIMD(20).SetTimeout(500*time.Millisecond).SetLimitBounds(18, 100)
+			a.OnSample(tc.rtt, tc.inflight, tc.dropped)
+			if tc.dropped || tc.rtt > a.timeout {
+				// 连续失败也不会低于下限
+				a.OnSample(tc.rtt, tc.inflight, tc.dropped)
+			}
+			assert.Equal(t, tc.want, a.Limit())
+		})
+	}
+}
+
+func TestGradient2_OnSample(t *testing.T) {
+	testCases := []struct {
+		name        string
+		shortWindow int
+		// 耗时稳定之后连续出现的慢请求数
+		slow int
+		want int64
+	}{
+		{name: "一个慢请求只稍微降低并发上限", shortWindow: 10, slow: 1, want: 96},
+		{name: "只看最近一个请求时一个慢请求就大幅降低", shortWindow: 1, slow: 1, want: 90},
+		{name: "持续变慢时大幅降低", shortWindow: 10, slow: 10, want: 46},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewGradient2(100).SetShortWindow(tc.shortWindow).SetQueueSize(0)
+			for i := 0; i < 100; i++ {
+				g.OnSample(10*time.Millisecond, 50, false)
+			}
+			assert.Equal(t, int64(100), g.Limit())
+			for i := 0; i < tc.slow; i++ {
+				g.OnSample(100*time.Millisecond, 50, false)
+			}
+			assert.Equal(t, tc.want, g.Limit())
+		})
+	}
+}
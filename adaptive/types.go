@@ -0,0 +1,25 @@
+package adaptive
+
+import "time"
+
+// Algorithm 根据请求的耗时和结果调整并发上限的算法, 参考 Netflix concurrency-limits.
+// 实现需要并发安全.
+type Algorithm interface {
+	// Limit 当前的并发上限
+	Limit() int64
+	// OnSample 每个请求结束时调用.
+	// rtt 为请求的耗时, inflight 为请求开始时的活跃请求数,
+	// dropped 表示请求失败, 例如超时或者返回 5xx.
+	OnSample(rtt time.Duration, inflight int64, dropped bool)
+}
+
+// clamp 把并发上限限制在 [min, max] 之间
+func clamp(limit float64, min, max int64) float64 {
+	if limit < float64(min) {
+		return float64(min)
+	}
+	if limit > float64(max) {
+		return float64(max)
+	}
+	return limit
+}
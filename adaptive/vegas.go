@@ -0,0 +1,108 @@
+package adaptive
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Vegas 参考 TCP Vegas, 用无负载时的最小耗时估算排队的请求数:
+// queue = limit * (1 - rttNoLoad / rtt).
+// 排队的请求少时增加并发上限, 多时降低, 请求失败时也会降低.
+type Vegas struct {
+	mu    sync.Mutex
+	limit float64
+	// 观察到的最小耗时, 作为无负载时的耗时
+	rttNoLoad time.Duration
+	// 距离上一次重置 rttNoLoad 的请求数
+	samples int
+
+	minLimit int64
+	maxLimit int64
+	// 每 probeMultiplier * limit 个请求重置一次 rttNoLoad, 适应服务本身耗时的变化
+	probeMultiplier int
+	// 平滑系数, 越小并发上限变化得越慢
+	smoothing float64
+}
+
+// NewVegas 默认并发上限在 [1, 1000] 之间.
+func NewVegas(initialLimit int64) *Vegas {
+	return &Vegas{
+		limit:           float64(initialLimit),
+		minLimit:        1,
+		maxLimit:        1000,
+		probeMultiplier: 30,
+		smoothing:       1,
+	}
+}
+
+func (v *Vegas) SetLimitBounds(minLimit, maxLimit int64) *Vegas {
+	v.minLimit, v.maxLimit = minLimit, maxLimit
+	return v
+}
+
+// SetSmoothing 设置平滑系数, 取值在 (0, 1] 之间.
+func (v *Vegas) SetSmoothing(smoothing float64) *Vegas {
+	v.smoothing = smoothing
+	return v
+}
+
+// SetProbeMultiplier 每 multiplier * limit 个请求重新探测一次无负载时的耗时.
+func (v *Vegas) SetProbeMultiplier(multiplier int) *Vegas {
+	v.probeMultiplier = multiplier
+	return v
+}
+
+func (v *Vegas) Limit() int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return int64(v.limit)
+}
+
+func (v *Vegas) OnSample(rtt time.Duration, inflight int64, dropped bool) {
+	if rtt <= 0 {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.samples++
+	if v.samples > v.probeMultiplier*int(v.limit) {
+		// 重新探测无负载时的耗时
+		v.samples = 0
+		v.rttNoLoad = rtt
+		return
+	}
+	if v.rttNoLoad == 0 || rtt < v.rttNoLoad {
+		v.rttNoLoad = rtt
+		return
+	}
+
+	logLimit := math.Max(1, math.Log10(v.limit))
+	alpha, beta, threshold := 3*logLimit, 6*logLimit, logLimit
+	var newLimit float64
+	switch {
+	case dropped:
+		newLimit = v.limit - logLimit
+	case float64(inflight)*2 < v.limit:
+		// 并发上限没有被充分使用, 耗时不能说明问题
+		return
+	default:
+		queue := math.Ceil(v.limit * (1 - float64(v.rttNoLoad)/float64(rtt)))
+		switch {
+		case queue <= threshold:
+			newLimit = v.limit + beta
+		case queue < alpha:
+			newLimit = v.limit + logLimit
+		case queue > beta:
+			newLimit = v.limit - logLimit
+		default:
+			return
+		}
+	}
+	if newLimit < v.limit && float64(inflight) > v.limit {
+		// 请求开始时的活跃请求数超过了当前的并发上限, 耗时是之前更高的并发上限导致的
+		return
+	}
+	newLimit = clamp(newLimit, v.minLimit, v.maxLimit)
+	v.limit = (1-v.smoothing)*v.limit + v.smoothing*newLimit
+}
@@ -0,0 +1,37 @@
+package clientip
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/atomic"
+)
+
+// defaultResolver 默认不信任任何代理
+var defaultResolver = atomic.NewPointer(newDefaultResolver())
+
+func newDefaultResolver() *Resolver {
+	// 没有可信代理时不会出错
+	r, _ := NewResolver()
+	return r
+}
+
+// Default 返回全局的 Resolver.
+// 限流, 并发限制, 登录保护等中间件没有单独设置时按照它解析客户端 IP, jwt 的日志也使用它.
+func Default() *Resolver {
+	return defaultResolver.Load()
+}
+
+// SetDefault 设置全局的 Resolver, 部署在代理之后时在启动时设置一次, 例如
+// clientip.SetDefault(resolver.SetHeaders(clientip.HeaderXForwardedFor)).
+func SetDefault(r *Resolver) {
+	defaultResolver.Store(r)
+}
+
+// ClientIP 使用全局的 Resolver 解析客户端 IP, 参考 Resolver.ClientIP
+func ClientIP(ctx *gin.Context) string {
+	return Default().ClientIP(ctx)
+}
+
+// Key 使用全局的 Resolver 生成限流的客户端标识, 参考 Resolver.Key
+func Key(ctx *gin.Context) string {
+	return Default().Key(ctx)
+}
@@ -0,0 +1,32 @@
+package clientip
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetDefault(t *testing.T) {
+	old := Default()
+	defer SetDefault(old)
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	require.NoError(t, err)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(HeaderXForwardedFor, "2001:db8:1:2::7")
+	ctx.Request = req
+
+	// 默认不信任任何代理
+	assert.Equal(t, "10.0.0.1", ClientIP(ctx))
+	assert.Equal(t, "10.0.0.1", Key(ctx))
+
+	r, err := NewResolver("10.0.0.0/8")
+	require.NoError(t, err)
+	SetDefault(r)
+	assert.Equal(t, "2001:db8:1:2::7", ClientIP(ctx))
+	assert.Equal(t, "2001:db8:1:2::/64", Key(ctx))
+}
@@ -0,0 +1,188 @@
+package clientip
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	// HeaderForwarded RFC 7239, 例如 for=192.0.2.60;proto=http, for="[2001:db8::17]:4711"
+	HeaderForwarded = "Forwarded"
+	// HeaderXForwardedFor 例如 203.0.113.195, 70.41.3.18
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-IP"
+	// CDN 回源时设置的请求头, 只包含一个 IP
+	HeaderCFConnectingIP = "CF-Connecting-IP"
+	HeaderTrueClientIP   = "True-Client-IP"
+	HeaderFastlyClientIP = "Fastly-Client-IP"
+	HeaderAliCDNRealIP   = "Ali-CDN-Real-IP"
+)
+
+const defaultIPv6PrefixBits = 64
+
+// Resolver 解析客户端的真实 IP.
+// 只有直接连接的对端在可信代理中时才会读取请求头, 避免客户端伪造 X-Forwarded-For 绕过限流.
+// Forwarded 和 X-Forwarded-For 从右往左跳过可信代理, 第一个不可信的地址就是客户端,
+// 其他请求头只包含一个 IP, 直接使用.
+type Resolver struct {
+	trusted []netip.Prefix
+	// headers 按照顺序尝试, 默认 Forwarded, X-Forwarded-For, X-Real-IP
+	headers []string
+	// ipv6Bits 生成 Key 时 IPv6 地址聚合的前缀长度, 默认 64
+	ipv6Bits int
+}
+
+// NewResolver trusted 为可信代理的 CIDR 或者单个 IP, 例如 10.0.0.0/8, 127.0.0.1.
+// 没有可信代理时总是使用直接连接的对端地址.
+func NewResolver(trusted ...string) (*Resolver, error) {
+	prefixes := make([]netip.Prefix, 0, len(trusted))
+	for _, t := range trusted {
+		p, err := parsePrefix(t)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p)
+	}
+	return &Resolver{
+		trusted:  prefixes,
+		headers:  []string{HeaderForwarded, HeaderXForwardedFor, HeaderXRealIP},
+		ipv6Bits: defaultIPv6PrefixBits,
+	}, nil
+}
+
+// SetHeaders 设置读取客户端 IP 的请求头和顺序, 例如只使用 CDN 的 HeaderCFConnectingIP
+func (r *Resolver) SetHeaders(headers ...string) *Resolver {
+	r.headers = headers
+	return r
+}
+
+// SetIPv6PrefixBits 设置 Key 中 IPv6 地址聚合的前缀长度.
+// 一个用户一般会分配到一个 /64 网段, 按照单个地址限流很容易被绕过.
+func (r *Resolver) SetIPv6PrefixBits(bits int) *Resolver {
+	r.ipv6Bits = bits
+	return r
+}
+
+// Resolve 返回客户端的 IP, 无法解析时返回零值
+func (r *Resolver) Resolve(req *http.Request) netip.Addr {
+	remote := parseAddr(req.RemoteAddr)
+	if !remote.IsValid() || !r.isTrusted(remote) {
+		return remote
+	}
+	for _, h := range r.headers {
+		vals := req.Header.Values(h)
+		if len(vals) == 0 {
+			continue
+		}
+		var addr netip.Addr
+		switch http.CanonicalHeaderKey(h) {
+		case HeaderForwarded:
+			addr = r.rightmostUntrusted(forwardedFor(vals))
+		case HeaderXForwardedFor:
+			addr = r.rightmostUntrusted(strings.Split(strings.Join(vals, ","), ","))
+		default:
+			addr = parseAddr(vals[0])
+		}
+		if addr.IsValid() {
+			return addr
+		}
+	}
+	return remote
+}
+
+// ClientIP 可以替代 ctx.ClientIP(), 无法解析时返回 ""
+func (r *Resolver) ClientIP(ctx *gin.Context) string {
+	addr := r.Resolve(ctx.Request)
+	if !addr.IsValid() {
+		return ""
+	}
+	return addr.String()
+}
+
+// Key 用于限流的客户端标识, IPv4 为单个地址, IPv6 为所在的网段, 例如 2001:db8:1:2::/64
+func (r *Resolver) Key(ctx *gin.Context) string {
+	addr := r.Resolve(ctx.Request)
+	if !addr.IsValid() {
+		return ""
+	}
+	if addr.Is4() || r.ipv6Bits <= 0 || r.ipv6Bits >= 128 {
+		return addr.String()
+	}
+	return netip.PrefixFrom(addr, r.ipv6Bits).Masked().String()
+}
+
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	for _, p := range r.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// rightmostUntrusted 从右往左跳过可信代理.
+// 遇到无法解析的地址时返回零值, 全部可信时返回最左边的地址.
+func (r *Resolver) rightmostUntrusted(hops []string) netip.Addr {
+	var addr netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr = parseAddr(hops[i])
+		if !addr.IsValid() {
+			return netip.Addr{}
+		}
+		if !r.isTrusted(addr) {
+			return addr
+		}
+	}
+	return addr
+}
+
+// forwardedFor 提取 Forwarded 中每一跳的 for 参数, 没有 for 参数的一跳为 ""
+func forwardedFor(vals []string) []string {
+	var res []string
+	for _, elem := range strings.Split(strings.Join(vals, ","), ",") {
+		var node string
+		for _, pair := range strings.Split(elem, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(k, "for") {
+				node = strings.Trim(v, `"`)
+			}
+		}
+		res = append(res, node)
+	}
+	return res
+}
+
+// parseAddr 解析 IP, 允许带有端口和 IPv6 的方括号, 例如 1.2.3.4:80, [2001:db8::1]:80.
+// IPv4-mapped IPv6 地址会转换成 IPv4.
+func parseAddr(s string) netip.Addr {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("可信代理 %s 格式错误: %w", s, err)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("可信代理 %s 格式错误: %w", s, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
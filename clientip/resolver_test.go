@@ -0,0 +1,138 @@
+package clientip
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolver_ClientIP(t *testing.T) {
+	testCases := []struct {
+		name    string
+		trusted []string
+		headers []string
+		remote  string
+		reqHdr  map[string][]string
+		wantIP  string
+		wantKey string
+	}{
+		{
+			name:    "没有可信代理, 忽略请求头",
+			remote:  "203.0.113.7:1234",
+			reqHdr:  map[string][]string{HeaderXForwardedFor: {"1.1.1.1"}},
+			wantIP:  "203.0.113.7",
+			wantKey: "203.0.113.7",
+		},
+		{
+			name:    "对端不可信, 忽略请求头",
+			trusted: []string{"10.0.0.0/8"},
+			remote:  "203.0.113.7:1234",
+			reqHdr:  map[string][]string{HeaderXRealIP: {"1.1.1.1"}},
+			wantIP:  "203.0.113.7",
+			wantKey: "203.0.113.7",
+		},
+		{
+			name:    "X-Forwarded-For 跳过可信代理",
+			trusted: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:1234",
+			reqHdr:  map[string][]string{HeaderXForwardedFor: {"1.1.1.1, 203.0.113.7", "10.0.0.2"}},
+			wantIP:  "203.0.113.7",
+			wantKey: "203.0.113.7",
+		},
+		{
+			name:    "X-Forwarded-For 全部可信",
+			trusted: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:1234",
+			reqHdr:  map[string][]string{HeaderXForwardedFor: {"10.0.0.3, 10.0.0.2"}},
+			wantIP:  "10.0.0.3",
+			wantKey: "10.0.0.3",
+		},
+		{
+			name:    "Forwarded 优先",
+			trusted: []string{"10.0.0.1"},
+			remote:  "10.0.0.1:1234",
+			reqHdr: map[string][]string{
+				HeaderForwarded:     {`for=192.0.2.60;proto=http, for="[2001:db8:cafe:1:2::17]:4711";by=10.0.0.1`},
+				HeaderXForwardedFor: {"1.1.1.1"},
+			},
+			wantIP:  "2001:db8:cafe:1:2::17",
+			wantKey: "2001:db8:cafe:1::/64",
+		},
+		{
+			name:    "Forwarded 无法解析, 使用下一个请求头",
+			trusted: []string{"10.0.0.1"},
+			remote:  "10.0.0.1:1234",
+			reqHdr: map[string][]string{
+				HeaderForwarded: {"for=unknown"},
+				HeaderXRealIP:   {"203.0.113.7"},
+			},
+			wantIP:  "203.0.113.7",
+			wantKey: "203.0.113.7",
+		},
+		{
+			name:    "CDN 请求头",
+			trusted: []string{"10.0.0.0/8"},
+			headers: []string{HeaderCFConnectingIP},
+			remote:  "10.0.0.1:1234",
+			reqHdr: map[string][]string{
+				HeaderCFConnectingIP: {"2001:db8::1"},
+				HeaderXForwardedFor:  {"1.1.1.1"},
+			},
+			wantIP:  "2001:db8::1",
+			wantKey: "2001:db8::/64",
+		},
+		{
+			name:    "请求头都没有, 使用对端地址",
+			trusted: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:1234",
+			wantIP:  "10.0.0.1",
+			wantKey: "10.0.0.1",
+		},
+		{
+			name:    "IPv4-mapped IPv6",
+			remote:  "[::ffff:203.0.113.7]:1234",
+			wantIP:  "203.0.113.7",
+			wantKey: "203.0.113.7",
+		},
+		{
+			name:   "对端地址无法解析",
+			remote: "pipe",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewResolver(tc.trusted...)
+			require.NoError(t, err)
+			if tc.headers != nil {
+				r.SetHeaders(tc.headers...)
+			}
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.RemoteAddr = tc.remote
+			for k, vals := range tc.reqHdr {
+				for _, v := range vals {
+					req.Header.Add(k, v)
+				}
+			}
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = req
+
+			assert.Equal(t, tc.wantIP, r.ClientIP(ctx))
+			assert.Equal(t, tc.wantKey, r.Key(ctx))
+		})
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	_, err := NewResolver("10.0.0.0/8", "127.0.0.1", "::1")
+	assert.NoError(t, err)
+	_, err = NewResolver("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = NewResolver("localhost")
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package degrade
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen 熔断器打开, 没有访问后端
+var ErrBreakerOpen = errors.New("熔断器已打开")
+
+// State 熔断器状态
+type State int
+
+const (
+	// StateClosed 正常访问后端
+	StateClosed State = iota
+	// StateOpen 后端不健康, 不再访问后端
+	StateOpen
+	// StateHalfOpen 放行一个探测请求, 成功后恢复正常
+	StateHalfOpen
+)
+
+// Breaker 熔断器, 后端不健康时停止访问后端, 定期放行一个请求探测后端是否恢复.
+type Breaker struct {
+	// 连续失败多少次之后打开熔断器
+	threshold int
+	// 打开多久之后开始探测
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	// 半开状态下是否已经有探测请求
+	probing bool
+	nowFunc func() time.Time
+}
+
+// NewBreaker 连续失败 threshold 次之后打开熔断器, openTimeout 之后开始探测.
+func NewBreaker(threshold int, openTimeout time.Duration) *Breaker {
+	return &Breaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		nowFunc:     time.Now,
+	}
+}
+
+// Allow 是否可以访问后端, 返回 true 之后必须调用 Success 或者 Failure.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if b.nowFunc().Sub(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return true
+	case StateHalfOpen:
+		// 同一时间只放行一个探测请求
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Success 访问后端成功
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = StateClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure 访问后端失败
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = b.nowFunc()
+		b.probing = false
+	}
+}
+
+// State 当前状态
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
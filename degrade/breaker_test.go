@@ -0,0 +1,76 @@
+package degrade
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name string
+		// 按顺序执行的操作: a 为 Allow, s 为 Success, f 为 Failure
+		ops []string
+		// 每个操作相对 start 的时间
+		offsets   []time.Duration
+		wantAllow []bool
+		wantState State
+	}{
+		{
+			name:      "连续失败次数没有达到阈值",
+			ops:       []string{"a", "f", "a", "s", "a", "f", "a"},
+			offsets:   make([]time.Duration, 7),
+			wantAllow: []bool{true, true, true, true},
+			wantState: StateClosed,
+		},
+		{
+			name:      "连续失败打开熔断器",
+			ops:       []string{"a", "f", "a", "f", "a"},
+			offsets:   make([]time.Duration, 5),
+			wantAllow: []bool{true, true, false},
+			wantState: StateOpen,
+		},
+		{
+			name:      "超时之后只放行一个探测请求",
+			ops:       []string{"a", "f", "a", "f", "a", "a"},
+			offsets:   []time.Duration{0, 0, 0, 0, time.Second, time.Second},
+			wantAllow: []bool{true, true, true, false},
+			wantState: StateHalfOpen,
+		},
+		{
+			name:      "探测成功之后恢复",
+			ops:       []string{"a", "f", "a", "f", "a", "s", "a"},
+			offsets:   []time.Duration{0, 0, 0, 0, time.Second, time.Second, time.Second},
+			wantAllow: []bool{true, true, true, true},
+			wantState: StateClosed,
+		},
+		{
+			name:      "探测失败之后重新打开",
+			ops:       []string{"a", "f", "a", "f", "a", "f", "a"},
+			offsets:   []time.Duration{0, 0, 0, 0, time.Second, time.Second, 1500 * time.Millisecond},
+			wantAllow: []bool{true, true, true, false},
+			wantState: StateOpen,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewBreaker(2, time.Second)
+			var allows []bool
+			for i, op := range tc.ops {
+				now := start.Add(tc.offsets[i])
+				b.nowFunc = func() time.Time { return now }
+				switch op {
+				case "a":
+					allows = append(allows, b.Allow())
+				case "s":
+					b.Success()
+				case "f":
+					b.Failure()
+				}
+			}
+			assert.Equal(t, tc.wantAllow, allows)
+			assert.Equal(t, tc.wantState, b.State())
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package degrade
+
+// Policy 限流器依赖的 Redis 等后端出错时的处理策略
+type Policy int
+
+const (
+	// FailClosed 拒绝请求, 中间件返回 500
+	FailClosed Policy = iota
+	// FailOpen 直接放行, 相当于不限流
+	FailOpen
+	// Fallback 降级到本地限流, 一般是按照实例数缩小配额
+	Fallback
+)
+
+func (p Policy) String() string {
+	switch p {
+	case FailClosed:
+		return "fail-closed"
+	case FailOpen:
+		return "fail-open"
+	case Fallback:
+		return "fallback"
+	default:
+		return "unknown"
+	}
+}
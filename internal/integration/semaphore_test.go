@@ -0,0 +1,172 @@
+package integration
+
+import (
+	"context"
+	"ginx/middlewares/redislimit"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBuilder_e2e_RedisSemaphoreLimit(t *testing.T) {
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: "localhost:16379",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	require.NoError(t, redisClient.Ping(ctx).Err())
+	defer func() {
+		_ = redisClient.Close()
+	}()
+
+	const key = "semaphore-e2e"
+	testCases := []struct {
+		name   string
+		before func(t *testing.T)
+		// 等待多久之后发起请求
+		interval  time.Duration
+		wantCode  int
+		wantCount int64
+	}{
+		{
+			name:      "正常获取和释放租约",
+			before:    func(t *testing.T) {},
+			wantCode:  http.StatusOK,
+			wantCount: 0,
+		},
+		{
+			name: "崩溃的实例没有释放租约, 引发限流",
+			before: func(t *testing.T) {
+				// 模拟崩溃的实例留下的租约
+				expire := time.Now().Add(200 * time.Millisecond).UnixMilli()
+				require.NoError(t, redisClient.ZAdd(context.Background(), key,
+					redis.Z{Score: float64(expire), Member: "crashed"}).Err())
+			},
+			wantCode:  http.StatusTooManyRequests,
+			wantCount: 1,
+		},
+		{
+			name: "崩溃的实例的租约过期之后自动恢复",
+			before: func(t *testing.T) {
+				expire := time.Now().Add(100 * time.Millisecond).UnixMilli()
+				require.NoError(t, redisClient.ZAdd(context.Background(), key,
+					redis.Z{Score: float64(expire), Member: "crashed"}).Err())
+			},
+			interval:  200 * time.Millisecond,
+			wantCode:  http.StatusOK,
+			wantCount: 0,
+		},
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			redisClient.Del(context.Background(), key)
+			tc.before(t)
+			server := gin.New()
+			server.Use(redislimit.NewRedisSemaphoreLimit(redisClient, 1, key, time.Second).Build())
+			server.GET("/semaphore", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			time.Sleep(tc.interval)
+			req, err := http.NewRequest(http.MethodGet, "/semaphore", nil)
+			require.NoError(t, err)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+
+			// 过期的租约在下一次获取租约时才会清理
+			cnt, err := redisClient.ZCount(context.Background(), key,
+				strconv.FormatInt(time.Now().UnixMilli(), 10), "+inf").Result()
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantCount, cnt)
+		})
+	}
+}
+
+func TestBuilder_e2e_RedisKeyActiveLimit(t *testing.T) {
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: "localhost:16379",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	require.NoError(t, redisClient.Ping(ctx).Err())
+	defer func() {
+		_ = redisClient.Close()
+	}()
+
+	const key = "export-e2e:user-1"
+	testCases := []struct {
+		name   string
+		before func(t *testing.T)
+		// 每隔 20ms 重试多少次, 都会触发限流
+		retries int
+		// 等待多久之后发起请求
+		interval time.Duration
+		wantCode int
+	}{
+		{
+			name:     "正常获取和释放租约",
+			before:   func(t *testing.T) {},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "崩溃的实例没有释放租约, 引发限流",
+			before: func(t *testing.T) {
+				require.NoError(t, redisClient.ZAdd(context.Background(), key, redis.Z{
+					Score:  float64(time.Now().Add(200 * time.Millisecond).UnixMilli()),
+					Member: "crashed",
+				}).Err())
+			},
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name: "崩溃的实例的租约过期之后自动恢复",
+			before: func(t *testing.T) {
+				require.NoError(t, redisClient.ZAdd(context.Background(), key, redis.Z{
+					Score:  float64(time.Now().Add(100 * time.Millisecond).UnixMilli()),
+					Member: "crashed",
+				}).Err())
+			},
+			// 过期之前不断重试, 触发限流的请求不会延长租约
+			retries:  4,
+			interval: 50 * time.Millisecond,
+			wantCode: http.StatusOK,
+		},
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			redisClient.Del(context.Background(), key)
+			tc.before(t)
+			server := gin.New()
+			server.Use(redislimit.NewRedisKeyActiveLimit(redisClient, 1, "export-e2e", time.Second).
+				SetKeyGenFunc(func(ctx *gin.Context) string {
+					return "user-1"
+				}).Build())
+			server.GET("/export", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			send := func() int {
+				req, err := http.NewRequest(http.MethodGet, "/export", nil)
+				require.NoError(t, err)
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				return resp.Code
+			}
+			for i := 0; i < tc.retries; i++ {
+				assert.Equal(t, http.StatusTooManyRequests, send())
+				time.Sleep(20 * time.Millisecond)
+			}
+			time.Sleep(tc.interval)
+			assert.Equal(t, tc.wantCode, send())
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	errInvalidResult      = errors.New("限流脚本返回的结果格式错误")
+	errWeightNotSupported = errors.New("限流器不支持一次占用多个配额")
+)
+
+// AsDecisionLimiter 将 Limiter 转换为 DecisionLimiter.
+// 只返回 bool 的 Limiter 会被适配成 Limit 为 0 的 Decision.
+func AsDecisionLimiter(l Limiter) DecisionLimiter {
+	if dl, ok := l.(DecisionLimiter); ok {
+		return dl
+	}
+	return &boolLimiter{Limiter: l}
+}
+
+// AsWeightedLimiter 将 Limiter 转换为 WeightedLimiter.
+// 不支持权重的 Limiter 只能占用 1 个配额, 否则返回错误.
+func AsWeightedLimiter(l Limiter) WeightedLimiter {
+	if wl, ok := l.(WeightedLimiter); ok {
+		return wl
+	}
+	return &unweightedLimiter{DecisionLimiter: AsDecisionLimiter(l)}
+}
+
+// boolLimiter 适配只返回 bool 的 Limiter
+type boolLimiter struct {
+	Limiter
+}
+
+func (b *boolLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	limited, err := b.Limit(ctx, key)
+	if err != nil {
+		return Decision{}, err
+	}
+	return Decision{Allowed: !limited}, nil
+}
+
+// unweightedLimiter 适配不支持权重的 DecisionLimiter
+type unweightedLimiter struct {
+	DecisionLimiter
+}
+
+func (u *unweightedLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	if n != 1 {
+		return Decision{}, errWeightNotSupported
+	}
+	return u.Decide(ctx, key)
+}
+
+// limitByDecision 使用 Decision 实现 Limiter 接口
+func limitByDecision(d Decision, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	return !d.Allowed, nil
+}
+
+// parseDecision 解析 lua 脚本返回的
+// {是否放行, 阈值, 剩余配额, 恢复时间(毫秒), 重试时间(毫秒)}
+func parseDecision(vals []int64, err error) (Decision, error) {
+	if err != nil {
+		return Decision{}, err
+	}
+	if len(vals) != 5 {
+		return Decision{}, errInvalidResult
+	}
+	return Decision{
+		Allowed:    vals[0] == 1,
+		Limit:      vals[1],
+		Remaining:  vals[2],
+		ResetAfter: time.Duration(vals[3]) * time.Millisecond,
+		RetryAfter: time.Duration(vals[4]) * time.Millisecond,
+	}, nil
+}
+
+// Seconds 向上取整到秒, 用于 Retry-After 和 RateLimit-Reset 响应头
+func Seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
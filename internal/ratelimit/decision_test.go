@@ -0,0 +1,243 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type boolLimiterFunc func(ctx context.Context, key string) (bool, error)
+
+func (f boolLimiterFunc) Limit(ctx context.Context, key string) (bool, error) {
+	return f(ctx, key)
+}
+
+func TestAsDecisionLimiter(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limiter Limiter
+		want    Decision
+		wantErr error
+	}{
+		{
+			name: "适配不限流",
+			limiter: boolLimiterFunc(func(ctx context.Context, key string) (bool, error) {
+				return false, nil
+			}),
+			want: Decision{Allowed: true},
+		},
+		{
+			name: "适配限流",
+			limiter: boolLimiterFunc(func(ctx context.Context, key string) (bool, error) {
+				return true, nil
+			}),
+			want: Decision{Allowed: false},
+		},
+		{
+			name: "适配出错",
+			limiter: boolLimiterFunc(func(ctx context.Context, key string) (bool, error) {
+				return false, errors.New("模拟系统错误")
+			}),
+			wantErr: errors.New("模拟系统错误"),
+		},
+		{
+			name:    "本身就是 DecisionLimiter",
+			limiter: NewLocalFixedWindowLimiter(time.Minute, 2),
+			want:    Decision{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: time.Minute},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := AsDecisionLimiter(tc.limiter)
+			if fw, ok := l.(*LocalFixedWindowLimiter); ok {
+				now := time.UnixMilli(1695571200000)
+				fw.nowFunc = func() time.Time { return now }
+			}
+			d, err := l.Decide(context.Background(), "xxx")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, d)
+		})
+	}
+}
+
+func TestParseDecision(t *testing.T) {
+	testCases := []struct {
+		name    string
+		vals    []int64
+		err     error
+		want    Decision
+		wantErr error
+	}{
+		{
+			name: "放行",
+			vals: []int64{1, 10, 9, 1000, 0},
+			want: Decision{Allowed: true, Limit: 10, Remaining: 9, ResetAfter: time.Second},
+		},
+		{
+			name: "限流",
+			vals: []int64{0, 10, 0, 1000, 200},
+			want: Decision{Limit: 10, ResetAfter: time.Second, RetryAfter: 200 * time.Millisecond},
+		},
+		{
+			name:    "格式错误",
+			vals:    []int64{1},
+			wantErr: errInvalidResult,
+		},
+		{
+			name:    "执行出错",
+			err:     errors.New("模拟系统错误"),
+			wantErr: errors.New("模拟系统错误"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := parseDecision(tc.vals, tc.err)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, d)
+		})
+	}
+}
+
+func TestAsWeightedLimiter(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limiter Limiter
+		n       int64
+		want    Decision
+		wantErr error
+	}{
+		{
+			name: "不支持权重的限流器占用 1 个配额",
+			limiter: boolLimiterFunc(func(ctx context.Context, key string) (bool, error) {
+				return false, nil
+			}),
+			n:    1,
+			want: Decision{Allowed: true},
+		},
+		{
+			name: "不支持权重的限流器占用多个配额",
+			limiter: boolLimiterFunc(func(ctx context.Context, key string) (bool, error) {
+				return false, nil
+			}),
+			n:       2,
+			wantErr: errWeightNotSupported,
+		},
+		{
+			name:    "本身就是 WeightedLimiter",
+			limiter: NewLocalFixedWindowLimiter(time.Minute, 5),
+			n:       3,
+			want:    Decision{Allowed: true, Limit: 5, Remaining: 2, ResetAfter: time.Minute},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := AsWeightedLimiter(tc.limiter)
+			if fw, ok := l.(*LocalFixedWindowLimiter); ok {
+				now := time.UnixMilli(1695571200000)
+				fw.nowFunc = func() time.Time { return now }
+			}
+			d, err := l.DecideN(context.Background(), "xxx", tc.n)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, d)
+		})
+	}
+}
+
+// TestLocalLimiters_DecideN 所有本地限流器按权重占用配额
+func TestLocalLimiters_DecideN(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name    string
+		limiter func() WeightedLimiter
+		// 按顺序占用的配额
+		costs []int64
+		want  []bool
+	}{
+		{
+			name: "滑动窗口",
+			limiter: func() WeightedLimiter {
+				l := NewLocalSlidingWindowLimiter(time.Minute, 10)
+				l.nowFunc = func() time.Time { return now }
+				return l
+			},
+			costs: []int64{4, 4, 4, 2, 11},
+			want:  []bool{true, true, false, true, false},
+		},
+		{
+			name: "令牌桶",
+			limiter: func() WeightedLimiter {
+				l := NewLocalTokenBucketLimiter(time.Minute, 10, 10)
+				l.nowFunc = func() time.Time { return now }
+				return l
+			},
+			// 超过桶容量时返回错误, 参考 TestTokenBucketLimiter_CostExceedsCapacity
+			costs: []int64{4, 4, 4, 2},
+			want:  []bool{true, true, false, true},
+		},
+		{
+			name: "固定窗口",
+			limiter: func() WeightedLimiter {
+				l := NewLocalFixedWindowLimiter(time.Minute, 10)
+				l.nowFunc = func() time.Time { return now }
+				return l
+			},
+			costs: []int64{4, 4, 4, 2, 11},
+			want:  []bool{true, true, false, true, false},
+		},
+		{
+			name: "滑动窗口计数",
+			limiter: func() WeightedLimiter {
+				l := NewLocalSlidingWindowCounterLimiter(time.Minute, 10)
+				l.nowFunc = func() time.Time { return now }
+				return l
+			},
+			costs: []int64{4, 4, 4, 2, 11},
+			want:  []bool{true, true, false, true, false},
+		},
+		{
+			name: "多规则",
+			limiter: func() WeightedLimiter {
+				l := NewLocalMultiRuleLimiter([]Rule{
+					{Interval: time.Second, Rate: 20},
+					{Interval: time.Minute, Rate: 10},
+				})
+				l.nowFunc = func() time.Time { return now }
+				return l
+			},
+			costs: []int64{4, 4, 4, 2, 11},
+			want:  []bool{true, true, false, true, false},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := tc.limiter()
+			got := make([]bool, 0, len(tc.costs))
+			for _, cost := range tc.costs {
+				d, err := l.DecideN(context.Background(), "xxx", cost)
+				assert.NoError(t, err)
+				got = append(got, d.Allowed)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	testCases := []struct {
+		name string
+		d    time.Duration
+		want string
+	}{
+		{name: "0", d: 0, want: "0"},
+		{name: "整秒", d: 2 * time.Second, want: "2"},
+		{name: "不足一秒向上取整", d: 1500 * time.Millisecond, want: "2"},
+		{name: "1ms", d: time.Millisecond, want: "1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Seconds(tc.d))
+		})
+	}
+}
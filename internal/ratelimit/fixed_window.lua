@@ -0,0 +1,25 @@
+-- 限流对象
+local key = KEYS[1]
+-- 窗口大小
+local window = tonumber(ARGV[1])
+-- 阈值
+local threshold = tonumber(ARGV[2])
+-- 本次请求占用的配额
+local cost = tonumber(ARGV[3] or 1)
+
+local cnt = tonumber(redis.call('GET', key) or 0)
+if cnt + cost > threshold then
+    -- 执行限流, 窗口结束之后就可以重试
+    local ttl = redis.call('PTTL', key)
+    if ttl < 0 then
+        ttl = window
+    end
+    return { 0, threshold, 0, ttl, ttl }
+end
+
+cnt = redis.call('INCRBY', key, cost)
+if cnt == cost then
+    -- 第一个请求开启一个新的窗口
+    redis.call('PEXPIRE', key, window)
+end
+return { 1, threshold, threshold - cnt, redis.call('PTTL', key), 0 }
@@ -0,0 +1,33 @@
+-- 限流对象
+local key = KEYS[1]
+-- 窗口大小
+local window = tonumber(ARGV[1])
+-- 阈值
+local threshold = tonumber(ARGV[2])
+-- 允许的突发流量
+local burst = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+-- 本次请求占用的配额
+local cost = tonumber(ARGV[5] or 1)
+
+-- 两个请求之间的理想间隔
+local emission = window / threshold
+-- 理论到达时间(theoretical arrival time), 每个 key 只保存这一个值
+local tat = tonumber(redis.call('GET', key))
+if tat == nil or tat < now then
+    tat = now
+end
+
+local newTat = tat + emission * cost
+-- 最早允许请求到达的时间
+local allowAt = newTat - burst * emission
+if now < allowAt then
+    -- 执行限流
+    return { 0, threshold, 0, math.ceil(tat - now), math.ceil(allowAt - now) }
+end
+
+redis.call('SET', key, newTat, 'PX', math.ceil(newTat - now))
+-- 对外报告每个窗口的阈值, 剩余配额为接下来一个窗口内还能按照速率放行的请求数
+local remaining = math.floor((now + window - newTat) * threshold / window)
+remaining = math.max(0, math.min(remaining, threshold))
+return { 1, threshold, remaining, math.ceil(newTat - now), 0 }
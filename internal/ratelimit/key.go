@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"strconv"
+	"strings"
+)
+
+// subKey 同一个限流对象的多个 key, 例如滑动窗口计数的两个窗口和多规则限流的每条规则,
+// 必须在 Redis Cluster 的同一个 slot 里面, Lua 脚本才能同时访问.
+// key 没有 hash tag 时把整个 key 作为 hash tag, 例如 {ip-limiter:127.0.0.1}:1m0s.
+func subKey(key, suffix string) string {
+	if hasHashTag(key) {
+		return key + ":" + suffix
+	}
+	return "{" + key + "}:" + suffix
+}
+
+// windowKey 第 index 个窗口的计数 key
+func windowKey(key string, index int64) string {
+	return subKey(key, strconv.FormatInt(index, 10))
+}
+
+// hasHashTag 和 Redis Cluster 的规则一致:
+// 第一个 { 之后有 }, 并且中间不为空时, 只用中间的部分计算 slot.
+func hasHashTag(key string) bool {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return false
+	}
+	return strings.IndexByte(key[start+1:], '}') > 0
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubKey(t *testing.T) {
+	testCases := []struct {
+		name   string
+		key    string
+		suffix string
+		want   string
+	}{
+		{
+			name:   "没有 hash tag",
+			key:    "ip-limiter:127.0.0.1",
+			suffix: "1",
+			want:   "{ip-limiter:127.0.0.1}:1",
+		},
+		{
+			name:   "已经有 hash tag",
+			key:    "ginx:{ip:127.0.0.1}",
+			suffix: "1",
+			want:   "ginx:{ip:127.0.0.1}:1",
+		},
+		{
+			name:   "空的 hash tag 不生效",
+			key:    "ginx:{}:127.0.0.1",
+			suffix: "1",
+			want:   "{ginx:{}:127.0.0.1}:1",
+		},
+		{
+			name:   "没有闭合的 hash tag 不生效",
+			key:    "ginx:{127.0.0.1",
+			suffix: "1",
+			want:   "{ginx:{127.0.0.1}:1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, subKey(tc.key, tc.suffix))
+		})
+	}
+}
+
+// TestSubKey_Slot 同一个限流对象的多个 key 必须在同一个 slot
+func TestSubKey_Slot(t *testing.T) {
+	rules := []Rule{
+		{Interval: time.Second, Rate: 10},
+		{Interval: time.Minute, Rate: 100},
+		{Name: "day", Interval: 24 * time.Hour, Rate: 1000},
+	}
+	for _, key := range []string{"ip-limiter:127.0.0.1", "ginx:ratelimit:v1:{user:1}",
+		"ginx:{}:127.0.0.1", "ginx:{127.0.0.1"} {
+		want := slot(windowKey(key, 0))
+		for i := int64(1); i < 100; i++ {
+			assert.Equal(t, want, slot(windowKey(key, i)), key)
+		}
+		for _, r := range rules {
+			assert.Equal(t, want, slot(subKey(key, r.name())), key)
+		}
+	}
+	// 不同的限流对象分散到不同的 slot
+	assert.NotEqual(t, slot(windowKey("ip-limiter:127.0.0.1", 0)),
+		slot(windowKey("ip-limiter:127.0.0.2", 0)))
+}
+
+// slot 参考 https://redis.io/docs/reference/cluster-spec/#key-distribution-model
+func slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % 16384)
+}
+
+// crc16 CRC16-CCITT (XMODEM)
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func TestCrc16(t *testing.T) {
+	// Redis Cluster 规范中给出的测试值
+	assert.Equal(t, uint16(0x31C3), crc16("123456789"))
+	assert.Equal(t, 12182, slot("foo"))
+	assert.Equal(t, slot("bar"), slot("{bar}:xxx"))
+}
@@ -0,0 +1,190 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/ecodeclub/ekit/bean/option"
+	"sync"
+	"time"
+)
+
+// QuotaLeaser 按照固定窗口分配全局配额, 实例批量租借之后在本地放行请求.
+type QuotaLeaser interface {
+	// Lease 从 key 在 now 所在窗口的全局配额中租借最多 n 个配额
+	Lease(ctx context.Context, key string, now time.Time, n int64) (Lease, error)
+	// Return 归还 lease 中没有用完的 n 个配额, 窗口已经结束时不会影响新的窗口
+	Return(ctx context.Context, lease Lease, n int64) error
+}
+
+// Lease 一次租借的结果
+type Lease struct {
+	// 窗口的全局计数 key, 每个窗口都不一样
+	Key string
+	// 租到的配额, 全局配额不足时少于申请的数量
+	Granted int64
+	// 每个窗口的全局配额
+	Limit int64
+	// 窗口结束的时间, 之后没有用完的配额作废
+	ExpireAt time.Time
+}
+
+// LeaseLimiter 两级限流器, 每次从 QuotaLeaser 租借 batch 个配额, 用完之前不会访问 Redis.
+//
+// 误差:
+//   - 已经租出去的配额在全局计数里面, 所以每个窗口全局最多放行 Limit 个请求;
+//     和固定窗口一样, 跨越窗口边界的任意 Interval 时间段内最多放行 2 倍的 Limit.
+//   - 各实例租到但是没有用完的配额不能被其他实例使用,
+//     所以全局配额耗尽时, 最多有 实例数 * (batch - 1) 个配额没有被使用.
+//     batch 越大, 访问 Redis 的次数越少, 误差越大.
+//     key 被 LRU 淘汰时会异步归还没有用完的配额, 归还失败的配额作废.
+//   - 实例之间的时钟偏差会让窗口边界错开, 但不会增加每个窗口放行的数量.
+type LeaseLimiter struct {
+	leaser QuotaLeaser
+	// 每次租借的配额
+	batch int64
+
+	states  *localStore[*leaseState]
+	nowFunc func() time.Time
+}
+
+type leaseState struct {
+	// 租借配额需要访问 Redis, 所以不能持有 localStore 的锁
+	mu    sync.Mutex
+	lease Lease
+	// 本地剩余的配额
+	tokens int64
+	// 当前窗口的全局配额已经耗尽, 窗口结束之前不再租借
+	exhausted bool
+	// 已经被 localStore 淘汰并归还了配额, 需要重新获取这个 key 的状态.
+	// 保证同一个 key 只有一个状态在租借配额.
+	evicted bool
+}
+
+// returnTimeout 淘汰 key 时归还配额的超时时间
+const returnTimeout = time.Second
+
+// NewLeaseLimiter interval 是 leaser 的窗口大小, 闲置超过 interval 的 key 会被淘汰.
+func NewLeaseLimiter(leaser QuotaLeaser, interval time.Duration, batch int64,
+	opts ...option.Option[LocalOptions]) *LeaseLimiter {
+	if batch <= 0 {
+		batch = 1
+	}
+	l := &LeaseLimiter{
+		leaser:  leaser,
+		batch:   batch,
+		states:  newLocalStore[*leaseState](interval, opts...),
+		nowFunc: time.Now,
+	}
+	l.states.onEvict = l.evict
+	return l
+}
+
+func (l *LeaseLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(l.Decide(ctx, key))
+}
+
+func (l *LeaseLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return l.DecideN(ctx, key, 1)
+}
+
+// DecideN Decision.Remaining 是本实例剩余的配额.
+func (l *LeaseLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	now := l.nowFunc()
+	st := l.lockState(key, now)
+	defer st.mu.Unlock()
+	if !now.Before(st.lease.ExpireAt) {
+		// 窗口结束, 剩余的配额作废
+		st.lease, st.tokens, st.exhausted = Lease{}, 0, false
+	}
+	if st.tokens < n && !st.exhausted {
+		want := n - st.tokens
+		if want < l.batch {
+			want = l.batch
+		}
+		lease, err := l.leaser.Lease(ctx, key, now, want)
+		if err != nil {
+			return Decision{}, err
+		}
+		st.tokens += lease.Granted
+		st.exhausted = lease.Granted < want
+		lease.Granted = 0
+		st.lease = lease
+	}
+
+	d := Decision{
+		Limit:      st.lease.Limit,
+		ResetAfter: st.lease.ExpireAt.Sub(now),
+	}
+	if st.tokens < n {
+		d.Remaining = st.tokens
+		d.RetryAfter = d.ResetAfter
+		return d, nil
+	}
+	st.tokens -= n
+	d.Allowed = true
+	d.Remaining = st.tokens
+	return d, nil
+}
+
+// lockState 返回加锁之后的 key 的状态, 状态已经被淘汰时重新获取
+func (l *LeaseLimiter) lockState(key string, now time.Time) *leaseState {
+	for {
+		var st *leaseState
+		l.states.do(key, now, func(val **leaseState) {
+			if *val == nil {
+				*val = &leaseState{}
+			}
+			st = *val
+		})
+		st.mu.Lock()
+		if !st.evicted {
+			return st
+		}
+		st.mu.Unlock()
+	}
+}
+
+// evict 被淘汰的 key 不再使用, 异步归还没有用完的配额, 避免阻塞当前请求
+func (l *LeaseLimiter) evict(key string, st *leaseState) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	st.evicted = true
+	lease, tokens := st.lease, st.tokens
+	st.tokens = 0
+	st.mu.Unlock()
+	if tokens <= 0 || !l.nowFunc().Before(lease.ExpireAt) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), returnTimeout)
+		defer cancel()
+		_ = l.leaser.Return(ctx, lease, tokens)
+	}()
+}
+
+// Close 把所有没有用完的配额还给 QuotaLeaser, 一般在实例退出的时候调用.
+func (l *LeaseLimiter) Close(ctx context.Context) error {
+	var states []*leaseState
+	l.states.each(func(val **leaseState) {
+		if *val != nil {
+			states = append(states, *val)
+		}
+	})
+	now := l.nowFunc()
+	for _, st := range states {
+		st.mu.Lock()
+		var err error
+		if st.tokens > 0 && now.Before(st.lease.ExpireAt) {
+			err = l.leaser.Return(ctx, st.lease, st.tokens)
+			if err == nil {
+				st.tokens = 0
+			}
+		}
+		st.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
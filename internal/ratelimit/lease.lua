@@ -0,0 +1,19 @@
+-- 当前窗口的全局计数
+local key = KEYS[1]
+-- 窗口大小
+local window = tonumber(ARGV[1])
+-- 阈值
+local threshold = tonumber(ARGV[2])
+-- 申请的配额
+local n = tonumber(ARGV[3])
+
+local used = tonumber(redis.call('GET', key) or 0)
+local granted = math.min(n, threshold - used)
+if granted <= 0 then
+    return 0
+end
+if redis.call('INCRBY', key, granted) == granted then
+    -- 第一次租借, 窗口结束之后就没用了
+    redis.call('PEXPIRE', key, window)
+end
+return granted
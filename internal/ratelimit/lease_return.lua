@@ -0,0 +1,13 @@
+-- 租借时所在窗口的全局计数
+local key = KEYS[1]
+-- 归还的配额
+local n = tonumber(ARGV[1])
+
+-- key 已经过期的时候不能重新创建, 否则不会过期
+local used = tonumber(redis.call('GET', key) or 0)
+if used <= 0 then
+    return 0
+end
+n = math.min(n, used)
+redis.call('DECRBY', key, n)
+return n
@@ -0,0 +1,265 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryQuotaLeaser 模拟 RedisQuotaLeaser, 记录租借的次数
+type memoryQuotaLeaser struct {
+	mu       sync.Mutex
+	interval time.Duration
+	rate     int64
+	used     map[string]int64
+	leases   int
+	err      error
+}
+
+func newMemoryQuotaLeaser(interval time.Duration, rate int64) *memoryQuotaLeaser {
+	return &memoryQuotaLeaser{
+		interval: interval,
+		rate:     rate,
+		used:     make(map[string]int64),
+	}
+}
+
+func (m *memoryQuotaLeaser) Lease(ctx context.Context, key string, now time.Time, n int64) (Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return Lease{}, m.err
+	}
+	m.leases++
+	window := m.interval.Milliseconds()
+	current := now.UnixMilli() / window
+	lease := Lease{
+		Key:      windowKey(key, current),
+		Limit:    m.rate,
+		ExpireAt: time.UnixMilli((current + 1) * window),
+	}
+	lease.Granted = min(n, m.rate-m.used[lease.Key])
+	m.used[lease.Key] += lease.Granted
+	return lease, nil
+}
+
+func (m *memoryQuotaLeaser) Return(ctx context.Context, lease Lease, n int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.used[lease.Key] -= min(n, m.used[lease.Key])
+	return nil
+}
+
+func TestLeaseLimiter_DecideN(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	type request struct {
+		// 相对 start 的请求时间
+		offset time.Duration
+		n      int64
+	}
+	testCases := []struct {
+		name       string
+		reqs       []request
+		want       []bool
+		wantLeases int
+	}{
+		{
+			name: "一次租借放行多个请求",
+			reqs: []request{{0, 1}, {10 * time.Millisecond, 1},
+				{20 * time.Millisecond, 1}, {30 * time.Millisecond, 1}},
+			want:       []bool{true, true, true, true},
+			wantLeases: 1,
+		},
+		{
+			name: "本地配额用完之后再次租借",
+			reqs: []request{{0, 3}, {10 * time.Millisecond, 3},
+				{20 * time.Millisecond, 3}},
+			want:       []bool{true, true, true},
+			wantLeases: 3,
+		},
+		{
+			name: "全局配额耗尽之后不再租借",
+			reqs: []request{{0, 4}, {0, 4}, {0, 4},
+				{10 * time.Millisecond, 1}, {20 * time.Millisecond, 1}, {30 * time.Millisecond, 1}},
+			// 第三次只租到 2 个, 留给后面的请求
+			want:       []bool{true, true, false, true, true, false},
+			wantLeases: 3,
+		},
+		{
+			name: "新窗口重新租借",
+			reqs: []request{{0, 4}, {0, 4}, {0, 2},
+				{10 * time.Millisecond, 1}, {time.Second, 4}},
+			want:       []bool{true, true, true, false, true},
+			wantLeases: 4,
+		},
+		{
+			name:       "超过 batch 的请求",
+			reqs:       []request{{0, 6}, {0, 4}},
+			want:       []bool{true, true},
+			wantLeases: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 每秒全局 10 个配额, 每次租借 4 个
+			leaser := newMemoryQuotaLeaser(time.Second, 10)
+			l := NewLeaseLimiter(leaser, time.Second, 4)
+			got := make([]bool, 0, len(tc.reqs))
+			for _, r := range tc.reqs {
+				now := start.Add(r.offset)
+				l.nowFunc = func() time.Time { return now }
+				d, err := l.DecideN(context.Background(), "xxx", r.n)
+				require.NoError(t, err)
+				got = append(got, d.Allowed)
+			}
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantLeases, leaser.leases)
+		})
+	}
+}
+
+func TestLeaseLimiter_Decide(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	leaser := newMemoryQuotaLeaser(time.Second, 2)
+	l := NewLeaseLimiter(leaser, time.Second, 4)
+	offsets := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	want := []Decision{
+		{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: 900 * time.Millisecond},
+		{Allowed: true, Limit: 2, Remaining: 0, ResetAfter: 800 * time.Millisecond},
+		{Allowed: false, Limit: 2, Remaining: 0, ResetAfter: 700 * time.Millisecond, RetryAfter: 700 * time.Millisecond},
+	}
+	for i, offset := range offsets {
+		now := start.Add(offset)
+		l.nowFunc = func() time.Time { return now }
+		d, err := l.Decide(context.Background(), "xxx")
+		require.NoError(t, err)
+		assert.Equal(t, want[i], d)
+	}
+
+	leaser.err = errors.New("模拟 Redis 错误")
+	now := start.Add(time.Second)
+	l.nowFunc = func() time.Time { return now }
+	_, err := l.Decide(context.Background(), "xxx")
+	assert.Equal(t, leaser.err, err)
+}
+
+// TestLeaseLimiter_Bound 多个实例共享全局配额时, 放行的数量在文档说明的误差范围内
+func TestLeaseLimiter_Bound(t *testing.T) {
+	const (
+		instances = 4
+		rate      = 100
+		batch     = 8
+		windows   = 5
+	)
+	start := time.UnixMilli(1695571200000)
+	leaser := newMemoryQuotaLeaser(time.Second, rate)
+	limiters := make([]*LeaseLimiter, instances)
+	for i := range limiters {
+		limiters[i] = NewLeaseLimiter(leaser, time.Second, batch)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for w := 0; w < windows; w++ {
+		var allowed int64
+		// 请求量是配额的 3 倍, 随机落到各个实例上
+		for i := 0; i < 3*rate; i++ {
+			now := start.Add(time.Duration(w)*time.Second +
+				time.Duration(i)*time.Second/(3*rate))
+			l := limiters[rnd.Intn(instances)]
+			l.nowFunc = func() time.Time { return now }
+			d, err := l.Decide(context.Background(), "xxx")
+			require.NoError(t, err)
+			if d.Allowed {
+				allowed++
+			}
+		}
+		assert.LessOrEqual(t, allowed, int64(rate))
+		assert.GreaterOrEqual(t, allowed, int64(rate-instances*(batch-1)))
+	}
+	// 每个窗口只需要租借 rate/batch 次左右, 而不是每个请求都访问 Redis
+	assert.LessOrEqual(t, leaser.leases, windows*(rate/batch+2*instances))
+}
+
+func TestLeaseLimiter_Close(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	leaser := newMemoryQuotaLeaser(time.Second, 10)
+	l1 := NewLeaseLimiter(leaser, time.Second, 10)
+	l2 := NewLeaseLimiter(leaser, time.Second, 10)
+	l1.nowFunc = func() time.Time { return now }
+	l2.nowFunc = func() time.Time { return now }
+
+	d, err := l1.Decide(context.Background(), "xxx")
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	// l1 租走了全部配额
+	d, err = l2.Decide(context.Background(), "xxx")
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+
+	require.NoError(t, l1.Close(context.Background()))
+	l3 := NewLeaseLimiter(leaser, time.Second, 10)
+	l3.nowFunc = func() time.Time { return now }
+	d, err = l3.DecideN(context.Background(), "xxx", 9)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+}
+
+func TestLeaseLimiter_Evict(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	leaser := newMemoryQuotaLeaser(time.Second, 10)
+	l := NewLeaseLimiter(leaser, time.Second, 10, WithShards(1), WithMaxKeys(1))
+	l.nowFunc = func() time.Time { return now }
+
+	d, err := l.Decide(context.Background(), "xxx")
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, int64(9), d.Remaining)
+
+	// 只能保存 1 个 key, xxx 被淘汰之后归还没有用完的 9 个配额
+	_, err = l.Decide(context.Background(), "yyy")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		leaser.mu.Lock()
+		defer leaser.mu.Unlock()
+		return leaser.used[windowKey("xxx", now.UnixMilli()/1000)] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// 重新创建的状态可以再次租到归还的配额
+	d, err = l.DecideN(context.Background(), "xxx", 9)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+}
+
+func TestLeaseLimiter_EvictConcurrent(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	leaser := newMemoryQuotaLeaser(time.Second, 1000)
+	l := NewLeaseLimiter(leaser, time.Second, 10, WithShards(1), WithMaxKeys(1))
+	l.nowFunc = func() time.Time { return now }
+
+	// 两个 key 不断互相淘汰, 归还之后通过的请求数仍然不超过全局配额
+	var (
+		wg      sync.WaitGroup
+		allowed = make([]int64, 2)
+	)
+	for i, key := range []string{"xxx", "yyy"} {
+		i, key := i, key
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				d, err := l.Decide(context.Background(), key)
+				require.NoError(t, err)
+				if d.Allowed {
+					allowed[i]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, allowed[0], int64(1000))
+	assert.LessOrEqual(t, allowed[1], int64(1000))
+}
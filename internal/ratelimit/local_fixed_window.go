@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/ecodeclub/ekit/bean/option"
+	"go.uber.org/atomic"
+	"time"
+)
+
+// LocalFixedWindowLimiter 基于内存的固定窗口限流器, 适用于单实例部署.
+type LocalFixedWindowLimiter struct {
+	// 窗口大小
+	interval time.Duration
+	// 阈值, 可以通过 SetRate 修改
+	rate *atomic.Int64
+
+	windows *localStore[fixedWindow]
+	nowFunc func() time.Time
+}
+
+type fixedWindow struct {
+	// 窗口的起始时间
+	start time.Time
+	cnt   int
+}
+
+func NewLocalFixedWindowLimiter(interval time.Duration, rate int,
+	opts ...option.Option[LocalOptions]) *LocalFixedWindowLimiter {
+	return &LocalFixedWindowLimiter{
+		interval: interval,
+		rate:     atomic.NewInt64(int64(rate)),
+		windows:  newLocalStore[fixedWindow](interval, opts...),
+		nowFunc:  time.Now,
+	}
+}
+
+// SetRate 修改阈值, 当前窗口内的计数继续生效
+func (l *LocalFixedWindowLimiter) SetRate(rate int) {
+	l.rate.Store(int64(rate))
+}
+
+func (l *LocalFixedWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(l.Decide(ctx, key))
+}
+
+func (l *LocalFixedWindowLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return l.DecideN(ctx, key, 1)
+}
+
+func (l *LocalFixedWindowLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	now := l.nowFunc()
+	rate := l.rate.Load()
+	d := Decision{Limit: rate}
+	l.windows.do(key, now, func(w *fixedWindow) {
+		if !now.Before(w.start.Add(l.interval)) {
+			// 第一个请求开启一个新的窗口
+			w.start, w.cnt = now, 0
+		}
+		d.ResetAfter = w.start.Add(l.interval).Sub(now)
+		if int64(w.cnt)+n > rate {
+			// 执行限流, 窗口结束之后就可以重试
+			d.RetryAfter = d.ResetAfter
+			return
+		}
+		w.cnt += int(n)
+		d.Allowed = true
+		d.Remaining = rate - int64(w.cnt)
+	})
+	return d, nil
+}
+
+func (l *LocalFixedWindowLimiter) Reset(ctx context.Context, key string) error {
+	l.windows.delete(key)
+	return nil
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLocalFixedWindowLimiter_Limit(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name string
+		// 相对 start 的请求时间
+		offsets []time.Duration
+		want    []bool
+	}{
+		{
+			name:    "窗口内正常通过",
+			offsets: []time.Duration{0, 100 * time.Millisecond},
+			want:    []bool{false, false},
+		},
+		{
+			name:    "超过阈值触发限流",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 499 * time.Millisecond},
+			want:    []bool{false, false, true},
+		},
+		{
+			name: "新窗口正常通过",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond,
+				500 * time.Millisecond, 600 * time.Millisecond, 700 * time.Millisecond},
+			want: []bool{false, false, true, false, false, true},
+		},
+		{
+			name:    "窗口从第一个请求开始",
+			offsets: []time.Duration{300 * time.Millisecond, 400 * time.Millisecond, 700 * time.Millisecond, 800 * time.Millisecond},
+			want:    []bool{false, false, true, false},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 500ms 内最多 2 个请求
+			l := NewLocalFixedWindowLimiter(500*time.Millisecond, 2)
+			got := make([]bool, 0, len(tc.offsets))
+			for _, offset := range tc.offsets {
+				now := start.Add(offset)
+				l.nowFunc = func() time.Time { return now }
+				limited, err := l.Limit(context.Background(), "xxx")
+				assert.NoError(t, err)
+				got = append(got, limited)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLocalFixedWindowLimiter_Decide(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	// 500ms 内最多 1 个请求
+	l := NewLocalFixedWindowLimiter(500*time.Millisecond, 1)
+	offsets := []time.Duration{0, 200 * time.Millisecond}
+	want := []Decision{
+		{Allowed: true, Limit: 1, Remaining: 0, ResetAfter: 500 * time.Millisecond},
+		{Allowed: false, Limit: 1, Remaining: 0, ResetAfter: 300 * time.Millisecond, RetryAfter: 300 * time.Millisecond},
+	}
+	for i, offset := range offsets {
+		now := start.Add(offset)
+		l.nowFunc = func() time.Time { return now }
+		d, err := l.Decide(context.Background(), "xxx")
+		assert.NoError(t, err)
+		assert.Equal(t, want[i], d)
+	}
+}
+
+func TestLocalFixedWindowLimiter_SetRate(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name string
+		rate int
+		want []bool
+	}{
+		{
+			name: "调高阈值保留计数",
+			rate: 3,
+			want: []bool{false, true},
+		},
+		{
+			name: "调低阈值立即限流",
+			rate: 1,
+			want: []bool{true, true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLocalFixedWindowLimiter(500*time.Millisecond, 2)
+			l.nowFunc = func() time.Time { return start }
+			for i := 0; i < 2; i++ {
+				limited, err := l.Limit(context.Background(), "xxx")
+				assert.NoError(t, err)
+				assert.False(t, limited)
+			}
+			l.SetRate(tc.rate)
+			got := make([]bool, 0, len(tc.want))
+			for range tc.want {
+				limited, err := l.Limit(context.Background(), "xxx")
+				assert.NoError(t, err)
+				got = append(got, limited)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/ecodeclub/ekit/bean/option"
+	"time"
+)
+
+// LocalMultiRuleLimiter 基于内存的多规则滑动窗口限流器, 适用于单实例部署.
+// 和 RedisMultiRuleLimiter 一样, 任何一条规则触发限流都不会占用其它规则的配额.
+type LocalMultiRuleLimiter struct {
+	rules []Rule
+
+	// 每个 key 保存每条规则窗口内的请求时间
+	logs    *localStore[[][]time.Time]
+	nowFunc func() time.Time
+}
+
+func NewLocalMultiRuleLimiter(rules []Rule, opts ...option.Option[LocalOptions]) *LocalMultiRuleLimiter {
+	var ttl time.Duration
+	for _, rule := range rules {
+		if rule.Interval > ttl {
+			ttl = rule.Interval
+		}
+	}
+	return &LocalMultiRuleLimiter{
+		rules:   rules,
+		logs:    newLocalStore[[][]time.Time](ttl, opts...),
+		nowFunc: time.Now,
+	}
+}
+
+func (l *LocalMultiRuleLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(l.Decide(ctx, key))
+}
+
+func (l *LocalMultiRuleLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return l.DecideN(ctx, key, 1)
+}
+
+func (l *LocalMultiRuleLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	if len(l.rules) == 0 {
+		return Decision{Allowed: true}, nil
+	}
+	now := l.nowFunc()
+	var d Decision
+	l.logs.do(key, now, func(logs *[][]time.Time) {
+		if len(*logs) != len(l.rules) {
+			*logs = make([][]time.Time, len(l.rules))
+		}
+		// 第一轮只检查
+		tripped, tightest := -1, -1
+		for i, rule := range l.rules {
+			min := now.Add(-rule.Interval)
+			log := (*logs)[i]
+			j := 0
+			for j < len(log) && !log[j].After(min) {
+				j++
+			}
+			log = log[j:]
+			(*logs)[i] = log
+			if int64(len(log))+n > int64(rule.Rate) {
+				retry, reset := rule.Interval, rule.Interval
+				if need := int64(len(log)) + n - int64(rule.Rate); need <= int64(len(log)) {
+					retry = log[need-1].Sub(min)
+				}
+				if len(log) > 0 {
+					reset = log[len(log)-1].Sub(min)
+				}
+				// 多条规则触发限流时, 以需要等待最久的为准
+				if tripped < 0 || retry > d.RetryAfter {
+					tripped = i
+					d.RetryAfter, d.ResetAfter = retry, reset
+				}
+				continue
+			}
+			remaining := int64(rule.Rate-len(log)) - n
+			if tightest < 0 || remaining < d.Remaining {
+				tightest = i
+				d.Remaining = remaining
+			}
+		}
+		if tripped >= 0 {
+			d.Limit, d.Remaining = int64(l.rules[tripped].Rate), 0
+			d.Rule = l.rules[tripped].name()
+			return
+		}
+		// 第二轮所有规则都占用配额
+		for i := range l.rules {
+			for j := int64(0); j < n; j++ {
+				(*logs)[i] = append((*logs)[i], now)
+			}
+		}
+		d.Allowed = true
+		d.Limit = int64(l.rules[tightest].Rate)
+		d.ResetAfter = l.rules[tightest].Interval
+		d.Rule = l.rules[tightest].name()
+	})
+	return d, nil
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLocalMultiRuleLimiter_Decide(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	rules := []Rule{
+		{Name: "second", Interval: time.Second, Rate: 2},
+		{Interval: time.Minute, Rate: 3},
+	}
+	testCases := []struct {
+		name string
+		// 相对 start 的请求时间
+		offsets []time.Duration
+		want    Decision
+	}{
+		{
+			name:    "正常通过",
+			offsets: []time.Duration{0},
+			want:    Decision{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: time.Second, Rule: "second"},
+		},
+		{
+			name:    "放行时返回剩余配额最少的规则",
+			offsets: []time.Duration{0, 2 * time.Second, 4 * time.Second},
+			want:    Decision{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: time.Minute, Rule: "3/1m0s"},
+		},
+		{
+			name:    "触发短窗口的规则",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond},
+			want:    Decision{Allowed: false, Limit: 2, ResetAfter: 900 * time.Millisecond, RetryAfter: 800 * time.Millisecond, Rule: "second"},
+		},
+		{
+			name:    "触发长窗口的规则",
+			offsets: []time.Duration{0, 2 * time.Second, 4 * time.Second, 6 * time.Second},
+			want:    Decision{Allowed: false, Limit: 3, ResetAfter: 58 * time.Second, RetryAfter: 54 * time.Second, Rule: "3/1m0s"},
+		},
+		{
+			// 被短窗口限流的请求没有占用长窗口的配额
+			name: "触发限流不占用其它规则的配额",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond,
+				2 * time.Second},
+			want: Decision{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: time.Minute, Rule: "3/1m0s"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLocalMultiRuleLimiter(rules)
+			var d Decision
+			for _, offset := range tc.offsets {
+				now := start.Add(offset)
+				l.nowFunc = func() time.Time { return now }
+				var err error
+				d, err = l.Decide(context.Background(), "xxx")
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.want, d)
+		})
+	}
+}
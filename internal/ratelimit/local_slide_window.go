@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/ecodeclub/ekit/bean/option"
+	"go.uber.org/atomic"
+	"time"
+)
+
+// LocalSlidingWindowLimiter 基于内存的滑动窗口限流器, 适用于单实例部署.
+// 和 RedisSlidingWindowLimiter 一样记录窗口内每个请求的时间, 结果是精确的.
+type LocalSlidingWindowLimiter struct {
+	// 窗口大小
+	interval time.Duration
+	// 阈值, 可以通过 SetRate 修改
+	rate *atomic.Int64
+
+	logs    *localStore[[]time.Time]
+	nowFunc func() time.Time
+}
+
+func NewLocalSlidingWindowLimiter(interval time.Duration, rate int,
+	opts ...option.Option[LocalOptions]) *LocalSlidingWindowLimiter {
+	return &LocalSlidingWindowLimiter{
+		interval: interval,
+		rate:     atomic.NewInt64(int64(rate)),
+		logs:     newLocalStore[[]time.Time](interval, opts...),
+		nowFunc:  time.Now,
+	}
+}
+
+// SetRate 修改阈值, 窗口内已经记录的请求继续生效
+func (l *LocalSlidingWindowLimiter) SetRate(rate int) {
+	l.rate.Store(int64(rate))
+}
+
+func (l *LocalSlidingWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(l.Decide(ctx, key))
+}
+
+func (l *LocalSlidingWindowLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return l.DecideN(ctx, key, 1)
+}
+
+func (l *LocalSlidingWindowLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	now := l.nowFunc()
+	rate := l.rate.Load()
+	// 窗口的起始时间
+	min := now.Add(-l.interval)
+	d := Decision{Limit: rate}
+	l.logs.do(key, now, func(log *[]time.Time) {
+		// 请求时间是有序的, 删掉窗口之外的请求
+		i := 0
+		for i < len(*log) && !(*log)[i].After(min) {
+			i++
+		}
+		*log = (*log)[i:]
+		if int64(len(*log))+n > rate {
+			// 执行限流, 足够多的请求滑出窗口之后就可以重试
+			d.RetryAfter, d.ResetAfter = l.interval, l.interval
+			if need := int64(len(*log)) + n - rate; need <= int64(len(*log)) {
+				d.RetryAfter = (*log)[need-1].Sub(min)
+			}
+			if len(*log) > 0 {
+				d.ResetAfter = (*log)[len(*log)-1].Sub(min)
+			}
+			return
+		}
+		for i := int64(0); i < n; i++ {
+			*log = append(*log, now)
+		}
+		d.Allowed = true
+		d.Remaining = rate - int64(len(*log))
+		d.ResetAfter = l.interval
+	})
+	return d, nil
+}
+
+func (l *LocalSlidingWindowLimiter) Reset(ctx context.Context, key string) error {
+	l.logs.delete(key)
+	return nil
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLocalSlidingWindowLimiter_Limit(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name string
+		// 相对 start 的请求时间
+		offsets []time.Duration
+		want    []bool
+	}{
+		{
+			name:    "窗口内正常通过",
+			offsets: []time.Duration{0, 100 * time.Millisecond},
+			want:    []bool{false, false},
+		},
+		{
+			name:    "超过阈值触发限流",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 300 * time.Millisecond},
+			want:    []bool{false, false, true},
+		},
+		{
+			name:    "窗口滑过第一个请求后正常通过",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 300 * time.Millisecond, 500 * time.Millisecond, 550 * time.Millisecond},
+			want:    []bool{false, false, true, false, true},
+		},
+		{
+			name:    "被限流的请求不占用配额",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 300 * time.Millisecond, 600 * time.Millisecond, 610 * time.Millisecond},
+			want:    []bool{false, false, true, false, false},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 500ms 内最多 2 个请求
+			l := NewLocalSlidingWindowLimiter(500*time.Millisecond, 2)
+			got := make([]bool, 0, len(tc.offsets))
+			for _, offset := range tc.offsets {
+				now := start.Add(offset)
+				l.nowFunc = func() time.Time { return now }
+				limited, err := l.Limit(context.Background(), "xxx")
+				assert.NoError(t, err)
+				got = append(got, limited)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLocalSlidingWindowLimiter_Decide(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	// 500ms 内最多 2 个请求
+	l := NewLocalSlidingWindowLimiter(500*time.Millisecond, 2)
+	offsets := []time.Duration{0, 100 * time.Millisecond, 300 * time.Millisecond}
+	want := []Decision{
+		{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: 500 * time.Millisecond},
+		{Allowed: true, Limit: 2, Remaining: 0, ResetAfter: 500 * time.Millisecond},
+		// 第一个请求在 500ms 时滑出窗口, 第二个在 600ms 时滑出
+		{Allowed: false, Limit: 2, Remaining: 0, ResetAfter: 300 * time.Millisecond, RetryAfter: 200 * time.Millisecond},
+	}
+	for i, offset := range offsets {
+		now := start.Add(offset)
+		l.nowFunc = func() time.Time { return now }
+		d, err := l.Decide(context.Background(), "xxx")
+		assert.NoError(t, err)
+		assert.Equal(t, want[i], d)
+	}
+}
+
+func TestLocalSlidingWindowLimiter_DecideN(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	// 500ms 内最多 3 个配额
+	l := NewLocalSlidingWindowLimiter(500*time.Millisecond, 3)
+	offsets := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	costs := []int64{1, 1, 1, 2}
+	want := []Decision{
+		{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: 500 * time.Millisecond},
+		{Allowed: true, Limit: 3, Remaining: 1, ResetAfter: 500 * time.Millisecond},
+		{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: 500 * time.Millisecond},
+		// 需要前两个请求都滑出窗口, 第二个请求在 600ms 时滑出
+		{Allowed: false, Limit: 3, Remaining: 0, ResetAfter: 400 * time.Millisecond, RetryAfter: 300 * time.Millisecond},
+	}
+	for i, offset := range offsets {
+		now := start.Add(offset)
+		l.nowFunc = func() time.Time { return now }
+		d, err := l.DecideN(context.Background(), "xxx", costs[i])
+		assert.NoError(t, err)
+		assert.Equal(t, want[i], d)
+	}
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/ecodeclub/ekit/bean/option"
+	"go.uber.org/atomic"
+	"math"
+	"time"
+)
+
+// LocalSlidingWindowCounterLimiter 基于内存的滑动窗口计数限流器, 适用于单实例部署.
+type LocalSlidingWindowCounterLimiter struct {
+	// 窗口大小
+	interval time.Duration
+	// 阈值, 可以通过 SetRate 修改
+	rate *atomic.Int64
+
+	counters *localStore[windowCounter]
+	nowFunc  func() time.Time
+}
+
+type windowCounter struct {
+	// 当前窗口的序号
+	index    int64
+	current  int
+	previous int
+}
+
+func NewLocalSlidingWindowCounterLimiter(interval time.Duration, rate int,
+	opts ...option.Option[LocalOptions]) *LocalSlidingWindowCounterLimiter {
+	return &LocalSlidingWindowCounterLimiter{
+		interval: interval,
+		rate:     atomic.NewInt64(int64(rate)),
+		// 下一个窗口还要用到当前窗口的计数
+		counters: newLocalStore[windowCounter](2*interval, opts...),
+		nowFunc:  time.Now,
+	}
+}
+
+// SetRate 修改阈值, 当前窗口和上一个窗口的计数继续生效
+func (l *LocalSlidingWindowCounterLimiter) SetRate(rate int) {
+	l.rate.Store(int64(rate))
+}
+
+func (l *LocalSlidingWindowCounterLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(l.Decide(ctx, key))
+}
+
+func (l *LocalSlidingWindowCounterLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return l.DecideN(ctx, key, 1)
+}
+
+func (l *LocalSlidingWindowCounterLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	t := l.nowFunc()
+	now := t.UnixNano()
+	window := l.interval.Nanoseconds()
+	index := now / window
+	rate := l.rate.Load()
+	d := Decision{Limit: rate}
+	l.counters.do(key, t, func(c *windowCounter) {
+		switch index - c.index {
+		case 0:
+		case 1:
+			// 进入下一个窗口
+			c.previous, c.current = c.current, 0
+		default:
+			// 新的 key 或者已经很久没有请求了
+			c.previous, c.current = 0, 0
+		}
+		c.index = index
+
+		// 按照上一个窗口还在滑动窗口内的比例估算请求数
+		elapsed := now - index*window
+		estimated := float64(c.previous)*float64(window-elapsed)/float64(window) + float64(c.current)
+		d.ResetAfter = time.Duration(2*window - elapsed)
+		if estimated+float64(n) > float64(rate) {
+			// 执行限流
+			d.RetryAfter = time.Duration(window - elapsed)
+			if c.previous > 0 && int64(c.current)+n <= rate {
+				// 上一个窗口的请求滑出足够多之后就可以重试
+				at := float64(window) * (1 - float64(rate-int64(c.current)-n)/float64(c.previous))
+				d.RetryAfter = time.Duration(math.Ceil(at)) - time.Duration(elapsed)
+			}
+			return
+		}
+		c.current += int(n)
+		d.Allowed = true
+		d.Remaining = int64(float64(rate) - estimated - float64(n))
+	})
+	return d, nil
+}
+
+func (l *LocalSlidingWindowCounterLimiter) Reset(ctx context.Context, key string) error {
+	l.counters.delete(key)
+	return nil
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLocalSlidingWindowCounterLimiter_Limit(t *testing.T) {
+	// 窗口的起始时间
+	start := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name string
+		// 相对 start 的请求时间
+		offsets []time.Duration
+		want    []bool
+	}{
+		{
+			name:    "窗口内正常通过",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond},
+			want:    []bool{false, false, false, false},
+		},
+		{
+			name:    "超过阈值触发限流",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 400 * time.Millisecond},
+			want:    []bool{false, false, false, false, true},
+		},
+		{
+			// 上一个窗口 4 个请求, 过去 1/4 之后估算值为 4*3/4=3
+			name: "按比例计算上一个窗口的请求",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond,
+				1250 * time.Millisecond, 1260 * time.Millisecond},
+			want: []bool{false, false, false, false, false, true},
+		},
+		{
+			name: "上一个窗口的请求全部滑出",
+			offsets: []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond,
+				2000 * time.Millisecond, 2100 * time.Millisecond, 2200 * time.Millisecond, 2300 * time.Millisecond},
+			want: []bool{false, false, false, false, false, false, false, false},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 1s 内最多 4 个请求
+			l := NewLocalSlidingWindowCounterLimiter(time.Second, 4)
+			got := make([]bool, 0, len(tc.offsets))
+			for _, offset := range tc.offsets {
+				now := start.Add(offset)
+				l.nowFunc = func() time.Time { return now }
+				limited, err := l.Limit(context.Background(), "xxx")
+				assert.NoError(t, err)
+				got = append(got, limited)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLocalSlidingWindowCounterLimiter_Decide(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	// 1s 内最多 2 个请求
+	l := NewLocalSlidingWindowCounterLimiter(time.Second, 2)
+	offsets := []time.Duration{0, 500 * time.Millisecond, 1000 * time.Millisecond, 1200 * time.Millisecond}
+	want := []Decision{
+		{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: 2 * time.Second},
+		{Allowed: true, Limit: 2, Remaining: 0, ResetAfter: 1500 * time.Millisecond},
+		// 上一个窗口的 2 个请求全部在滑动窗口内
+		{Allowed: false, Limit: 2, Remaining: 0, ResetAfter: 2 * time.Second, RetryAfter: 500 * time.Millisecond},
+		// 估算值为 2*0.8=1.6, 滑出到 1 以下之后就可以重试
+		{Allowed: false, Limit: 2, Remaining: 0, ResetAfter: 1800 * time.Millisecond, RetryAfter: 300 * time.Millisecond},
+	}
+	for i, offset := range offsets {
+		now := start.Add(offset)
+		l.nowFunc = func() time.Time { return now }
+		d, err := l.Decide(context.Background(), "xxx")
+		assert.NoError(t, err)
+		assert.Equal(t, want[i], d)
+	}
+}
@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"container/list"
+	"github.com/ecodeclub/ekit/bean/option"
+	"go.uber.org/atomic"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// LocalOptions 本地限流器保存限流状态的配置
+type LocalOptions struct {
+	// 分段锁的数量, 不同段的 key 互不阻塞
+	Shards int
+	// 最多保存多少个 key, 超出之后淘汰最久没有访问的 key
+	MaxKeys int
+}
+
+func defaultLocalOptions() LocalOptions {
+	return LocalOptions{
+		Shards:  32,
+		MaxKeys: 65536,
+	}
+}
+
+// WithShards 设置分段锁的数量.
+func WithShards(shards int) option.Option[LocalOptions] {
+	return func(o *LocalOptions) {
+		o.Shards = shards
+	}
+}
+
+// WithMaxKeys 设置最多保存多少个 key.
+// 被淘汰的 key 会重新开始计算, 所以不要设置得太小.
+func WithMaxKeys(maxKeys int) option.Option[LocalOptions] {
+	return func(o *LocalOptions) {
+		o.MaxKeys = maxKeys
+	}
+}
+
+// localStore 按 key 分段加锁的限流状态存储.
+// 每一段都是一个 LRU, 超过容量或者闲置超过 ttl 的 key 会被淘汰.
+type localStore[T any] struct {
+	shards []*storeShard[T]
+	// 闲置超过 ttl 的 key 的状态和新建的没有区别, 可以直接淘汰
+	ttl *atomic.Duration
+	// onEvict 不为 nil 时, 释放锁之后依次处理被淘汰的 key
+	onEvict func(key string, val T)
+}
+
+type storeShard[T any] struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	// 越靠前越是最近访问的
+	lru *list.List
+}
+
+type storeEntry[T any] struct {
+	key        string
+	val        T
+	lastAccess time.Time
+}
+
+func newLocalStore[T any](ttl time.Duration, opts ...option.Option[LocalOptions]) *localStore[T] {
+	o := defaultLocalOptions()
+	option.Apply[LocalOptions](&o, opts...)
+	if o.Shards <= 0 {
+		o.Shards = 1
+	}
+	capacity := o.MaxKeys / o.Shards
+	if capacity <= 0 {
+		capacity = 1
+	}
+	shards := make([]*storeShard[T], o.Shards)
+	for i := range shards {
+		shards[i] = &storeShard[T]{
+			capacity: capacity,
+			items:    make(map[string]*list.Element),
+			lru:      list.New(),
+		}
+	}
+	return &localStore[T]{shards: shards, ttl: atomic.NewDuration(ttl)}
+}
+
+// do 在 key 所在段的锁内执行 fn.
+// key 不存在或者已经过期时 val 为零值, fn 可以直接修改 val.
+func (s *localStore[T]) do(key string, now time.Time, fn func(val *T)) {
+	evicted := s.doLocked(key, now, fn)
+	if s.onEvict == nil {
+		return
+	}
+	for _, entry := range evicted {
+		s.onEvict(entry.key, entry.val)
+	}
+}
+
+// doLocked 返回被淘汰的 key
+func (s *localStore[T]) doLocked(key string, now time.Time, fn func(val *T)) []*storeEntry[T] {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	ttl := s.ttl.Load()
+	var evicted []*storeEntry[T]
+	elem, ok := shard.items[key]
+	if ok && now.Sub(elem.Value.(*storeEntry[T]).lastAccess) > ttl {
+		evicted = append(evicted, shard.remove(elem))
+		ok = false
+	}
+	if !ok {
+		elem = shard.lru.PushFront(&storeEntry[T]{key: key})
+		shard.items[key] = elem
+	} else {
+		shard.lru.MoveToFront(elem)
+	}
+	entry := elem.Value.(*storeEntry[T])
+	entry.lastAccess = now
+	fn(&entry.val)
+	return shard.evict(now, ttl, evicted)
+}
+
+// setTTL 修改闲置多久之后淘汰, 已经保存的 key 也按照新的 ttl 淘汰
+func (s *localStore[T]) setTTL(ttl time.Duration) {
+	s.ttl.Store(ttl)
+}
+
+// delete 删除 key 的状态, 之后和新的 key 一样
+func (s *localStore[T]) delete(key string) {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if elem, ok := shard.items[key]; ok {
+		shard.remove(elem)
+	}
+}
+
+// each 依次在每个 key 所在段的锁内执行 fn
+func (s *localStore[T]) each(fn func(val *T)) {
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		for _, elem := range shard.items {
+			fn(&elem.Value.(*storeEntry[T]).val)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// len 当前保存的 key 数量
+func (s *localStore[T]) len() int {
+	var cnt int
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		cnt += len(shard.items)
+		shard.mu.Unlock()
+	}
+	return cnt
+}
+
+func (s *localStore[T]) shard(key string) *storeShard[T] {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// evict 从最久没有访问的 key 开始淘汰, 被淘汰的 key 追加到 evicted
+func (s *storeShard[T]) evict(now time.Time, ttl time.Duration,
+	evicted []*storeEntry[T]) []*storeEntry[T] {
+	for elem := s.lru.Back(); elem != nil; elem = s.lru.Back() {
+		entry := elem.Value.(*storeEntry[T])
+		if len(s.items) <= s.capacity && now.Sub(entry.lastAccess) <= ttl {
+			break
+		}
+		evicted = append(evicted, s.remove(elem))
+	}
+	return evicted
+}
+
+func (s *storeShard[T]) remove(elem *list.Element) *storeEntry[T] {
+	s.lru.Remove(elem)
+	entry := elem.Value.(*storeEntry[T])
+	delete(s.items, entry.key)
+	return entry
+}
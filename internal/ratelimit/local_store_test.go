@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalStore_Do(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name string
+		opts []option.Option[LocalOptions]
+		// 按顺序访问的 key 以及相对 start 的时间
+		keys    []string
+		offsets []time.Duration
+		// 最后再访问一次, 期望拿到的计数
+		key     string
+		offset  time.Duration
+		want    int
+		wantLen int
+	}{
+		{
+			name:    "保留访问过的 key",
+			keys:    []string{"a", "a", "b"},
+			offsets: []time.Duration{0, 0, 0},
+			key:     "a",
+			want:    2,
+			wantLen: 2,
+		},
+		{
+			name:    "闲置超过 ttl 的 key 被淘汰",
+			keys:    []string{"a", "a"},
+			offsets: []time.Duration{0, 0},
+			key:     "a",
+			offset:  time.Second + time.Millisecond,
+			want:    0,
+			wantLen: 1,
+		},
+		{
+			name:    "没有闲置超过 ttl 的 key 被保留",
+			keys:    []string{"a", "a"},
+			offsets: []time.Duration{0, 900 * time.Millisecond},
+			key:     "a",
+			offset:  1800 * time.Millisecond,
+			want:    2,
+			wantLen: 1,
+		},
+		{
+			name:    "超过容量淘汰最久没有访问的 key",
+			opts:    []option.Option[LocalOptions]{WithShards(1), WithMaxKeys(2)},
+			keys:    []string{"a", "b", "a", "c"},
+			offsets: []time.Duration{0, 0, 0, 0},
+			key:     "b",
+			want:    0,
+			wantLen: 2,
+		},
+		{
+			name:    "超过容量保留最近访问的 key",
+			opts:    []option.Option[LocalOptions]{WithShards(1), WithMaxKeys(2)},
+			keys:    []string{"a", "b", "a", "c"},
+			offsets: []time.Duration{0, 0, 0, 0},
+			key:     "a",
+			want:    2,
+			wantLen: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newLocalStore[int](time.Second, tc.opts...)
+			for i, key := range tc.keys {
+				s.do(key, start.Add(tc.offsets[i]), func(val *int) {
+					*val++
+				})
+			}
+			var got int
+			s.do(tc.key, start.Add(tc.offset), func(val *int) {
+				got = *val
+			})
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantLen, s.len())
+		})
+	}
+}
+
+func TestLocalStore_Concurrent(t *testing.T) {
+	s := newLocalStore[int](time.Minute, WithShards(4))
+	now := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.do(strconv.Itoa(j%10), now, func(val *int) {
+					*val++
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	for j := 0; j < 10; j++ {
+		s.do(strconv.Itoa(j), now, func(val *int) {
+			assert.Equal(t, 800, *val)
+		})
+	}
+}
+
+func BenchmarkLocalStore_Do(b *testing.B) {
+	s := newLocalStore[int](time.Minute)
+	now := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			s.do(strconv.Itoa(i%1024), now, func(val *int) {
+				*val++
+			})
+			i++
+		}
+	})
+}
+
+func TestLocalLimiter_Reset(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limiter interface {
+			Limiter
+			Resetter
+		}
+	}{
+		{name: "滑动窗口", limiter: NewLocalSlidingWindowLimiter(time.Minute, 1)},
+		{name: "固定窗口", limiter: NewLocalFixedWindowLimiter(time.Minute, 1)},
+		{name: "滑动窗口计数", limiter: NewLocalSlidingWindowCounterLimiter(time.Minute, 1)},
+		{name: "令牌桶", limiter: NewLocalTokenBucketLimiter(time.Minute, 1, 1)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, want := range []bool{false, true} {
+				limited, err := tc.limiter.Limit(ctx, "xxx")
+				assert.NoError(t, err)
+				assert.Equal(t, want, limited)
+			}
+			// 清空之后和新的 key 一样
+			assert.NoError(t, tc.limiter.Reset(ctx, "xxx"))
+			limited, err := tc.limiter.Limit(ctx, "xxx")
+			assert.NoError(t, err)
+			assert.False(t, limited)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/ecodeclub/ekit/bean/option"
+	"go.uber.org/atomic"
+	"math"
+	"time"
+)
+
+// ErrCostExceedsCapacity 请求需要的令牌数超过桶容量, 无论等多久都不会放行
+var ErrCostExceedsCapacity = errors.New("请求需要的令牌数超过了令牌桶的容量")
+
+// LocalTokenBucketLimiter 基于内存的令牌桶限流器, 适用于单实例部署.
+type LocalTokenBucketLimiter struct {
+	// 补充令牌的周期
+	interval time.Duration
+	// 每个周期补充的令牌数, 可以通过 SetRate 修改
+	rate *atomic.Int64
+	// 桶容量, 也就是允许的突发流量, 可以通过 SetCapacity 修改
+	capacity *atomic.Int64
+
+	buckets *localStore[tokenBucket]
+	nowFunc func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	// 上次补充令牌的时间
+	ts time.Time
+}
+
+// NewLocalTokenBucketLimiter interval, rate 或者 capacity 小于等于 0 时 panic.
+func NewLocalTokenBucketLimiter(interval time.Duration, rate, capacity int,
+	opts ...option.Option[LocalOptions]) *LocalTokenBucketLimiter {
+	if interval <= 0 || rate <= 0 || capacity <= 0 {
+		panic("ratelimit: 令牌桶的 interval, rate 和 capacity 必须大于 0")
+	}
+	return &LocalTokenBucketLimiter{
+		interval: interval,
+		rate:     atomic.NewInt64(int64(rate)),
+		capacity: atomic.NewInt64(int64(capacity)),
+		buckets:  newLocalStore[tokenBucket](bucketTTL(interval, rate, capacity), opts...),
+		nowFunc:  time.Now,
+	}
+}
+
+// SetRate 修改每个周期补充的令牌数, 桶里剩余的令牌继续生效. rate 小于等于 0 时 panic.
+func (l *LocalTokenBucketLimiter) SetRate(rate int) {
+	if rate <= 0 {
+		panic("ratelimit: 令牌桶的 rate 必须大于 0")
+	}
+	l.rate.Store(int64(rate))
+	l.buckets.setTTL(bucketTTL(l.interval, rate, int(l.capacity.Load())))
+}
+
+// SetCapacity 修改桶容量, 桶里超出新容量的令牌在下一次请求时丢弃. capacity 小于等于 0 时 panic.
+func (l *LocalTokenBucketLimiter) SetCapacity(capacity int) {
+	if capacity <= 0 {
+		panic("ratelimit: 令牌桶的 capacity 必须大于 0")
+	}
+	l.capacity.Store(int64(capacity))
+	l.buckets.setTTL(bucketTTL(l.interval, int(l.rate.Load()), capacity))
+}
+
+// bucketTTL 桶被补满之后状态就没有意义了
+func bucketTTL(interval time.Duration, rate, capacity int) time.Duration {
+	return time.Duration(float64(interval) * float64(capacity) / float64(rate))
+}
+
+func (l *LocalTokenBucketLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(l.Decide(ctx, key))
+}
+
+func (l *LocalTokenBucketLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return l.DecideN(ctx, key, 1)
+}
+
+func (l *LocalTokenBucketLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	now := l.nowFunc()
+	rate, capacity := float64(l.rate.Load()), float64(l.capacity.Load())
+	if float64(n) > capacity {
+		return Decision{}, ErrCostExceedsCapacity
+	}
+	d := Decision{Limit: int64(capacity)}
+	l.buckets.do(key, now, func(b *tokenBucket) {
+		if b.ts.IsZero() {
+			// 新的桶是满的
+			b.tokens, b.ts = capacity, now
+		}
+		if elapsed := now.Sub(b.ts); elapsed > 0 {
+			refill := float64(elapsed) * rate / float64(l.interval)
+			b.tokens += refill
+			b.ts = now
+		}
+		// 容量变小之后丢弃多出来的令牌
+		b.tokens = math.Min(capacity, b.tokens)
+		if b.tokens < float64(n) {
+			// 执行限流, 补充到足够的令牌之后就可以重试
+			d.RetryAfter = l.refillTime(float64(n)-b.tokens, rate)
+		} else {
+			b.tokens -= float64(n)
+			d.Allowed = true
+			d.Remaining = int64(b.tokens)
+		}
+		d.ResetAfter = l.refillTime(capacity-b.tokens, rate)
+	})
+	return d, nil
+}
+
+// refillTime 补充 tokens 个令牌需要的时间
+func (l *LocalTokenBucketLimiter) refillTime(tokens, rate float64) time.Duration {
+	return time.Duration(math.Ceil(tokens * float64(l.interval) / rate))
+}
+
+func (l *LocalTokenBucketLimiter) Reset(ctx context.Context, key string) error {
+	l.buckets.delete(key)
+	return nil
+}
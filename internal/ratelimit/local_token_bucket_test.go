@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLocalTokenBucketLimiter_Limit(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name string
+		// 相对 start 的请求时间
+		offsets []time.Duration
+		key     string
+		want    []bool
+	}{
+		{
+			name:    "桶容量内的突发流量正常通过",
+			offsets: []time.Duration{0, 0, 0},
+			want:    []bool{false, false, false},
+		},
+		{
+			name:    "令牌耗尽触发限流",
+			offsets: []time.Duration{0, 0, 0, 0},
+			want:    []bool{false, false, false, true},
+		},
+		{
+			name: "补充令牌后正常通过",
+			offsets: []time.Duration{0, 0, 0, 0,
+				100 * time.Millisecond, 100 * time.Millisecond},
+			want: []bool{false, false, false, true, false, true},
+		},
+		{
+			name:    "令牌最多补满桶容量",
+			offsets: []time.Duration{0, 0, 0, 10 * time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second},
+			want:    []bool{false, false, false, false, false, false, true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 每 100ms 补充 1 个令牌, 桶容量为 3
+			l := NewLocalTokenBucketLimiter(100*time.Millisecond, 1, 3)
+			got := make([]bool, 0, len(tc.offsets))
+			for _, offset := range tc.offsets {
+				now := start.Add(offset)
+				l.nowFunc = func() time.Time { return now }
+				limited, err := l.Limit(context.Background(), "xxx")
+				assert.NoError(t, err)
+				got = append(got, limited)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLocalTokenBucketLimiter_Keys(t *testing.T) {
+	l := NewLocalTokenBucketLimiter(time.Second, 1, 1)
+	limited, err := l.Limit(context.Background(), "xxx")
+	assert.NoError(t, err)
+	assert.False(t, limited)
+	limited, err = l.Limit(context.Background(), "xxx")
+	assert.NoError(t, err)
+	assert.True(t, limited)
+	// 另一个 key 互不影响
+	limited, err = l.Limit(context.Background(), "yyy")
+	assert.NoError(t, err)
+	assert.False(t, limited)
+}
+
+func TestLocalTokenBucketLimiter_Decide(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	// 每 100ms 补充 1 个令牌, 桶容量为 2
+	l := NewLocalTokenBucketLimiter(100*time.Millisecond, 1, 2)
+	offsets := []time.Duration{0, 0, 50 * time.Millisecond}
+	want := []Decision{
+		{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: 100 * time.Millisecond},
+		{Allowed: true, Limit: 2, Remaining: 0, ResetAfter: 200 * time.Millisecond},
+		{Allowed: false, Limit: 2, Remaining: 0, ResetAfter: 150 * time.Millisecond, RetryAfter: 50 * time.Millisecond},
+	}
+	for i, offset := range offsets {
+		now := start.Add(offset)
+		l.nowFunc = func() time.Time { return now }
+		d, err := l.Decide(context.Background(), "xxx")
+		assert.NoError(t, err)
+		assert.Equal(t, want[i], d)
+	}
+}
+
+func TestLocalTokenBucketLimiter_SetRate(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	now := start
+	// 每 100ms 补充 1 个令牌, 桶容量为 4
+	l := NewLocalTokenBucketLimiter(100*time.Millisecond, 1, 4)
+	l.nowFunc = func() time.Time { return now }
+	d, err := l.DecideN(context.Background(), "xxx", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), d.Remaining)
+
+	// 剩余的令牌继续生效
+	l.SetCapacity(2)
+	d, err = l.Decide(context.Background(), "xxx")
+	assert.NoError(t, err)
+	assert.Equal(t, Decision{Allowed: true, Limit: 2, Remaining: 0, ResetAfter: 200 * time.Millisecond}, d)
+
+	// 每 100ms 补充 10 个令牌, 20ms 就能补满
+	l.SetRate(10)
+	now = start.Add(20 * time.Millisecond)
+	d, err = l.Decide(context.Background(), "xxx")
+	assert.NoError(t, err)
+	assert.Equal(t, Decision{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: 10 * time.Millisecond}, d)
+	assert.Equal(t, 20*time.Millisecond, l.buckets.ttl.Load())
+}
+
+func TestLocalTokenBucketLimiter_Invalid(t *testing.T) {
+	testCases := []struct {
+		name      string
+		fn        func()
+		wantPanic string
+	}{
+		{
+			name:      "rate 为 0",
+			fn:        func() { NewLocalTokenBucketLimiter(time.Second, 0, 1) },
+			wantPanic: "ratelimit: 令牌桶的 interval, rate 和 capacity 必须大于 0",
+		},
+		{
+			name:      "capacity 为 0",
+			fn:        func() { NewLocalTokenBucketLimiter(time.Second, 1, 0) },
+			wantPanic: "ratelimit: 令牌桶的 interval, rate 和 capacity 必须大于 0",
+		},
+		{
+			name:      "interval 为 0",
+			fn:        func() { NewLocalTokenBucketLimiter(0, 1, 1) },
+			wantPanic: "ratelimit: 令牌桶的 interval, rate 和 capacity 必须大于 0",
+		},
+		{
+			name:      "SetRate(0)",
+			fn:        func() { NewLocalTokenBucketLimiter(time.Second, 1, 1).SetRate(0) },
+			wantPanic: "ratelimit: 令牌桶的 rate 必须大于 0",
+		},
+		{
+			name:      "SetCapacity(0)",
+			fn:        func() { NewLocalTokenBucketLimiter(time.Second, 1, 1).SetCapacity(0) },
+			wantPanic: "ratelimit: 令牌桶的 capacity 必须大于 0",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.PanicsWithValue(t, tc.wantPanic, tc.fn)
+		})
+	}
+}
+
+func TestTokenBucketLimiter_CostExceedsCapacity(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limiter WeightedLimiter
+	}{
+		{
+			name:    "本地令牌桶",
+			limiter: NewLocalTokenBucketLimiter(time.Second, 1, 3),
+		},
+		{
+			// 不会访问 Redis
+			name:    "Redis 令牌桶",
+			limiter: &RedisTokenBucketLimiter{Interval: time.Second, Rate: 1, Capacity: 3},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.limiter.DecideN(context.Background(), "xxx", 4)
+			assert.Equal(t, ErrCostExceedsCapacity, err)
+		})
+	}
+}
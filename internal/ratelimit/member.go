@@ -0,0 +1,20 @@
+package ratelimit
+
+import (
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+)
+
+var (
+	// memberPrefix 区分不同的实例
+	memberPrefix = strconv.FormatUint(rand.Uint64(), 36)
+	// memberSeq 区分同一个实例的不同请求
+	memberSeq atomic.Uint64
+)
+
+// uniqueMember 滑动窗口 ZSET 中每个请求唯一的 member,
+// 同一毫秒内的多个请求使用 now 作为 member 时会被合并成一个, 导致少算请求数.
+func uniqueMember() string {
+	return memberPrefix + "-" + strconv.FormatUint(memberSeq.Add(1), 36)
+}
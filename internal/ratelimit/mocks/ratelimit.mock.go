@@ -10,6 +10,7 @@ package limitmocks
 
 import (
 	context "context"
+	ratelimit "ginx/internal/ratelimit"
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
@@ -52,3 +53,231 @@ func (mr *MockLimiterMockRecorder) Limit(ctx, key any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Limit", reflect.TypeOf((*MockLimiter)(nil).Limit), ctx, key)
 }
+
+// MockDecisionLimiter is a mock of DecisionLimiter interface.
+type MockDecisionLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockDecisionLimiterMockRecorder
+}
+
+// MockDecisionLimiterMockRecorder is the mock recorder for MockDecisionLimiter.
+type MockDecisionLimiterMockRecorder struct {
+	mock *MockDecisionLimiter
+}
+
+// NewMockDecisionLimiter creates a new mock instance.
+func NewMockDecisionLimiter(ctrl *gomock.Controller) *MockDecisionLimiter {
+	mock := &MockDecisionLimiter{ctrl: ctrl}
+	mock.recorder = &MockDecisionLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDecisionLimiter) EXPECT() *MockDecisionLimiterMockRecorder {
+	return m.recorder
+}
+
+// Decide mocks base method.
+func (m *MockDecisionLimiter) Decide(ctx context.Context, key string) (ratelimit.Decision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Decide", ctx, key)
+	ret0, _ := ret[0].(ratelimit.Decision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Decide indicates an expected call of Decide.
+func (mr *MockDecisionLimiterMockRecorder) Decide(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decide", reflect.TypeOf((*MockDecisionLimiter)(nil).Decide), ctx, key)
+}
+
+// Limit mocks base method.
+func (m *MockDecisionLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Limit", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Limit indicates an expected call of Limit.
+func (mr *MockDecisionLimiterMockRecorder) Limit(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Limit", reflect.TypeOf((*MockDecisionLimiter)(nil).Limit), ctx, key)
+}
+
+// MockWeightedLimiter is a mock of WeightedLimiter interface.
+type MockWeightedLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockWeightedLimiterMockRecorder
+}
+
+// MockWeightedLimiterMockRecorder is the mock recorder for MockWeightedLimiter.
+type MockWeightedLimiterMockRecorder struct {
+	mock *MockWeightedLimiter
+}
+
+// NewMockWeightedLimiter creates a new mock instance.
+func NewMockWeightedLimiter(ctrl *gomock.Controller) *MockWeightedLimiter {
+	mock := &MockWeightedLimiter{ctrl: ctrl}
+	mock.recorder = &MockWeightedLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWeightedLimiter) EXPECT() *MockWeightedLimiterMockRecorder {
+	return m.recorder
+}
+
+// Decide mocks base method.
+func (m *MockWeightedLimiter) Decide(ctx context.Context, key string) (ratelimit.Decision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Decide", ctx, key)
+	ret0, _ := ret[0].(ratelimit.Decision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Decide indicates an expected call of Decide.
+func (mr *MockWeightedLimiterMockRecorder) Decide(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decide", reflect.TypeOf((*MockWeightedLimiter)(nil).Decide), ctx, key)
+}
+
+// DecideN mocks base method.
+func (m *MockWeightedLimiter) DecideN(ctx context.Context, key string, n int64) (ratelimit.Decision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DecideN", ctx, key, n)
+	ret0, _ := ret[0].(ratelimit.Decision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DecideN indicates an expected call of DecideN.
+func (mr *MockWeightedLimiterMockRecorder) DecideN(ctx, key, n any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecideN", reflect.TypeOf((*MockWeightedLimiter)(nil).DecideN), ctx, key, n)
+}
+
+// Limit mocks base method.
+func (m *MockWeightedLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Limit", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Limit indicates an expected call of Limit.
+func (mr *MockWeightedLimiterMockRecorder) Limit(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Limit", reflect.TypeOf((*MockWeightedLimiter)(nil).Limit), ctx, key)
+}
+
+// MockResetter is a mock of Resetter interface.
+type MockResetter struct {
+	ctrl     *gomock.Controller
+	recorder *MockResetterMockRecorder
+}
+
+// MockResetterMockRecorder is the mock recorder for MockResetter.
+type MockResetterMockRecorder struct {
+	mock *MockResetter
+}
+
+// NewMockResetter creates a new mock instance.
+func NewMockResetter(ctrl *gomock.Controller) *MockResetter {
+	mock := &MockResetter{ctrl: ctrl}
+	mock.recorder = &MockResetterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockResetter) EXPECT() *MockResetterMockRecorder {
+	return m.recorder
+}
+
+// Reset mocks base method.
+func (m *MockResetter) Reset(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reset indicates an expected call of Reset.
+func (mr *MockResetterMockRecorder) Reset(ctx, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockResetter)(nil).Reset), ctx, key)
+}
+
+// MockRateSetter is a mock of RateSetter interface.
+type MockRateSetter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateSetterMockRecorder
+}
+
+// MockRateSetterMockRecorder is the mock recorder for MockRateSetter.
+type MockRateSetterMockRecorder struct {
+	mock *MockRateSetter
+}
+
+// NewMockRateSetter creates a new mock instance.
+func NewMockRateSetter(ctrl *gomock.Controller) *MockRateSetter {
+	mock := &MockRateSetter{ctrl: ctrl}
+	mock.recorder = &MockRateSetterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateSetter) EXPECT() *MockRateSetterMockRecorder {
+	return m.recorder
+}
+
+// SetRate mocks base method.
+func (m *MockRateSetter) SetRate(rate int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetRate", rate)
+}
+
+// SetRate indicates an expected call of SetRate.
+func (mr *MockRateSetterMockRecorder) SetRate(rate any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRate", reflect.TypeOf((*MockRateSetter)(nil).SetRate), rate)
+}
+
+// MockCapacitySetter is a mock of CapacitySetter interface.
+type MockCapacitySetter struct {
+	ctrl     *gomock.Controller
+	recorder *MockCapacitySetterMockRecorder
+}
+
+// MockCapacitySetterMockRecorder is the mock recorder for MockCapacitySetter.
+type MockCapacitySetterMockRecorder struct {
+	mock *MockCapacitySetter
+}
+
+// NewMockCapacitySetter creates a new mock instance.
+func NewMockCapacitySetter(ctrl *gomock.Controller) *MockCapacitySetter {
+	mock := &MockCapacitySetter{ctrl: ctrl}
+	mock.recorder = &MockCapacitySetterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCapacitySetter) EXPECT() *MockCapacitySetterMockRecorder {
+	return m.recorder
+}
+
+// SetCapacity mocks base method.
+func (m *MockCapacitySetter) SetCapacity(capacity int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetCapacity", capacity)
+}
+
+// SetCapacity indicates an expected call of SetCapacity.
+func (mr *MockCapacitySetterMockRecorder) SetCapacity(capacity any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCapacity", reflect.TypeOf((*MockCapacitySetter)(nil).SetCapacity), capacity)
+}
@@ -0,0 +1,69 @@
+-- 每条规则一个 key, 和 ARGV 中的规则一一对应
+-- ARGV[1] 为当前时间, ARGV[2] 为本次请求占用的配额, ARGV[3] 为每个请求唯一的 member,
+-- 之后每两个参数为一条规则的窗口大小和阈值
+local now = tonumber(ARGV[1])
+local cost = tonumber(ARGV[2])
+local member = ARGV[3]
+local n = #KEYS
+
+local function window(i)
+    return tonumber(ARGV[i * 2 + 2])
+end
+
+local function threshold(i)
+    return tonumber(ARGV[i * 2 + 3])
+end
+
+-- 第一轮只检查, 任何一条规则触发限流都不会占用其它规则的配额
+local tripped = 0
+local retry = 0
+local reset = 0
+-- 没有触发限流时返回剩余配额最少的规则
+local tightest = 1
+local tightestRemaining = -1
+for i = 1, n do
+    local key = KEYS[i]
+    local w = window(i)
+    local t = threshold(i)
+    redis.call('ZREMRANGEBYSCORE', key, '-inf', now - w)
+    local cnt = redis.call('ZCOUNT', key, '-inf', '+inf')
+    if cnt + cost > t then
+        -- 执行限流, 足够多的请求滑出窗口之后就可以重试
+        local r = w
+        local rs = w
+        local need = cnt + cost - t
+        if cnt > 0 and need <= cnt then
+            local oldest = redis.call('ZRANGE', key, need - 1, need - 1, 'WITHSCORES')
+            r = tonumber(oldest[2]) + w - now
+        end
+        if cnt > 0 then
+            local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+            rs = tonumber(newest[2]) + w - now
+        end
+        -- 多条规则触发限流时, 以需要等待最久的为准
+        if tripped == 0 or r > retry then
+            tripped = i
+            retry = r
+            reset = rs
+        end
+    else
+        local remaining = t - cnt - cost
+        if tightestRemaining < 0 or remaining < tightestRemaining then
+            tightest = i
+            tightestRemaining = remaining
+        end
+    end
+end
+
+if tripped > 0 then
+    return { 0, threshold(tripped), 0, reset, retry, tripped }
+end
+
+-- 第二轮所有规则都占用配额, 每个配额一个 member
+for i = 1, n do
+    for j = 1, cost do
+        redis.call('ZADD', KEYS[i], now, member .. ':' .. j)
+    end
+    redis.call('PEXPIRE', KEYS[i], window(i))
+end
+return { 1, threshold(tightest), tightestRemaining, window(tightest), 0, tightest }
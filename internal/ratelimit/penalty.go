@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/ecodeclub/ekit/bean/option"
+	"time"
+)
+
+// PenaltyBox 记录限流对象触发限流的次数, 频繁触发限流的限流对象会被临时封禁.
+type PenaltyBox interface {
+	// Banned 返回剩余的封禁时长, 0 表示没有被封禁
+	Banned(ctx context.Context, key string) (time.Duration, error)
+	// Violate 记录一次触发限流, 达到阈值时封禁, 返回封禁时长, 0 表示没有封禁
+	Violate(ctx context.Context, key string) (time.Duration, error)
+}
+
+// PenaltyRule Window 内触发 Threshold 次限流之后封禁,
+// 第 k 次封禁的时长为 BaseBan * 2^(k-1), 最长为 MaxBan.
+// 上一次封禁结束之后 Memory 内没有再被封禁, 下一次重新从 BaseBan 开始.
+type PenaltyRule struct {
+	Threshold int
+	Window    time.Duration
+	BaseBan   time.Duration
+	MaxBan    time.Duration
+	Memory    time.Duration
+}
+
+// Validate 检查规则是否合法. 时长按照毫秒写入 Redis, 所以不能小于 1ms.
+func (r PenaltyRule) Validate() error {
+	switch {
+	case r.Threshold <= 0:
+		return errors.New("封禁规则的 Threshold 必须大于 0")
+	case r.Window < time.Millisecond:
+		return errors.New("封禁规则的 Window 不能小于 1ms")
+	case r.BaseBan < time.Millisecond:
+		return errors.New("封禁规则的 BaseBan 不能小于 1ms")
+	case r.MaxBan < r.BaseBan:
+		return errors.New("封禁规则的 MaxBan 不能小于 BaseBan")
+	case r.Memory < 0:
+		return errors.New("封禁规则的 Memory 不能小于 0")
+	}
+	return nil
+}
+
+// banDuration 第 strikes 次封禁的时长
+func (r PenaltyRule) banDuration(strikes int) time.Duration {
+	ban := r.BaseBan
+	for i := 1; i < strikes && ban < r.MaxBan; i++ {
+		ban *= 2
+	}
+	return min(ban, r.MaxBan)
+}
+
+// LocalPenaltyBox 基于内存的 PenaltyBox, 适用于单实例部署.
+type LocalPenaltyBox struct {
+	rule    PenaltyRule
+	states  *localStore[penaltyState]
+	nowFunc func() time.Time
+}
+
+type penaltyState struct {
+	// 当前窗口的起始时间和触发限流的次数
+	windowStart time.Time
+	violations  int
+	// 解封时间
+	bannedUntil time.Time
+	// 连续封禁的次数
+	strikes int
+}
+
+// NewLocalPenaltyBox rule 不合法时 panic.
+func NewLocalPenaltyBox(rule PenaltyRule, opts ...option.Option[LocalOptions]) *LocalPenaltyBox {
+	if err := rule.Validate(); err != nil {
+		panic("ratelimit: " + err.Error())
+	}
+	// 闲置超过这个时间的状态和新建的没有区别
+	ttl := max(rule.Window, rule.MaxBan+rule.Memory)
+	return &LocalPenaltyBox{
+		rule:    rule,
+		states:  newLocalStore[penaltyState](ttl, opts...),
+		nowFunc: time.Now,
+	}
+}
+
+func (l *LocalPenaltyBox) Banned(ctx context.Context, key string) (time.Duration, error) {
+	now := l.nowFunc()
+	var res time.Duration
+	l.states.do(key, now, func(s *penaltyState) {
+		if now.Before(s.bannedUntil) {
+			res = s.bannedUntil.Sub(now)
+		}
+	})
+	return res, nil
+}
+
+func (l *LocalPenaltyBox) Violate(ctx context.Context, key string) (time.Duration, error) {
+	now := l.nowFunc()
+	var res time.Duration
+	l.states.do(key, now, func(s *penaltyState) {
+		if !now.Before(s.windowStart.Add(l.rule.Window)) {
+			s.windowStart, s.violations = now, 0
+		}
+		s.violations++
+		if s.violations < l.rule.Threshold {
+			return
+		}
+		if now.After(s.bannedUntil.Add(l.rule.Memory)) {
+			s.strikes = 0
+		}
+		s.strikes++
+		s.violations = 0
+		res = l.rule.banDuration(s.strikes)
+		s.bannedUntil = now.Add(res)
+	})
+	return res, nil
+}
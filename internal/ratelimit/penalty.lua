@@ -0,0 +1,28 @@
+-- 当前窗口触发限流的次数
+local countKey = KEYS[1]
+-- 封禁标记, 过期时间就是剩余的封禁时长
+local banKey = KEYS[2]
+-- 连续封禁的次数
+local strikeKey = KEYS[3]
+local threshold = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local baseBan = tonumber(ARGV[3])
+local maxBan = tonumber(ARGV[4])
+-- 封禁结束之后多久没有再被封禁, 重新从 baseBan 开始
+local memory = tonumber(ARGV[5])
+
+local cnt = redis.call('INCR', countKey)
+if cnt == 1 then
+    redis.call('PEXPIRE', countKey, window)
+end
+if cnt < threshold then
+    return 0
+end
+
+redis.call('DEL', countKey)
+local strikes = redis.call('INCR', strikeKey)
+local ban = math.min(baseBan * 2 ^ (strikes - 1), maxBan)
+ban = math.floor(ban)
+redis.call('SET', banKey, 1, 'PX', ban)
+redis.call('PEXPIRE', strikeKey, ban + memory)
+return ban
@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPenaltyRule_banDuration(t *testing.T) {
+	rule := PenaltyRule{BaseBan: time.Minute, MaxBan: 10 * time.Minute}
+	testCases := []struct {
+		name    string
+		strikes int
+		want    time.Duration
+	}{
+		{name: "第一次封禁", strikes: 1, want: time.Minute},
+		{name: "第二次封禁时长翻倍", strikes: 2, want: 2 * time.Minute},
+		{name: "第四次封禁", strikes: 4, want: 8 * time.Minute},
+		{name: "不超过最长封禁时长", strikes: 5, want: 10 * time.Minute},
+		{name: "封禁次数很多", strikes: 100, want: 10 * time.Minute},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, rule.banDuration(tc.strikes))
+		})
+	}
+}
+
+func TestPenaltyRule_Validate(t *testing.T) {
+	valid := PenaltyRule{
+		Threshold: 3,
+		Window:    10 * time.Second,
+		BaseBan:   time.Minute,
+		MaxBan:    10 * time.Minute,
+	}
+	testCases := []struct {
+		name    string
+		modify  func(r *PenaltyRule)
+		wantErr string
+	}{
+		{name: "合法规则", modify: func(r *PenaltyRule) {}},
+		{name: "零值", modify: func(r *PenaltyRule) { *r = PenaltyRule{} }, wantErr: "封禁规则的 Threshold 必须大于 0"},
+		{name: "Window 为 0", modify: func(r *PenaltyRule) { r.Window = 0 }, wantErr: "封禁规则的 Window 不能小于 1ms"},
+		{name: "BaseBan 为 0", modify: func(r *PenaltyRule) { r.BaseBan = 0 }, wantErr: "封禁规则的 BaseBan 不能小于 1ms"},
+		{name: "BaseBan 小于 1ms", modify: func(r *PenaltyRule) { r.BaseBan = time.Microsecond }, wantErr: "封禁规则的 BaseBan 不能小于 1ms"},
+		{name: "MaxBan 为 0", modify: func(r *PenaltyRule) { r.MaxBan = 0 }, wantErr: "封禁规则的 MaxBan 不能小于 BaseBan"},
+		{name: "Memory 为负数", modify: func(r *PenaltyRule) { r.Memory = -time.Second }, wantErr: "封禁规则的 Memory 不能小于 0"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := valid
+			tc.modify(&rule)
+			err := rule.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestNewLocalPenaltyBox_InvalidRule(t *testing.T) {
+	assert.PanicsWithValue(t, "ratelimit: 封禁规则的 Threshold 必须大于 0", func() {
+		NewLocalPenaltyBox(PenaltyRule{})
+	})
+}
+
+func TestLocalPenaltyBox(t *testing.T) {
+	start := time.UnixMilli(1695571200000)
+	type step struct {
+		// 相对 start 的时间
+		offset time.Duration
+		// true 表示触发限流, false 表示查询封禁状态
+		violate bool
+		want    time.Duration
+	}
+	testCases := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "窗口内没有达到阈值",
+			steps: []step{
+				{offset: 0, violate: true},
+				{offset: time.Second, violate: true},
+				{offset: time.Second},
+			},
+		},
+		{
+			name: "窗口结束之后重新计数",
+			steps: []step{
+				{offset: 0, violate: true},
+				{offset: time.Second, violate: true},
+				{offset: 10 * time.Second, violate: true},
+				{offset: 11 * time.Second},
+			},
+		},
+		{
+			name: "达到阈值之后封禁",
+			steps: []step{
+				{offset: 0, violate: true},
+				{offset: time.Second, violate: true},
+				{offset: 2 * time.Second, violate: true, want: time.Minute},
+				{offset: 32 * time.Second, want: 30 * time.Second},
+				{offset: 62 * time.Second},
+			},
+		},
+		{
+			name: "再次封禁时长翻倍",
+			steps: []step{
+				{offset: 0, violate: true},
+				{offset: 0, violate: true},
+				{offset: 0, violate: true, want: time.Minute},
+				{offset: 2 * time.Minute, violate: true},
+				{offset: 2 * time.Minute, violate: true},
+				{offset: 2 * time.Minute, violate: true, want: 2 * time.Minute},
+				{offset: 3 * time.Minute, want: time.Minute},
+			},
+		},
+		{
+			name: "封禁结束之后很久没有再被封禁, 重新开始",
+			steps: []step{
+				{offset: 0, violate: true},
+				{offset: 0, violate: true},
+				{offset: 0, violate: true, want: time.Minute},
+				{offset: 2 * time.Hour, violate: true},
+				{offset: 2 * time.Hour, violate: true},
+				{offset: 2 * time.Hour, violate: true, want: time.Minute},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 10 秒内触发 3 次限流封禁 1 分钟, 最长 10 分钟, 封禁结束 1 小时之后重新开始
+			box := NewLocalPenaltyBox(PenaltyRule{
+				Threshold: 3,
+				Window:    10 * time.Second,
+				BaseBan:   time.Minute,
+				MaxBan:    10 * time.Minute,
+				Memory:    time.Hour,
+			})
+			for i, s := range tc.steps {
+				now := start.Add(s.offset)
+				box.nowFunc = func() time.Time { return now }
+				var got time.Duration
+				var err error
+				if s.violate {
+					got, err = box.Violate(context.Background(), "xxx")
+				} else {
+					got, err = box.Banned(context.Background(), "xxx")
+				}
+				require.NoError(t, err)
+				assert.Equal(t, s.want, got, "第 %d 步", i)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// initRedisCluster 本地的 Redis Cluster, 没有启动时跳过测试
+func initRedisCluster(t *testing.T) redis.Cmdable {
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: []string{"localhost:17000", "localhost:17001", "localhost:17002"},
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skip("Redis Cluster 不可用", err)
+	}
+	return client
+}
+
+// TestRedisLimiters_Cluster 多个 key 的 Lua 脚本在 Redis Cluster 上不会返回 CROSSSLOT 错误
+func TestRedisLimiters_Cluster(t *testing.T) {
+	cmd := initRedisCluster(t)
+	testCases := []struct {
+		name    string
+		limiter WeightedLimiter
+		key     string
+	}{
+		{
+			name:    "滑动窗口",
+			limiter: &RedisSlidingWindowLimiter{Cmd: cmd, Interval: time.Second, Rate: 2},
+			key:     "cluster:slide-window:xxx",
+		},
+		{
+			name:    "滑动窗口计数",
+			limiter: &RedisSlidingWindowCounterLimiter{Cmd: cmd, Interval: time.Second, Rate: 2},
+			key:     "cluster:sliding-window-counter:xxx",
+		},
+		{
+			name: "多规则",
+			limiter: &RedisMultiRuleLimiter{Cmd: cmd, Rules: []Rule{
+				{Name: "second", Interval: time.Second, Rate: 2},
+				{Name: "minute", Interval: time.Minute, Rate: 10},
+			}},
+			key: "cluster:multi-rule:xxx",
+		},
+		{
+			name:    "带 hash tag 的 key",
+			limiter: &RedisSlidingWindowCounterLimiter{Cmd: cmd, Interval: time.Second, Rate: 2},
+			key:     "cluster:v1:{user:1}",
+		},
+	}
+	// 每次运行都使用新的 key, 避免受到上一次运行的影响
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := make([]bool, 0, 3)
+			for i := 0; i < 3; i++ {
+				d, err := tc.limiter.Decide(context.Background(), tc.key+":"+suffix)
+				require.NoError(t, err)
+				got = append(got, d.Allowed)
+			}
+			assert.Equal(t, []bool{true, true, false}, got)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+//go:embed fixed_window.lua
+var luaFixedWindowLimiter string
+
+// RedisFixedWindowLimiter 基于 Redis 的固定窗口限流器.
+// 每个 key 只保存一个计数, 开销最小, 但是窗口边界上最多会通过两倍的阈值.
+type RedisFixedWindowLimiter struct {
+	Cmd redis.Cmdable
+	// 窗口大小
+	Interval time.Duration
+	// 阈值
+	Rate int
+}
+
+func (r *RedisFixedWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(r.Decide(ctx, key))
+}
+
+func (r *RedisFixedWindowLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return r.DecideN(ctx, key, 1)
+}
+
+func (r *RedisFixedWindowLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	if r.Interval < time.Millisecond {
+		return Decision{}, errIntervalTooSmall
+	}
+	return parseDecision(fixedWindowScript.Run(ctx, r.Cmd, []string{key},
+		r.Interval.Milliseconds(), r.Rate, n).Int64Slice())
+}
+
+func (r *RedisFixedWindowLimiter) Reset(ctx context.Context, key string) error {
+	return r.Cmd.Del(ctx, key).Err()
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRedisFixedWindowLimiter_Limit(t *testing.T) {
+	r := &RedisFixedWindowLimiter{
+		Cmd:      initRedis(),
+		Interval: 500 * time.Millisecond,
+		Rate:     1,
+	}
+	r.Cmd.Del(context.Background(), "fixed-window:xxx", "fixed-window:yyy")
+	testCases := []struct {
+		name     string
+		key      string
+		interval time.Duration
+		want     bool
+		wantErr  error
+	}{
+		{
+			name: "正常通过！",
+			key:  "fixed-window:xxx",
+			want: false,
+		},
+		{
+			name: "另一个key正常通过！",
+			key:  "fixed-window:yyy",
+			want: false,
+		},
+		{
+			name:     "触发限流",
+			key:      "fixed-window:xxx",
+			interval: 300 * time.Millisecond,
+			want:     true,
+		},
+		{
+			name:     "新窗口正常通过",
+			key:      "fixed-window:xxx",
+			interval: 210 * time.Millisecond,
+			want:     false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			<-time.After(tc.interval)
+			isLimited, err := r.Limit(context.Background(), tc.key)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, isLimited)
+		})
+	}
+}
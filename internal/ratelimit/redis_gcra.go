@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+//go:embed gcra.lua
+var luaGCRALimiter string
+
+// RedisGCRALimiter 基于 Redis 的 GCRA(Generic Cell Rate Algorithm) 限流器.
+// 每个 key 只保存一个理论到达时间, 内存占用为 O(1),
+// 相比 RedisSlidingWindowLimiter 更适合高频的 key.
+type RedisGCRALimiter struct {
+	Cmd redis.Cmdable
+	// 窗口大小
+	Interval time.Duration
+	// 阈值
+	Rate int
+	// 允许的突发流量, 即空闲之后可以一次性通过的请求数, 小于等于 0 时使用 1.
+	// 之后每隔 Interval/Rate 放行一个请求, 所以任意 Interval 内最多通过 Burst + Rate 个请求,
+	// Burst 为 1 时和滑动窗口基本一致.
+	// Decision.Limit 为 Rate, Remaining 为接下来一个 Interval 内还能按照速率放行的请求数.
+	Burst int
+}
+
+func (r *RedisGCRALimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(r.Decide(ctx, key))
+}
+
+func (r *RedisGCRALimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return r.DecideN(ctx, key, 1)
+}
+
+func (r *RedisGCRALimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	if r.Interval < time.Millisecond {
+		return Decision{}, errIntervalTooSmall
+	}
+	burst := r.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+	return parseDecision(gcraScript.Run(ctx, r.Cmd, []string{key},
+		r.Interval.Milliseconds(), r.Rate, burst, time.Now().UnixMilli(), n).Int64Slice())
+}
+
+func (r *RedisGCRALimiter) Reset(ctx context.Context, key string) error {
+	return r.Cmd.Del(ctx, key).Err()
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisGCRALimiter_Limit(t *testing.T) {
+	r := &RedisGCRALimiter{
+		Cmd:      initRedis(),
+		Interval: 500 * time.Millisecond,
+		Rate:     1,
+	}
+	r.Cmd.Del(context.Background(), "gcra:xxx", "gcra:yyy")
+	testCases := []struct {
+		name     string
+		key      string
+		interval time.Duration
+		want     bool
+		wantErr  error
+	}{
+		{
+			name: "正常通过！",
+			key:  "gcra:xxx",
+			want: false,
+		},
+		{
+			name: "另一个key正常通过！",
+			key:  "gcra:yyy",
+			want: false,
+		},
+		{
+			name:     "触发限流",
+			key:      "gcra:xxx",
+			interval: 300 * time.Millisecond,
+			want:     true,
+		},
+		{
+			name:     "窗口有空余正常通过",
+			key:      "gcra:xxx",
+			interval: 210 * time.Millisecond,
+			want:     false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			<-time.After(tc.interval)
+			isLimited, err := r.Limit(context.Background(), tc.key)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, isLimited)
+		})
+	}
+}
+
+// TestRedisGCRALimiter_Equivalence 同样的流量下,
+// GCRA 通过的请求数和滑动窗口基本一致, 但是占用的内存要少得多.
+func TestRedisGCRALimiter_Equivalence(t *testing.T) {
+	const (
+		gcraKey = "gcra:equivalence"
+		swKey   = "sliding-window:equivalence"
+		rate    = 50
+	)
+	cmd := initRedis()
+	ctx := context.Background()
+	cmd.Del(ctx, gcraKey, swKey)
+	defer cmd.Del(ctx, gcraKey, swKey)
+
+	interval := 500 * time.Millisecond
+	gcra := &RedisGCRALimiter{Cmd: cmd, Interval: interval, Rate: rate}
+	sw := &RedisSlidingWindowLimiter{Cmd: cmd, Interval: interval, Rate: rate}
+
+	// 以两倍阈值的速度持续请求 4 个窗口
+	var gcraPassed, swPassed int
+	ticker := time.NewTicker(interval / (2 * rate))
+	defer ticker.Stop()
+	deadline := time.Now().Add(4 * interval)
+	for time.Now().Before(deadline) {
+		<-ticker.C
+		limited, err := gcra.Limit(ctx, gcraKey)
+		require.NoError(t, err)
+		if !limited {
+			gcraPassed++
+		}
+		limited, err = sw.Limit(ctx, swKey)
+		require.NoError(t, err)
+		if !limited {
+			swPassed++
+		}
+	}
+	// 滑动窗口接近 4 个窗口的阈值
+	assert.InDelta(t, 4*rate, swPassed, rate/5)
+	// GCRA 平滑放行, 长期速率一致, 差异不超过一次突发流量(默认 1 个)和计时误差
+	assert.InDelta(t, swPassed, gcraPassed, rate/5)
+
+	gcraMem, err := cmd.MemoryUsage(ctx, gcraKey).Result()
+	require.NoError(t, err)
+	swMem, err := cmd.MemoryUsage(ctx, swKey).Result()
+	require.NoError(t, err)
+	assert.Less(t, gcraMem*5, swMem)
+}
+
+func TestRedisGCRALimiter_Decide(t *testing.T) {
+	r := &RedisGCRALimiter{
+		Cmd:      initRedis(),
+		Interval: time.Second,
+		Rate:     10,
+		Burst:    3,
+	}
+	r.Cmd.Del(context.Background(), "gcra:decide")
+	testCases := []struct {
+		name          string
+		n             int64
+		wantAllowed   bool
+		wantRemaining int64
+	}{
+		{name: "空闲时通过", n: 1, wantAllowed: true, wantRemaining: 9},
+		{name: "突发流量通过", n: 2, wantAllowed: true, wantRemaining: 7},
+		{name: "突发流量用完, 触发限流", n: 1, wantAllowed: false, wantRemaining: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := r.DecideN(context.Background(), "gcra:decide", tc.n)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantAllowed, d.Allowed)
+			// 报告的是每个窗口的阈值, 而不是 Burst
+			assert.Equal(t, int64(10), d.Limit)
+			assert.Equal(t, tc.wantRemaining, d.Remaining)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var (
+	//go:embed lease.lua
+	luaLease string
+	//go:embed lease_return.lua
+	luaLeaseReturn string
+)
+
+// RedisQuotaLeaser 基于 Redis 固定窗口计数的 QuotaLeaser
+type RedisQuotaLeaser struct {
+	Cmd redis.Cmdable
+	// 窗口大小
+	Interval time.Duration
+	// 每个窗口的全局阈值
+	Rate int
+}
+
+func (r *RedisQuotaLeaser) Lease(ctx context.Context, key string, now time.Time, n int64) (Lease, error) {
+	window := r.Interval.Milliseconds()
+	if window <= 0 {
+		return Lease{}, errIntervalTooSmall
+	}
+	current := now.UnixMilli() / window
+	lease := Lease{
+		Key:      windowKey(key, current),
+		Limit:    int64(r.Rate),
+		ExpireAt: time.UnixMilli((current + 1) * window),
+	}
+	granted, err := leaseScript.Run(ctx, r.Cmd, []string{lease.Key}, window, r.Rate, n).Int64()
+	if err != nil {
+		return Lease{}, err
+	}
+	lease.Granted = granted
+	return lease, nil
+}
+
+func (r *RedisQuotaLeaser) Return(ctx context.Context, lease Lease, n int64) error {
+	return leaseReturnScript.Run(ctx, r.Cmd, []string{lease.Key}, n).Err()
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisQuotaLeaser(t *testing.T) {
+	r := &RedisQuotaLeaser{
+		Cmd:      initRedis(),
+		Interval: time.Minute,
+		Rate:     10,
+	}
+	now := time.UnixMilli(1695571200000)
+	key := windowKey("lease:xxx", now.UnixMilli()/r.Interval.Milliseconds())
+	r.Cmd.Del(context.Background(), key)
+
+	lease, err := r.Lease(context.Background(), "lease:xxx", now, 8)
+	require.NoError(t, err)
+	assert.Equal(t, Lease{
+		Key:      key,
+		Granted:  8,
+		Limit:    10,
+		ExpireAt: now.Add(time.Minute),
+	}, lease)
+
+	// 只剩下 2 个
+	lease, err = r.Lease(context.Background(), "lease:xxx", now, 8)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), lease.Granted)
+
+	// 归还之后可以再次租借
+	require.NoError(t, r.Return(context.Background(), lease, 5))
+	lease, err = r.Lease(context.Background(), "lease:xxx", now, 8)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), lease.Granted)
+
+	// 窗口已经结束, 归还不会创建新的 key
+	r.Cmd.Del(context.Background(), key)
+	require.NoError(t, r.Return(context.Background(), lease, 5))
+	cnt, err := r.Cmd.Exists(context.Background(), key).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), cnt)
+}
+
+func TestRedisQuotaLeaser_IntervalTooSmall(t *testing.T) {
+	r := &RedisQuotaLeaser{
+		Interval: 500 * time.Microsecond,
+		Rate:     10,
+	}
+	_, err := r.Lease(context.Background(), "lease:xxx", time.UnixMilli(1695571200000), 8)
+	assert.Equal(t, errIntervalTooSmall, err)
+}
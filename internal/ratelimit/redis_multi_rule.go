@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+//go:embed multi_rule.lua
+var luaMultiRuleLimiter string
+
+// Rule 限流规则, 每 Interval 最多通过 Rate 个请求.
+type Rule struct {
+	// 规则名称, 会出现在 Decision.Rule 和 redis key 中.
+	// 为空时使用 "<Rate>/<Interval>", 例如 "10/1s".
+	Name string
+	// 窗口大小
+	Interval time.Duration
+	// 阈值
+	Rate int
+}
+
+func (r Rule) name() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%d/%s", r.Rate, r.Interval)
+}
+
+// RedisMultiRuleLimiter 基于 Redis 的多规则滑动窗口限流器,
+// 例如同一个 key 每秒最多 10 个请求并且每小时最多 1000 个请求.
+// 所有规则在一次 lua 脚本中原子地检查, 任何一条规则触发限流都不会占用其它规则的配额.
+type RedisMultiRuleLimiter struct {
+	Cmd   redis.Cmdable
+	Rules []Rule
+}
+
+func (r *RedisMultiRuleLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(r.Decide(ctx, key))
+}
+
+func (r *RedisMultiRuleLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return r.DecideN(ctx, key, 1)
+}
+
+func (r *RedisMultiRuleLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	if len(r.Rules) == 0 {
+		return Decision{Allowed: true}, nil
+	}
+	keys := make([]string, 0, len(r.Rules))
+	args := make([]any, 0, 2*len(r.Rules)+3)
+	args = append(args, time.Now().UnixMilli(), n, uniqueMember())
+	for _, rule := range r.Rules {
+		if rule.Interval < time.Millisecond {
+			return Decision{}, errIntervalTooSmall
+		}
+		keys = append(keys, subKey(key, rule.name()))
+		args = append(args, rule.Interval.Milliseconds(), rule.Rate)
+	}
+	vals, err := multiRuleScript.Run(ctx, r.Cmd, keys, args...).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	if len(vals) != 6 || vals[5] < 1 || int(vals[5]) > len(r.Rules) {
+		return Decision{}, errInvalidResult
+	}
+	d, err := parseDecision(vals[:5], nil)
+	d.Rule = r.Rules[vals[5]-1].name()
+	return d, err
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisMultiRuleLimiter_Decide(t *testing.T) {
+	r := &RedisMultiRuleLimiter{
+		Cmd: initRedis(),
+		Rules: []Rule{
+			{Name: "short", Interval: 300 * time.Millisecond, Rate: 1},
+			{Name: "long", Interval: 2 * time.Second, Rate: 2},
+		},
+	}
+	ctx := context.Background()
+	r.Cmd.Del(ctx, "{multi-rule:xxx}:short", "{multi-rule:xxx}:long")
+	testCases := []struct {
+		name     string
+		interval time.Duration
+		want     bool
+		wantRule string
+	}{
+		{
+			name:     "正常通过！",
+			want:     true,
+			wantRule: "short",
+		},
+		{
+			name:     "触发短窗口的规则",
+			interval: 100 * time.Millisecond,
+			want:     false,
+			wantRule: "short",
+		},
+		{
+			// 两条规则剩余配额都为 0 时返回第一条
+			name:     "短窗口滑过之后正常通过",
+			interval: 210 * time.Millisecond,
+			want:     true,
+			wantRule: "short",
+		},
+		{
+			name:     "触发长窗口的规则",
+			interval: 310 * time.Millisecond,
+			want:     false,
+			wantRule: "long",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			<-time.After(tc.interval)
+			d, err := r.Decide(ctx, "multi-rule:xxx")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, d.Allowed)
+			assert.Equal(t, tc.wantRule, d.Rule)
+		})
+	}
+	// 被短窗口限流的请求没有占用长窗口的配额
+	cnt, err := r.Cmd.ZCard(ctx, "multi-rule:xxx:long").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cnt)
+}
@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+//go:embed penalty.lua
+var luaPenalty string
+
+// RedisPenaltyBox 基于 Redis 的 PenaltyBox, 所有实例共享封禁状态.
+type RedisPenaltyBox struct {
+	Cmd  redis.Cmdable
+	Rule PenaltyRule
+}
+
+func (r *RedisPenaltyBox) Banned(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.Cmd.PTTL(ctx, subKey(key, "ban")).Result()
+	if err != nil {
+		return 0, err
+	}
+	// key 不存在时为负数
+	return max(ttl, 0), nil
+}
+
+func (r *RedisPenaltyBox) Violate(ctx context.Context, key string) (time.Duration, error) {
+	ban, err := penaltyScript.Run(ctx, r.Cmd,
+		[]string{subKey(key, "violations"), subKey(key, "ban"), subKey(key, "strikes")},
+		r.Rule.Threshold, r.Rule.Window.Milliseconds(), r.Rule.BaseBan.Milliseconds(),
+		r.Rule.MaxBan.Milliseconds(), r.Rule.Memory.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ban) * time.Millisecond, nil
+}
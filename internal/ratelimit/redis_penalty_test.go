@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"ginx/middlewares/redislimit/redismocks"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+var penaltyRule = PenaltyRule{
+	Threshold: 2,
+	Window:    time.Second,
+	BaseBan:   200 * time.Millisecond,
+	MaxBan:    time.Second,
+	Memory:    time.Second,
+}
+
+func TestRedisPenaltyBox(t *testing.T) {
+	box := &RedisPenaltyBox{Cmd: initRedis(), Rule: penaltyRule}
+	keys := []string{"{penalty:xxx}:violations", "{penalty:xxx}:ban", "{penalty:xxx}:strikes"}
+	box.Cmd.Del(context.Background(), keys...)
+
+	ban, err := box.Violate(context.Background(), "penalty:xxx")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), ban)
+	ban, err = box.Violate(context.Background(), "penalty:xxx")
+	require.NoError(t, err)
+	assert.Equal(t, 200*time.Millisecond, ban)
+	banned, err := box.Banned(context.Background(), "penalty:xxx")
+	require.NoError(t, err)
+	assert.True(t, banned > 0 && banned <= 200*time.Millisecond)
+
+	// 封禁结束之后再次封禁, 时长翻倍
+	time.Sleep(250 * time.Millisecond)
+	banned, err = box.Banned(context.Background(), "penalty:xxx")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), banned)
+	_, err = box.Violate(context.Background(), "penalty:xxx")
+	require.NoError(t, err)
+	ban, err = box.Violate(context.Background(), "penalty:xxx")
+	require.NoError(t, err)
+	assert.Equal(t, 400*time.Millisecond, ban)
+}
+
+func TestRedisPenaltyBox_Args(t *testing.T) {
+	keys := []string{"{xxx}:violations", "{xxx}:ban", "{xxx}:strikes"}
+	testCases := []struct {
+		name string
+		mock func(cmd *redismocks.MockCmdable)
+		call func(box *RedisPenaltyBox) (time.Duration, error)
+
+		want    time.Duration
+		wantErr error
+	}{
+		{
+			name: "触发限流之后封禁",
+			mock: func(cmd *redismocks.MockCmdable) {
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(200))
+				cmd.EXPECT().EvalSha(gomock.Any(), penaltyScript.Hash(), keys,
+					2, int64(1000), int64(200), int64(1000), int64(1000)).Return(res)
+			},
+			call: func(box *RedisPenaltyBox) (time.Duration, error) {
+				return box.Violate(context.Background(), "xxx")
+			},
+			want: 200 * time.Millisecond,
+		},
+		{
+			name: "没有被封禁",
+			mock: func(cmd *redismocks.MockCmdable) {
+				res := redis.NewDurationCmd(context.Background(), time.Millisecond)
+				res.SetVal(-2)
+				cmd.EXPECT().PTTL(gomock.Any(), "{xxx}:ban").Return(res)
+			},
+			call: func(box *RedisPenaltyBox) (time.Duration, error) {
+				return box.Banned(context.Background(), "xxx")
+			},
+			want: 0,
+		},
+		{
+			name: "剩余的封禁时长",
+			mock: func(cmd *redismocks.MockCmdable) {
+				res := redis.NewDurationCmd(context.Background(), time.Millisecond)
+				res.SetVal(150 * time.Millisecond)
+				cmd.EXPECT().PTTL(gomock.Any(), "{xxx}:ban").Return(res)
+			},
+			call: func(box *RedisPenaltyBox) (time.Duration, error) {
+				return box.Banned(context.Background(), "xxx")
+			},
+			want: 150 * time.Millisecond,
+		},
+		{
+			name: "Redis 异常",
+			mock: func(cmd *redismocks.MockCmdable) {
+				res := redis.NewDurationCmd(context.Background(), time.Millisecond)
+				res.SetErr(errors.New("redis 异常"))
+				cmd.EXPECT().PTTL(gomock.Any(), "{xxx}:ban").Return(res)
+			},
+			call: func(box *RedisPenaltyBox) (time.Duration, error) {
+				return box.Banned(context.Background(), "xxx")
+			},
+			wantErr: errors.New("redis 异常"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			tc.mock(cmd)
+			got, err := tc.call(&RedisPenaltyBox{Cmd: cmd, Rule: penaltyRule})
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
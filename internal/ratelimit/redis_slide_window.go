@@ -3,6 +3,7 @@ package ratelimit
 import (
 	"context"
 	_ "embed"
+	"github.com/ecodeclub/ekit/bean/option"
 	"github.com/redis/go-redis/v9"
 	"time"
 )
@@ -16,9 +17,53 @@ type RedisSlidingWindowLimiter struct {
 	Interval time.Duration
 	// 阈值
 	Rate int
+	// 使用 Redis 服务器的时间, 避免各个实例的时钟偏差影响窗口
+	ServerTime bool
+	// 当前时间, 为空时使用 time.Now, 测试时可以替换
+	Clock func() time.Time
+}
+
+// WithServerTime 在 Lua 脚本中使用 Redis TIME 命令获取当前时间.
+func WithServerTime() option.Option[RedisSlidingWindowLimiter] {
+	return func(r *RedisSlidingWindowLimiter) {
+		r.ServerTime = true
+	}
+}
+
+// WithClock 替换获取当前时间的函数, 使用 WithServerTime 时不生效.
+func WithClock(clock func() time.Time) option.Option[RedisSlidingWindowLimiter] {
+	return func(r *RedisSlidingWindowLimiter) {
+		r.Clock = clock
+	}
 }
 
 func (r *RedisSlidingWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
-	return r.Cmd.Eval(ctx, luaSlideWindowLimiter, []string{key},
-		r.Interval.Milliseconds(), r.Rate, time.Now().UnixMilli()).Bool()
+	return limitByDecision(r.Decide(ctx, key))
+}
+
+func (r *RedisSlidingWindowLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return r.DecideN(ctx, key, 1)
+}
+
+func (r *RedisSlidingWindowLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	if r.Interval < time.Millisecond {
+		return Decision{}, errIntervalTooSmall
+	}
+	return parseDecision(slideWindowScript.Run(ctx, r.Cmd, []string{key},
+		r.Interval.Milliseconds(), r.Rate, r.now(), n, uniqueMember()).Int64Slice())
+}
+
+// now 传给 Lua 脚本的当前时间, 为 0 时脚本使用 Redis 服务器的时间
+func (r *RedisSlidingWindowLimiter) now() int64 {
+	if r.ServerTime {
+		return 0
+	}
+	if r.Clock != nil {
+		return r.Clock().UnixMilli()
+	}
+	return time.Now().UnixMilli()
+}
+
+func (r *RedisSlidingWindowLimiter) Reset(ctx context.Context, key string) error {
+	return r.Cmd.Del(ctx, key).Err()
 }
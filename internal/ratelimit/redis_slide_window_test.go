@@ -2,8 +2,12 @@ package ratelimit
 
 import (
 	"context"
+	"ginx/middlewares/redislimit/redismocks"
+	"github.com/ecodeclub/ekit/bean/option"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
 	"testing"
 	"time"
 )
@@ -69,3 +73,214 @@ func initRedis() redis.Cmdable {
 	})
 	return redisClient
 }
+
+func TestRedisSlidingWindowLimiter_Decide(t *testing.T) {
+	r := &RedisSlidingWindowLimiter{
+		Cmd:      initRedis(),
+		Interval: 500 * time.Millisecond,
+		Rate:     2,
+	}
+	r.Cmd.Del(context.Background(), "decide:xxx")
+	d, err := r.Decide(context.Background(), "decide:xxx")
+	assert.NoError(t, err)
+	assert.Equal(t, Decision{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: 500 * time.Millisecond}, d)
+
+	d, err = r.Decide(context.Background(), "decide:xxx")
+	assert.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, int64(0), d.Remaining)
+
+	d, err = r.Decide(context.Background(), "decide:xxx")
+	assert.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.True(t, d.RetryAfter > 0 && d.RetryAfter <= 500*time.Millisecond)
+}
+
+func TestRedisSlidingWindowLimiter_Args(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name    string
+		limiter func(cmd redis.Cmdable) *RedisSlidingWindowLimiter
+		wantNow int64
+	}{
+		{
+			name: "使用注入的时钟",
+			limiter: func(cmd redis.Cmdable) *RedisSlidingWindowLimiter {
+				return &RedisSlidingWindowLimiter{Cmd: cmd, Interval: 500 * time.Millisecond, Rate: 2,
+					Clock: func() time.Time { return now }}
+			},
+			wantNow: now.UnixMilli(),
+		},
+		{
+			name: "使用 Redis 服务器的时间",
+			limiter: func(cmd redis.Cmdable) *RedisSlidingWindowLimiter {
+				r := &RedisSlidingWindowLimiter{Cmd: cmd, Interval: 500 * time.Millisecond, Rate: 2}
+				option.Apply(r, WithServerTime(), WithClock(func() time.Time { return now }))
+				return r
+			},
+			wantNow: 0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			members := make([]string, 0, 2)
+			cmd.EXPECT().EvalSha(gomock.Any(), slideWindowScript.Hash(), []string{"xxx"},
+				int64(500), 2, tc.wantNow, int64(1), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, sha string, keys []string, args ...any) *redis.Cmd {
+					members = append(members, args[4].(string))
+					res := redis.NewCmd(ctx)
+					res.SetVal([]any{int64(1), int64(2), int64(1), int64(500), int64(0)})
+					return res
+				}).Times(2)
+			r := tc.limiter(cmd)
+			for i := 0; i < 2; i++ {
+				_, err := r.Decide(context.Background(), "xxx")
+				require.NoError(t, err)
+			}
+			// 每个请求的 member 都不一样
+			assert.NotEqual(t, members[0], members[1])
+		})
+	}
+}
+
+// TestRedisSlidingWindowLimiter_SameMillisecond 同一毫秒内的请求不会被合并
+func TestRedisSlidingWindowLimiter_SameMillisecond(t *testing.T) {
+	now := time.Now()
+	r := &RedisSlidingWindowLimiter{
+		Cmd:      initRedis(),
+		Interval: time.Second,
+		Rate:     3,
+		Clock:    func() time.Time { return now },
+	}
+	r.Cmd.Del(context.Background(), "same-ms:xxx")
+	got := make([]bool, 0, 4)
+	for i := 0; i < 4; i++ {
+		d, err := r.Decide(context.Background(), "same-ms:xxx")
+		require.NoError(t, err)
+		got = append(got, d.Allowed)
+	}
+	assert.Equal(t, []bool{true, true, true, false}, got)
+}
+
+// TestRedisSlidingWindowLimiter_ServerTime 实例的时钟偏差不影响窗口
+func TestRedisSlidingWindowLimiter_ServerTime(t *testing.T) {
+	cmd := initRedis()
+	cmd.Del(context.Background(), "server-time:xxx")
+	// 两个实例的时钟相差一分钟, 使用自己的时钟时窗口完全错开
+	fast := &RedisSlidingWindowLimiter{Cmd: cmd, Interval: time.Second, Rate: 2, ServerTime: true,
+		Clock: func() time.Time { return time.Now().Add(time.Minute) }}
+	slow := &RedisSlidingWindowLimiter{Cmd: cmd, Interval: time.Second, Rate: 2, ServerTime: true,
+		Clock: func() time.Time { return time.Now().Add(-time.Minute) }}
+	got := make([]bool, 0, 3)
+	for _, r := range []*RedisSlidingWindowLimiter{fast, slow, fast} {
+		d, err := r.Decide(context.Background(), "server-time:xxx")
+		require.NoError(t, err)
+		got = append(got, d.Allowed)
+	}
+	assert.Equal(t, []bool{true, true, false}, got)
+}
+
+func TestRedisLimiter_Reset(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limiter func(cmd redis.Cmdable) Resetter
+		// 删除的 key 的数量
+		wantKeys int
+		wantErr  error
+	}{
+		{
+			name: "滑动窗口",
+			limiter: func(cmd redis.Cmdable) Resetter {
+				return &RedisSlidingWindowLimiter{Cmd: cmd, Interval: time.Minute, Rate: 1}
+			},
+			wantKeys: 1,
+		},
+		{
+			name: "GCRA",
+			limiter: func(cmd redis.Cmdable) Resetter {
+				return &RedisGCRALimiter{Cmd: cmd, Interval: time.Minute, Rate: 1, Burst: 1}
+			},
+			wantKeys: 1,
+		},
+		{
+			name: "滑动窗口计数删除两个窗口",
+			limiter: func(cmd redis.Cmdable) Resetter {
+				return &RedisSlidingWindowCounterLimiter{Cmd: cmd, Interval: time.Minute, Rate: 1}
+			},
+			wantKeys: 2,
+		},
+		{
+			name: "滑动窗口计数窗口太小",
+			limiter: func(cmd redis.Cmdable) Resetter {
+				return &RedisSlidingWindowCounterLimiter{Cmd: cmd, Interval: time.Microsecond, Rate: 1}
+			},
+			wantErr: errIntervalTooSmall,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			if tc.wantKeys > 0 {
+				cmd.EXPECT().Del(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, keys ...string) *redis.IntCmd {
+						assert.Len(t, keys, tc.wantKeys)
+						for _, key := range keys {
+							assert.Contains(t, key, "xxx")
+						}
+						res := redis.NewIntCmd(ctx)
+						res.SetVal(int64(len(keys)))
+						return res
+					})
+			}
+			err := tc.limiter(cmd).Reset(context.Background(), "xxx")
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestRedisLimiter_IntervalTooSmall(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limiter WeightedLimiter
+	}{
+		{
+			name:    "固定窗口",
+			limiter: &RedisFixedWindowLimiter{Interval: 500 * time.Microsecond, Rate: 1},
+		},
+		{
+			name:    "滑动窗口",
+			limiter: &RedisSlidingWindowLimiter{Interval: 500 * time.Microsecond, Rate: 1},
+		},
+		{
+			name:    "滑动窗口计数",
+			limiter: &RedisSlidingWindowCounterLimiter{Interval: 500 * time.Microsecond, Rate: 1},
+		},
+		{
+			name:    "GCRA",
+			limiter: &RedisGCRALimiter{Interval: 500 * time.Microsecond, Rate: 1},
+		},
+		{
+			name:    "令牌桶",
+			limiter: &RedisTokenBucketLimiter{Interval: 500 * time.Microsecond, Rate: 1, Capacity: 1},
+		},
+		{
+			name: "多规则中有一条窗口太小",
+			limiter: &RedisMultiRuleLimiter{Rules: []Rule{
+				{Interval: time.Second, Rate: 10},
+				{Interval: 500 * time.Microsecond, Rate: 1},
+			}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 不会访问 Redis
+			_, err := tc.limiter.DecideN(context.Background(), "xxx", 1)
+			assert.Equal(t, errIntervalTooSmall, err)
+		})
+	}
+}
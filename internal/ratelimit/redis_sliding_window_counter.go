@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// errIntervalTooSmall 窗口按照毫秒计算, 小于 1ms 的窗口没有意义
+var errIntervalTooSmall = errors.New("限流窗口不能小于 1ms")
+
+//go:embed sliding_window_counter.lua
+var luaSlidingWindowCounterLimiter string
+
+// RedisSlidingWindowCounterLimiter 基于 Redis 的滑动窗口计数限流器.
+// 只保存当前窗口和上一个窗口的计数, 按照上一个窗口的占比估算滑动窗口内的请求数,
+// 精度介于固定窗口和 RedisSlidingWindowLimiter 之间.
+type RedisSlidingWindowCounterLimiter struct {
+	Cmd redis.Cmdable
+	// 窗口大小, 不能小于 1ms
+	Interval time.Duration
+	// 阈值
+	Rate int
+}
+
+func (r *RedisSlidingWindowCounterLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(r.Decide(ctx, key))
+}
+
+func (r *RedisSlidingWindowCounterLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return r.DecideN(ctx, key, 1)
+}
+
+func (r *RedisSlidingWindowCounterLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	window := r.Interval.Milliseconds()
+	if window <= 0 {
+		return Decision{}, errIntervalTooSmall
+	}
+	now := time.Now().UnixMilli()
+	current := now / window
+	return parseDecision(slidingWindowCounterScript.Run(ctx, r.Cmd,
+		[]string{windowKey(key, current), windowKey(key, current-1)},
+		window, r.Rate, now-current*window, n).Int64Slice())
+}
+
+// Reset 删除当前窗口和上一个窗口的计数
+func (r *RedisSlidingWindowCounterLimiter) Reset(ctx context.Context, key string) error {
+	window := r.Interval.Milliseconds()
+	if window <= 0 {
+		return errIntervalTooSmall
+	}
+	current := time.Now().UnixMilli() / window
+	return r.Cmd.Del(ctx, windowKey(key, current), windowKey(key, current-1)).Err()
+}
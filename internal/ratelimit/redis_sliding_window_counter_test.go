@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRedisSlidingWindowCounterLimiter_Limit(t *testing.T) {
+	r := &RedisSlidingWindowCounterLimiter{
+		Cmd:      initRedis(),
+		Interval: 500 * time.Millisecond,
+		Rate:     2,
+	}
+	testCases := []struct {
+		name     string
+		key      string
+		interval time.Duration
+		want     bool
+		wantErr  error
+	}{
+		{
+			name: "正常通过！",
+			key:  "sliding-window-counter:xxx",
+			want: false,
+		},
+		{
+			name: "另一个key正常通过！",
+			key:  "sliding-window-counter:yyy",
+			want: false,
+		},
+		{
+			name: "窗口内正常通过",
+			key:  "sliding-window-counter:xxx",
+			want: false,
+		},
+		{
+			name: "触发限流",
+			key:  "sliding-window-counter:xxx",
+			want: true,
+		},
+		{
+			name:     "上一个窗口的请求全部滑出后正常通过",
+			key:      "sliding-window-counter:xxx",
+			interval: 1010 * time.Millisecond,
+			want:     false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			<-time.After(tc.interval)
+			isLimited, err := r.Limit(context.Background(), tc.key)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, isLimited)
+		})
+	}
+}
+
+func TestRedisSlidingWindowCounterLimiter_IntervalTooSmall(t *testing.T) {
+	r := &RedisSlidingWindowCounterLimiter{
+		Interval: 500 * time.Microsecond,
+		Rate:     2,
+	}
+	_, err := r.Limit(context.Background(), "sliding-window-counter:xxx")
+	assert.Equal(t, errIntervalTooSmall, err)
+}
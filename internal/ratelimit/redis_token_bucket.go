@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+//go:embed token_bucket.lua
+var luaTokenBucketLimiter string
+
+// RedisTokenBucketLimiter 基于 Redis 的令牌桶限流器.
+// 每个 key 只保存令牌数和上次补充的时间, 内存占用与速率无关.
+type RedisTokenBucketLimiter struct {
+	Cmd redis.Cmdable
+	// 补充令牌的周期
+	Interval time.Duration
+	// 每个周期补充的令牌数
+	Rate int
+	// 桶容量, 也就是允许的突发流量
+	Capacity int
+}
+
+func (r *RedisTokenBucketLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return limitByDecision(r.Decide(ctx, key))
+}
+
+func (r *RedisTokenBucketLimiter) Decide(ctx context.Context, key string) (Decision, error) {
+	return r.DecideN(ctx, key, 1)
+}
+
+func (r *RedisTokenBucketLimiter) DecideN(ctx context.Context, key string, n int64) (Decision, error) {
+	if r.Interval < time.Millisecond {
+		return Decision{}, errIntervalTooSmall
+	}
+	if n > int64(r.Capacity) {
+		return Decision{}, ErrCostExceedsCapacity
+	}
+	return parseDecision(tokenBucketScript.Run(ctx, r.Cmd, []string{key},
+		r.Interval.Milliseconds(), r.Rate, r.Capacity, time.Now().UnixMilli(), n).Int64Slice())
+}
+
+func (r *RedisTokenBucketLimiter) Reset(ctx context.Context, key string) error {
+	return r.Cmd.Del(ctx, key).Err()
+}
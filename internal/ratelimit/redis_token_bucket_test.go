@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRedisTokenBucketLimiter_Limit(t *testing.T) {
+	r := &RedisTokenBucketLimiter{
+		Cmd:      initRedis(),
+		Interval: 500 * time.Millisecond,
+		Rate:     1,
+		Capacity: 2,
+	}
+	r.Cmd.Del(context.Background(), "token-bucket:xxx", "token-bucket:yyy")
+	testCases := []struct {
+		name     string
+		key      string
+		interval time.Duration
+		want     bool
+		wantErr  error
+	}{
+		{
+			name: "正常通过！",
+			key:  "token-bucket:xxx",
+			want: false,
+		},
+		{
+			name: "突发流量正常通过",
+			key:  "token-bucket:xxx",
+			want: false,
+		},
+		{
+			name: "另一个key正常通过！",
+			key:  "token-bucket:yyy",
+			want: false,
+		},
+		{
+			name: "令牌耗尽触发限流",
+			key:  "token-bucket:xxx",
+			want: true,
+		},
+		{
+			name:     "补充令牌后正常通过",
+			key:      "token-bucket:xxx",
+			interval: 510 * time.Millisecond,
+			want:     false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			<-time.After(tc.interval)
+			isLimited, err := r.Limit(context.Background(), tc.key)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, isLimited)
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package ratelimit
+
+import "github.com/redis/go-redis/v9"
+
+// 所有 Lua 脚本都通过 redis.Script 执行:
+// 先用 EVALSHA 只发送脚本的 SHA1, Redis 没有缓存脚本(例如重启或者 SCRIPT FLUSH)返回 NOSCRIPT 时,
+// 再用 EVAL 发送完整的脚本, 之后 Redis 就会缓存这个脚本.
+// 新增的 Lua 限流器也要在这里声明脚本, 不要直接调用 Eval.
+var (
+	slideWindowScript          = redis.NewScript(luaSlideWindowLimiter)
+	tokenBucketScript          = redis.NewScript(luaTokenBucketLimiter)
+	gcraScript                 = redis.NewScript(luaGCRALimiter)
+	fixedWindowScript          = redis.NewScript(luaFixedWindowLimiter)
+	slidingWindowCounterScript = redis.NewScript(luaSlidingWindowCounterLimiter)
+	multiRuleScript            = redis.NewScript(luaMultiRuleLimiter)
+	leaseScript                = redis.NewScript(luaLease)
+	leaseReturnScript          = redis.NewScript(luaLeaseReturn)
+	penaltyScript              = redis.NewScript(luaPenalty)
+)
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"ginx/middlewares/redislimit/redismocks"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+// redisError 模拟 Redis 返回的错误, 实现了 redis.Error
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func (redisError) RedisError() {}
+
+func TestScript_Run(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) redis.Cmdable
+		want    Decision
+		wantErr error
+	}{
+		{
+			name: "EVALSHA 命中缓存",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal([]any{int64(1), int64(10), int64(9), int64(1000), int64(0)})
+				cmd.EXPECT().EvalSha(gomock.Any(), fixedWindowScript.Hash(), []string{"xxx"}, gomock.Any()).
+					Return(res)
+				return cmd
+			},
+			want: Decision{Allowed: true, Limit: 10, Remaining: 9, ResetAfter: time.Second},
+		},
+		{
+			name: "NOSCRIPT 之后发送完整的脚本",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				noScript := redis.NewCmd(context.Background())
+				noScript.SetErr(redisError("NOSCRIPT No matching script. Please use EVAL."))
+				cmd.EXPECT().EvalSha(gomock.Any(), fixedWindowScript.Hash(), []string{"xxx"}, gomock.Any()).
+					Return(noScript)
+				res := redis.NewCmd(context.Background())
+				res.SetVal([]any{int64(1), int64(10), int64(9), int64(1000), int64(0)})
+				cmd.EXPECT().Eval(gomock.Any(), luaFixedWindowLimiter, []string{"xxx"}, gomock.Any()).
+					Return(res)
+				return cmd
+			},
+			want: Decision{Allowed: true, Limit: 10, Remaining: 9, ResetAfter: time.Second},
+		},
+		{
+			name: "其他错误不会重试",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetErr(errors.New("模拟 Redis 错误"))
+				cmd.EXPECT().EvalSha(gomock.Any(), fixedWindowScript.Hash(), []string{"xxx"}, gomock.Any()).
+					Return(res)
+				return cmd
+			},
+			wantErr: errors.New("模拟 Redis 错误"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			r := &RedisFixedWindowLimiter{
+				Cmd:      tc.mock(ctrl),
+				Interval: time.Second,
+				Rate:     10,
+			}
+			d, err := r.Decide(context.Background(), "xxx")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, d)
+		})
+	}
+}
+
+// BenchmarkScript 对比每次都用 EVAL 发送完整脚本和 EVALSHA 的开销, 需要本地启动 Redis
+func BenchmarkScript(b *testing.B) {
+	cmd := initRedis()
+	if err := cmd.Ping(context.Background()).Err(); err != nil {
+		b.Skip("Redis 不可用", err)
+	}
+	benchmarks := []struct {
+		name   string
+		script *redis.Script
+		keys   []string
+		args   func(i int) []any
+	}{
+		{
+			name:   "slide window",
+			script: slideWindowScript,
+			keys:   []string{"bench:script:slide"},
+			args: func(i int) []any {
+				return []any{60000, 1000000, time.Now().UnixMilli(), 1, uniqueMember()}
+			},
+		},
+		{
+			name:   "multi rule",
+			script: multiRuleScript,
+			keys:   []string{"bench:script:multi:1", "bench:script:multi:2"},
+			args: func(i int) []any {
+				return []any{time.Now().UnixMilli(), 1, uniqueMember(), 1000, 1000000, 60000, 1000000}
+			},
+		},
+	}
+	for _, bm := range benchmarks {
+		keys := bm.keys
+		b.Run(bm.name+"/EVAL", func(b *testing.B) {
+			cmd.Del(context.Background(), keys...)
+			for i := 0; i < b.N; i++ {
+				if err := bm.script.Eval(context.Background(), cmd, keys, bm.args(i)...).Err(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(bm.name+"/EVALSHA", func(b *testing.B) {
+			cmd.Del(context.Background(), keys...)
+			for i := 0; i < b.N; i++ {
+				if err := bm.script.Run(context.Background(), cmd, keys, bm.args(i)...).Err(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
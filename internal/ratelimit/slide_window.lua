@@ -4,18 +4,45 @@ local key = KEYS[1]
 local window = tonumber(ARGV[1])
 -- 阈值
 local threshold = tonumber(ARGV[2])
+-- 当前时间, 小于等于 0 时使用 Redis 服务器的时间, 避免各个实例时钟不一致
 local now = tonumber(ARGV[3])
+-- 本次请求占用的配额
+local cost = tonumber(ARGV[4] or 1)
+-- 每个请求唯一的 member, 同一毫秒内的请求不会被合并
+local member = ARGV[5]
+
+if now <= 0 then
+    -- Redis 5 之前调用 TIME 之后不能再写入, 需要先切换到按照命令复制
+    if redis.replicate_commands then
+        redis.replicate_commands()
+    end
+    local t = redis.call('TIME')
+    now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
 -- 窗口的起始时间
 local min = now - window
 
 redis.call('ZREMRANGEBYSCORE', key, '-inf', min)
 local cnt = redis.call('ZCOUNT', key, '-inf', '+inf')
-if cnt >= threshold then
-    -- 执行限流
-    return "true"
+if cnt + cost > threshold then
+    -- 执行限流, 足够多的请求滑出窗口之后就可以重试
+    local retry = window
+    local reset = window
+    local need = cnt + cost - threshold
+    if cnt > 0 and need <= cnt then
+        local oldest = redis.call('ZRANGE', key, need - 1, need - 1, 'WITHSCORES')
+        retry = tonumber(oldest[2]) + window - now
+    end
+    if cnt > 0 then
+        local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+        reset = tonumber(newest[2]) + window - now
+    end
+    return { 0, threshold, 0, reset, retry }
 else
-    -- 把 score 和 member 都设置成 now
-    redis.call('ZADD', key, now, now)
+    -- score 设置成 now, 每个配额一个 member
+    for i = 1, cost do
+        redis.call('ZADD', key, now, member .. ':' .. i)
+    end
     redis.call('PEXPIRE', key, window)
-    return "false"
-end
\ No newline at end of file
+    return { 1, threshold, threshold - cnt - cost, window, 0 }
+end
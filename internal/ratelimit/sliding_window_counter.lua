@@ -0,0 +1,32 @@
+-- 当前窗口的计数
+local currentKey = KEYS[1]
+-- 上一个窗口的计数
+local previousKey = KEYS[2]
+-- 窗口大小
+local window = tonumber(ARGV[1])
+-- 阈值
+local threshold = tonumber(ARGV[2])
+-- 当前窗口已经过去的时间
+local elapsed = tonumber(ARGV[3])
+-- 本次请求占用的配额
+local cost = tonumber(ARGV[4] or 1)
+
+local current = tonumber(redis.call('GET', currentKey) or 0)
+local previous = tonumber(redis.call('GET', previousKey) or 0)
+-- 按照上一个窗口还在滑动窗口内的比例估算请求数
+local estimated = previous * (window - elapsed) / window + current
+if estimated + cost > threshold then
+    -- 执行限流
+    local retry = window - elapsed
+    if previous > 0 and current + cost <= threshold then
+        -- 上一个窗口的请求滑出足够多之后就可以重试
+        local at = window * (1 - (threshold - cost - current) / previous)
+        retry = math.ceil(at - elapsed)
+    end
+    return { 0, threshold, 0, 2 * window - elapsed, retry }
+end
+
+current = redis.call('INCRBY', currentKey, cost)
+-- 下一个窗口还要用到当前窗口的计数
+redis.call('PEXPIRE', currentKey, window * 2)
+return { 1, threshold, math.floor(threshold - estimated - cost), 2 * window - elapsed, 0 }
@@ -0,0 +1,41 @@
+-- 限流对象
+local key = KEYS[1]
+-- 补充令牌的周期
+local interval = tonumber(ARGV[1])
+-- 每个周期补充的令牌数
+local rate = tonumber(ARGV[2])
+-- 桶容量, 也就是允许的突发流量
+local capacity = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+-- 本次请求需要的令牌数
+local cost = tonumber(ARGV[5] or 1)
+
+local bucket = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+    -- 新的桶是满的
+    tokens = capacity
+    ts = now
+end
+
+-- 按照流逝的时间补充令牌
+local elapsed = math.max(0, now - ts)
+tokens = math.min(capacity, tokens + elapsed * rate / interval)
+
+local limited = tokens < cost
+if not limited then
+    tokens = tokens - cost
+end
+redis.call('HSET', key, 'tokens', tokens, 'ts', now)
+-- 桶被补满之后数据就没有意义了
+local reset = math.ceil((capacity - tokens) * interval / rate)
+redis.call('PEXPIRE', key, reset + 1)
+
+if limited then
+    -- 执行限流, 补充到足够的令牌之后就可以重试
+    local retry = math.ceil((cost - tokens) * interval / rate)
+    return { 0, capacity, 0, reset, retry }
+else
+    return { 1, capacity, math.floor(tokens), reset, 0 }
+end
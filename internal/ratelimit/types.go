@@ -1,7 +1,57 @@
 package ratelimit
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Limiter interface {
+	// Limit 返回 true 表示触发限流
 	Limit(ctx context.Context, key string) (bool, error)
 }
+
+// DecisionLimiter 除了是否限流之外, 还能返回剩余配额等详细信息的限流器
+type DecisionLimiter interface {
+	Limiter
+	Decide(ctx context.Context, key string) (Decision, error)
+}
+
+// WeightedLimiter 一个请求可以占用多个配额的限流器,
+// 例如导出这类开销很大的接口每次占用 10 个配额.
+type WeightedLimiter interface {
+	DecisionLimiter
+	// DecideN 占用 n 个配额, Decide 相当于 DecideN(ctx, key, 1)
+	DecideN(ctx context.Context, key string, n int64) (Decision, error)
+}
+
+// Decision 限流决策
+type Decision struct {
+	// 是否放行
+	Allowed bool
+	// 窗口内允许通过的请求数, 为 0 时表示限流器无法提供详细信息
+	Limit int64
+	// 剩余可以通过的请求数
+	Remaining int64
+	// 多久之后配额完全恢复
+	ResetAfter time.Duration
+	// 被限流时, 多久之后可以重试
+	RetryAfter time.Duration
+	// 多规则限流器中触发限流的规则, 放行时为剩余配额最少的规则
+	Rule string
+}
+
+// Resetter 可以清空限流状态的限流器, 例如登录成功之后清零失败次数
+type Resetter interface {
+	// Reset 清空 key 的限流状态, 之后和新的 key 一样
+	Reset(ctx context.Context, key string) error
+}
+
+// RateSetter 可以在运行期间修改阈值的限流器, 修改之后保留已有的限流状态
+type RateSetter interface {
+	SetRate(rate int)
+}
+
+// CapacitySetter 可以在运行期间修改桶容量的限流器, 修改之后保留已有的限流状态
+type CapacitySetter interface {
+	SetCapacity(capacity int)
+}
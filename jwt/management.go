@@ -3,6 +3,9 @@ package jwt
 import (
 	"errors"
 	"fmt"
+	"ginx/clientip"
+	"ginx/internal/ratelimit"
+	"ginx/logger"
 	"github.com/ecodeclub/ekit/bean/option"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -13,7 +16,11 @@ import (
 
 const bearerPrefix = "Bearer"
 
-var errEmptyRefreshOpts = errors.New("refreshJWTOptions are nil")
+var (
+	errEmptyRefreshOpts = errors.New("refreshJWTOptions are nil")
+	// ErrInvalidCredentials 用户名或密码错误, Login 的 verifyFn 返回这个错误时计入 LoginGuard 的失败次数
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+)
 
 type Management[T any] struct {
 	allowTokenHeader    string // 认证的请求头(存放 token 的请求头 key)
@@ -24,6 +31,8 @@ type Management[T any] struct {
 	refreshJWTOptions  *Options         // 刷新 token 选项
 	rotateRefreshToken bool             // 轮换刷新令牌
 	nowFunc            func() time.Time // 控制 jwt 的时间
+	guard              LoginGuard       // 防止暴力破解
+	l                  logger.Logger    // 日志
 }
 
 // NewManagement 定义一个 Management.
@@ -34,6 +43,8 @@ type Management[T any] struct {
 // 如要使用 refresh 相关功能则需要使用 WithRefreshJWTOptions 添加相关配置.
 // rotateRefreshToken: 默认不轮换刷新令牌.
 // 该配置需要设置 refreshJWTOptions 才有效.
+// guard: 默认为 nil, 不限制登录失败的次数.
+// l: 默认使用 slog.Default() 输出日志.
 func NewManagement[T any](accessJWTOptions Options,
 	opts ...option.Option[Management[T]]) *Management[T] {
 	dOpts := defaultManagementOptions[T]()
@@ -50,6 +61,7 @@ func defaultManagementOptions[T any]() Management[T] {
 		exposeRefreshHeader: "x-refresh-token",
 		rotateRefreshToken:  false,
 		nowFunc:             time.Now,
+		l:                   logger.NewSlogLogger(nil),
 	}
 }
 
@@ -96,25 +108,106 @@ func WithNowFunc[T any](nowFunc func() time.Time) option.Option[Management[T]] {
 	}
 }
 
+// WithLogger 设置日志.
+func WithLogger[T any](l logger.Logger) option.Option[Management[T]] {
+	return func(m *Management[T]) {
+		m.l = l
+	}
+}
+
+// WithLoginGuard 设置防止暴力破解的 LoginGuard,
+// Login 和 Refresh 校验失败都会计入失败次数, 被锁定时返回 429, 校验成功时调用 LoginGuard.Succeed.
+func WithLoginGuard[T any](guard LoginGuard) option.Option[Management[T]] {
+	return func(m *Management[T]) {
+		m.guard = guard
+	}
+}
+
+// Login 登录的 gin.HandlerFunc, 通过 exposeAccessHeader 和 exposeRefreshHeader 返回令牌.
+// usernameFn 从请求中提取用户名, 出错时返回 400.
+// verifyFn 校验凭证并返回保存到令牌中的数据, 两者都需要读取请求体时使用 ctx.ShouldBindBodyWith.
+// verifyFn 返回 ErrInvalidCredentials 时返回 401 并计入失败次数, 其他错误返回 500.
+func (m *Management[T]) Login(usernameFn func(ctx *gin.Context) (string, error),
+	verifyFn func(ctx *gin.Context, username string) (T, error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		username, err := usernameFn(ctx)
+		if err != nil {
+			m.l.Debug("提取用户名失败",
+				logger.String("path", ctx.Request.URL.Path),
+				logger.Error(err))
+			ctx.Status(http.StatusBadRequest)
+			return
+		}
+		if m.locked(ctx, username) {
+			return
+		}
+
+		data, err := verifyFn(ctx, username)
+		if errors.Is(err, ErrInvalidCredentials) {
+			m.l.Debug("登录认证失败",
+				logger.String("username", username),
+				logger.String("ip", clientip.ClientIP(ctx)))
+			m.fail(ctx, username)
+			ctx.Status(http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			m.l.Error("校验登录凭证出错",
+				logger.String("username", username),
+				logger.Error(err))
+			ctx.Status(http.StatusInternalServerError)
+			return
+		}
+		m.succeed(ctx, username)
+
+		accessToken, err := m.GenerateAccessToken(data)
+		if err != nil {
+			m.l.Error("生成资源令牌失败", logger.Error(err))
+			ctx.Status(http.StatusInternalServerError)
+			return
+		}
+		ctx.Header(m.exposeAccessHeader, accessToken)
+		if m.refreshJWTOptions != nil {
+			refreshToken, err := m.GenerateRefreshToken(data)
+			if err != nil {
+				m.l.Error("生成刷新令牌失败", logger.Error(err))
+				ctx.Status(http.StatusInternalServerError)
+				return
+			}
+			ctx.Header(m.exposeRefreshHeader, refreshToken)
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
 // Refresh 刷新 token 的 gin.HandlerFunc.
 func (m *Management[T]) Refresh(ctx *gin.Context) {
 	if m.refreshJWTOptions == nil {
-		//slog.Error("refreshJWTOptions 为 nil, 请使用 WithRefreshJWTOptions 设置 refresh 相关的配置")
+		m.l.Error("refreshJWTOptions 为 nil, 请使用 WithRefreshJWTOptions 设置 refresh 相关的配置")
 		ctx.Status(http.StatusInternalServerError)
 		return
 	}
+	// 刷新令牌无效时拿不到用户名, 只按照 IP 统计
+	if m.locked(ctx, "") {
+		return
+	}
 
 	tokenStr := m.extractTokenString(ctx)
 	clm, err := m.VerifyRefreshToken(tokenStr,
 		jwt.WithTimeFunc(m.nowFunc))
 	if err != nil {
-		//slog.Debug("refresh token verification failed")
+		m.l.Debug("刷新令牌认证失败",
+			logger.String("path", ctx.Request.URL.Path),
+			logger.String("ip", clientip.ClientIP(ctx)),
+			logger.Error(err))
+		m.fail(ctx, "")
 		ctx.Status(http.StatusUnauthorized)
 		return
 	}
+	m.succeed(ctx, "")
 	accessToken, err := m.GenerateAccessToken(clm.Data)
 	if err != nil {
-		//slog.Error("failed to generate access token")
+		m.l.Error("生成资源令牌失败", logger.Error(err))
 		ctx.Status(http.StatusInternalServerError)
 		return
 	}
@@ -124,7 +217,7 @@ func (m *Management[T]) Refresh(ctx *gin.Context) {
 	if m.rotateRefreshToken {
 		refreshToken, err := m.GenerateRefreshToken(clm.Data)
 		if err != nil {
-			//slog.Error("failed to generate refresh token")
+			m.l.Error("生成刷新令牌失败", logger.Error(err))
 			ctx.Status(http.StatusInternalServerError)
 			return
 		}
@@ -133,6 +226,59 @@ func (m *Management[T]) Refresh(ctx *gin.Context) {
 	ctx.Status(http.StatusNoContent)
 }
 
+// locked 被 guard 锁定时返回 429.
+// guard 出错时按照没有锁定处理, 避免 guard 不可用时所有用户都无法登录.
+func (m *Management[T]) locked(ctx *gin.Context, username string) bool {
+	if m.guard == nil {
+		return false
+	}
+	d, err := m.guard.Check(ctx, username)
+	if err != nil {
+		m.l.Warn("查询登录锁定状态失败",
+			logger.String("username", username),
+			logger.Error(err))
+		return false
+	}
+	if d <= 0 {
+		return false
+	}
+	m.l.Debug("登录被锁定",
+		logger.String("username", username),
+		logger.String("ip", clientip.ClientIP(ctx)))
+	ctx.Header("Retry-After", ratelimit.Seconds(d))
+	ctx.Status(http.StatusTooManyRequests)
+	return true
+}
+
+// fail 记录一次校验失败, 因此被锁定时设置 Retry-After.
+func (m *Management[T]) fail(ctx *gin.Context, username string) {
+	if m.guard == nil {
+		return
+	}
+	d, err := m.guard.Fail(ctx, username)
+	if err != nil {
+		m.l.Warn("记录登录失败出错",
+			logger.String("username", username),
+			logger.Error(err))
+		return
+	}
+	if d > 0 {
+		ctx.Header("Retry-After", ratelimit.Seconds(d))
+	}
+}
+
+// succeed 记录一次校验成功, 出错时只记录日志
+func (m *Management[T]) succeed(ctx *gin.Context, username string) {
+	if m.guard == nil {
+		return
+	}
+	if err := m.guard.Succeed(ctx, username); err != nil {
+		m.l.Warn("记录登录成功出错",
+			logger.String("username", username),
+			logger.Error(err))
+	}
+}
+
 // MiddlewareBuilder 登录认证的中间件.
 func (m *Management[T]) MiddlewareBuilder() *MiddlewareBuilder[T] {
 	return newMiddlewareBuilder[T](m)
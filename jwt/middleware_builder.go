@@ -1,6 +1,8 @@
 package jwt
 
 import (
+	"ginx/clientip"
+	"ginx/logger"
 	"github.com/ecodeclub/ekit/set"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -10,10 +12,12 @@ import (
 
 // MiddlewareBuilder 创建一个校验登录的 middleware
 // ignorePath: 默认使用 func(path string) bool { return false } 也就是全部不忽略.
+// l: 默认使用 Management 的日志.
 type MiddlewareBuilder[T any] struct {
 	ignorePath func(path string) bool // Middleware 方法中忽略认证的路径
 	manager    *Management[T]
 	nowFunc    func() time.Time // 控制 jwt 的时间
+	l          logger.Logger    // 日志
 }
 
 func newMiddlewareBuilder[T any](m *Management[T]) *MiddlewareBuilder[T] {
@@ -23,6 +27,7 @@ func newMiddlewareBuilder[T any](m *Management[T]) *MiddlewareBuilder[T] {
 			return false
 		},
 		nowFunc: m.nowFunc,
+		l:       m.l,
 	}
 }
 
@@ -36,6 +41,12 @@ func (m *MiddlewareBuilder[T]) IgnorePathFunc(fn func(path string) bool) *Middle
 	return m
 }
 
+// SetLogger 设置日志.
+func (m *MiddlewareBuilder[T]) SetLogger(l logger.Logger) *MiddlewareBuilder[T] {
+	m.l = l
+	return m
+}
+
 func (m *MiddlewareBuilder[T]) Build() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		// 不需要校验
@@ -46,7 +57,9 @@ func (m *MiddlewareBuilder[T]) Build() gin.HandlerFunc {
 		// 提取 token
 		tokenStr := m.manager.extractTokenString(ctx)
 		if tokenStr == "" {
-			//slog.Debug("failed to extract token")
+			m.l.Debug("提取令牌失败",
+				logger.String("path", ctx.Request.URL.Path),
+				logger.String("ip", clientip.ClientIP(ctx)))
 			ctx.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
@@ -55,7 +68,10 @@ func (m *MiddlewareBuilder[T]) Build() gin.HandlerFunc {
 		clm, err := m.manager.VerifyAccessToken(tokenStr,
 			jwt.WithTimeFunc(m.nowFunc))
 		if err != nil {
-			//slog.Debug("access token verification failed")
+			m.l.Debug("资源令牌认证失败",
+				logger.String("path", ctx.Request.URL.Path),
+				logger.String("ip", clientip.ClientIP(ctx)),
+				logger.Error(err))
 			ctx.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
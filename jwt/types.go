@@ -3,6 +3,7 @@ package jwt
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"time"
 )
 
 // Manager jwt 管理器
@@ -29,7 +30,28 @@ type Manager[T any] interface {
 	SetClaims(ctx *gin.Context, claims RegisteredClaims[T])
 }
 
+// LoginManager 提供登录接口的 jwt 管理器, Management 实现了这个接口.
+// 单独定义是为了不给 Manager 增加方法, 已有的 Manager 实现不受影响.
+type LoginManager[T any] interface {
+	Manager[T]
+
+	// Login 登录的 gin.HandlerFunc
+	Login(usernameFn func(ctx *gin.Context) (string, error),
+		verifyFn func(ctx *gin.Context, username string) (T, error)) gin.HandlerFunc
+}
+
 type RegisteredClaims[T any] struct {
 	Data T `json:"data"`
 	jwt.RegisteredClaims
 }
+
+// LoginGuard 防止暴力破解登录和刷新令牌, 参考 middlewares/loginguard.
+// username 为空表示只按照 IP 统计, 例如刷新令牌.
+type LoginGuard interface {
+	// Check 在校验凭证之前调用, 返回剩余的锁定时长, 0 表示没有锁定
+	Check(ctx *gin.Context, username string) (time.Duration, error)
+	// Fail 记录一次校验失败, 返回锁定时长, 0 表示没有锁定
+	Fail(ctx *gin.Context, username string) (time.Duration, error)
+	// Succeed 记录一次校验成功, 例如清零失败次数
+	Succeed(ctx *gin.Context, username string) error
+}
@@ -0,0 +1,35 @@
+package logger
+
+// FuncLogger 适配旧版本中间件的 SetLogFunc,
+// 依次传入 msg 和每个字段的 Field, 不区分日志级别.
+type FuncLogger struct {
+	fn func(msg any, args ...any)
+}
+
+func NewFuncLogger(fn func(msg any, args ...any)) *FuncLogger {
+	return &FuncLogger{fn: fn}
+}
+
+func (f *FuncLogger) Debug(msg string, args ...Field) {
+	f.log(msg, args)
+}
+
+func (f *FuncLogger) Info(msg string, args ...Field) {
+	f.log(msg, args)
+}
+
+func (f *FuncLogger) Warn(msg string, args ...Field) {
+	f.log(msg, args)
+}
+
+func (f *FuncLogger) Error(msg string, args ...Field) {
+	f.log(msg, args)
+}
+
+func (f *FuncLogger) log(msg string, args []Field) {
+	vals := make([]any, 0, len(args))
+	for _, arg := range args {
+		vals = append(vals, arg)
+	}
+	f.fn(msg, vals...)
+}
@@ -0,0 +1,22 @@
+package logger
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFuncLogger(t *testing.T) {
+	var (
+		gotMsg  any
+		gotArgs []any
+	)
+	l := NewFuncLogger(func(msg any, args ...any) {
+		gotMsg = msg
+		gotArgs = args
+	})
+	err := errors.New("mock error")
+	l.Error("限流器出错", String("key", "ip-limiter:127.0.0.1"), Error(err))
+	assert.Equal(t, "限流器出错", gotMsg)
+	assert.Equal(t, []any{String("key", "ip-limiter:127.0.0.1"), Error(err)}, gotArgs)
+}
@@ -0,0 +1,16 @@
+package logger
+
+// NopLogger 不输出任何日志
+type NopLogger struct{}
+
+func NewNopLogger() *NopLogger {
+	return &NopLogger{}
+}
+
+func (n *NopLogger) Debug(msg string, args ...Field) {}
+
+func (n *NopLogger) Info(msg string, args ...Field) {}
+
+func (n *NopLogger) Warn(msg string, args ...Field) {}
+
+func (n *NopLogger) Error(msg string, args ...Field) {}
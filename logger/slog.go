@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+type SlogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger 使用 slog 实现 Logger.
+// l 为 nil 时使用 slog.Default().
+func NewSlogLogger(l *slog.Logger) *SlogLogger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &SlogLogger{l: l}
+}
+
+func (s *SlogLogger) Debug(msg string, args ...Field) {
+	s.log(slog.LevelDebug, msg, args)
+}
+
+func (s *SlogLogger) Info(msg string, args ...Field) {
+	s.log(slog.LevelInfo, msg, args)
+}
+
+func (s *SlogLogger) Warn(msg string, args ...Field) {
+	s.log(slog.LevelWarn, msg, args)
+}
+
+func (s *SlogLogger) Error(msg string, args ...Field) {
+	s.log(slog.LevelError, msg, args)
+}
+
+func (s *SlogLogger) log(level slog.Level, msg string, args []Field) {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	attrs := make([]slog.Attr, 0, len(args))
+	for _, arg := range args {
+		attrs = append(attrs, slog.Any(arg.Key, arg.Value))
+	}
+	s.l.LogAttrs(ctx, level, msg, attrs...)
+}
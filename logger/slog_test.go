@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	testCases := []struct {
+		name  string
+		level slog.Level
+		log   func(l Logger)
+		want  string
+	}{
+		{
+			name:  "结构化字段",
+			level: slog.LevelDebug,
+			log: func(l Logger) {
+				l.Info("触发限流", String("key", "ip-limiter:127.0.0.1"), Int64("active", 3))
+			},
+			want: "level=INFO msg=触发限流 key=ip-limiter:127.0.0.1 active=3\n",
+		},
+		{
+			name:  "记录错误",
+			level: slog.LevelDebug,
+			log: func(l Logger) {
+				l.Error("限流器出错", Error(errors.New("模拟系统错误")))
+			},
+			want: "level=ERROR msg=限流器出错 error=模拟系统错误\n",
+		},
+		{
+			name:  "低于日志级别不输出",
+			level: slog.LevelInfo,
+			log: func(l Logger) {
+				l.Debug("认证失败", String("path", "/"))
+			},
+			want: "",
+		},
+		{
+			name:  "没有字段",
+			level: slog.LevelDebug,
+			log: func(l Logger) {
+				l.Warn("告警")
+			},
+			want: "level=WARN msg=告警\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			h := slog.NewTextHandler(buf, &slog.HandlerOptions{
+				Level: tc.level,
+				// 去掉时间, 方便断言
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					if a.Key == slog.TimeKey {
+						return slog.Attr{}
+					}
+					return a
+				},
+			})
+			tc.log(NewSlogLogger(slog.New(h)))
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+}
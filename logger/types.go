@@ -0,0 +1,33 @@
+package logger
+
+// Logger 日志接口, 所有中间件都通过它输出日志.
+// 可以使用 NewSlogLogger 适配 slog, 或者自行适配 zap 等日志库.
+type Logger interface {
+	Debug(msg string, args ...Field)
+	Info(msg string, args ...Field)
+	Warn(msg string, args ...Field)
+	Error(msg string, args ...Field)
+}
+
+// Field 结构化日志的字段
+type Field struct {
+	Key   string
+	Value any
+}
+
+func String(key, val string) Field {
+	return Field{Key: key, Value: val}
+}
+
+func Int64(key string, val int64) Field {
+	return Field{Key: key, Value: val}
+}
+
+func Any(key string, val any) Field {
+	return Field{Key: key, Value: val}
+}
+
+// Error 使用 key=error 记录错误.
+func Error(err error) Field {
+	return Field{Key: "error", Value: err}
+}
@@ -0,0 +1,168 @@
+package bbrlimit
+
+import (
+	"ginx/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/atomic"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BBRLimit 参考 Kratos 的 BBR 算法实现的自适应过载保护.
+// 统计窗口内单个时间片最多完成的请求数 maxPass 和最小的平均耗时 minRt,
+// 两者的乘积就是系统能够承受的最大活跃请求数 maxInFlight.
+// CPU 使用率超过阈值, 或者刚刚丢弃过请求的冷却期内, 活跃请求数超过 maxInFlight 的请求会被丢弃.
+type BBRLimit struct {
+	// 当前活跃数量
+	inFlight *atomic.Int64
+
+	mu     sync.Mutex
+	window *rollingWindow
+	// 上一次因为 CPU 过载丢弃请求的时间
+	lastDrop time.Time
+
+	// cpuFunc 返回 [0, 1] 的 CPU 使用率, 为 nil 时只根据活跃请求数判断
+	cpuFunc      func() float64
+	cpuThreshold float64
+	coolDown     time.Duration
+	nowFunc      func() time.Time
+	// l 默认使用 slog.Default()
+	l logger.Logger
+}
+
+// Stats 过载保护的统计数据
+type Stats struct {
+	CPU         float64
+	InFlight    int64
+	MaxPass     int64
+	MinRt       time.Duration
+	MaxInFlight int64
+}
+
+// NewBBRLimit 默认统计最近 10s 的数据, 切分成 100 个时间片, CPU 使用率阈值为 0.8, 冷却期为 1s.
+func NewBBRLimit() *BBRLimit {
+	return &BBRLimit{
+		inFlight:     atomic.NewInt64(0),
+		window:       newRollingWindow(10*time.Second, 100),
+		cpuThreshold: 0.8,
+		coolDown:     time.Second,
+		nowFunc:      time.Now,
+		l:            logger.NewSlogLogger(nil),
+	}
+}
+
+// SetWindow 统计窗口的长度和切分的时间片数量.
+// buckets 小于等于 0 或者时间片长度 window/buckets 为 0 时 panic.
+func (limit *BBRLimit) SetWindow(window time.Duration, buckets int) *BBRLimit {
+	if buckets <= 0 || window/time.Duration(buckets) <= 0 {
+		panic("bbrlimit: 时间片的数量和长度都必须大于 0")
+	}
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	limit.window = newRollingWindow(window, buckets)
+	return limit
+}
+
+// SetCPUFunc 设置 CPU 使用率的来源, 例如 NewProcCPU 的 Usage 方法
+func (limit *BBRLimit) SetCPUFunc(fn func() float64) *BBRLimit {
+	limit.cpuFunc = fn
+	return limit
+}
+
+func (limit *BBRLimit) SetCPUThreshold(threshold float64) *BBRLimit {
+	limit.cpuThreshold = threshold
+	return limit
+}
+
+// SetCoolDown CPU 使用率回落之后, 继续按照活跃请求数丢弃请求的时间, 避免抖动
+func (limit *BBRLimit) SetCoolDown(coolDown time.Duration) *BBRLimit {
+	limit.coolDown = coolDown
+	return limit
+}
+
+func (limit *BBRLimit) SetLogger(l logger.Logger) *BBRLimit {
+	limit.l = l
+	return limit
+}
+
+func (limit *BBRLimit) Stats() Stats {
+	now := limit.nowFunc()
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	return Stats{
+		CPU:         limit.cpu(),
+		InFlight:    limit.inFlight.Load(),
+		MaxPass:     limit.window.maxPass(now),
+		MinRt:       limit.window.minRt(now),
+		MaxInFlight: limit.maxInFlight(now),
+	}
+}
+
+func (limit *BBRLimit) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		current := limit.inFlight.Add(1)
+		defer func() {
+			limit.inFlight.Sub(1)
+		}()
+		start := limit.nowFunc()
+		if limit.shouldDrop(start, current) {
+			limit.l.Debug("触发过载保护",
+				logger.Int64("inFlight", current),
+				logger.String("path", ctx.Request.URL.Path))
+			ctx.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		ctx.Next()
+		end := limit.nowFunc()
+		limit.mu.Lock()
+		limit.window.add(end, end.Sub(start))
+		limit.mu.Unlock()
+	}
+}
+
+func (limit *BBRLimit) shouldDrop(now time.Time, inFlight int64) bool {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	if limit.cpu() < limit.cpuThreshold {
+		// 不在冷却期内
+		if limit.lastDrop.IsZero() || now.Sub(limit.lastDrop) > limit.coolDown {
+			return false
+		}
+		return limit.overload(now, inFlight)
+	}
+	drop := limit.overload(now, inFlight)
+	if drop {
+		limit.lastDrop = now
+	}
+	return drop
+}
+
+// overload 活跃请求数是否超过系统能够承受的最大值, 至少放行一个请求
+func (limit *BBRLimit) overload(now time.Time, inFlight int64) bool {
+	maxInFlight := limit.maxInFlight(now)
+	// 还没有统计数据
+	if maxInFlight == 0 {
+		return false
+	}
+	return inFlight > 1 && inFlight > maxInFlight
+}
+
+// maxInFlight 根据 Little's Law, 每个时间片的最大吞吐量 * 最小耗时 / 时间片长度
+func (limit *BBRLimit) maxInFlight(now time.Time) int64 {
+	maxPass := limit.window.maxPass(now)
+	minRt := limit.window.minRt(now)
+	if maxPass == 0 || minRt == 0 {
+		return 0
+	}
+	return int64(math.Ceil(float64(maxPass) * float64(minRt) / float64(limit.window.size)))
+}
+
+// cpu 没有设置 CPU 使用率的来源时视为一直过载
+func (limit *BBRLimit) cpu() float64 {
+	if limit.cpuFunc == nil {
+		return 1
+	}
+	return limit.cpuFunc()
+}
@@ -0,0 +1,170 @@
+package bbrlimit
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBBRLimit_Build(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	now := time.UnixMilli(1695571200000)
+	// 100ms 一个时间片, 上一个时间片完成 10 个请求, 平均耗时 50ms,
+	// 所以最多承受 10 * 50ms / 100ms = 5 个活跃请求
+	withStats := func(limit *BBRLimit) {
+		for i := 0; i < 10; i++ {
+			limit.window.add(now.Add(-50*time.Millisecond), 50*time.Millisecond)
+		}
+	}
+	testCases := []struct {
+		name     string
+		before   func(limit *BBRLimit)
+		cpu      func() float64
+		inFlight int64
+
+		wantCode int
+	}{
+		{
+			name:     "CPU 未过载",
+			before:   withStats,
+			cpu:      func() float64 { return 0.5 },
+			inFlight: 10,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "CPU 过载, 活跃请求数未超过上限",
+			before:   withStats,
+			cpu:      func() float64 { return 0.9 },
+			inFlight: 4,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "CPU 过载, 活跃请求数超过上限",
+			before:   withStats,
+			cpu:      func() float64 { return 0.9 },
+			inFlight: 6,
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name: "CPU 回落, 还在冷却期内",
+			before: func(limit *BBRLimit) {
+				withStats(limit)
+				limit.lastDrop = now.Add(-500 * time.Millisecond)
+			},
+			cpu:      func() float64 { return 0.5 },
+			inFlight: 6,
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name: "CPU 回落, 冷却期已结束",
+			before: func(limit *BBRLimit) {
+				withStats(limit)
+				limit.lastDrop = now.Add(-2 * time.Second)
+			},
+			cpu:      func() float64 { return 0.5 },
+			inFlight: 6,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "没有统计数据",
+			before:   func(limit *BBRLimit) {},
+			cpu:      func() float64 { return 0.9 },
+			inFlight: 100,
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "统计数据已经过期",
+			before: func(limit *BBRLimit) {
+				for i := 0; i < 10; i++ {
+					limit.window.add(now.Add(-2*time.Second), 50*time.Millisecond)
+				}
+			},
+			cpu:      func() float64 { return 0.9 },
+			inFlight: 100,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "没有 CPU 数据来源, 只看活跃请求数",
+			before:   withStats,
+			inFlight: 6,
+			wantCode: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limit := NewBBRLimit().
+				SetWindow(time.Second, 10).
+				SetCPUFunc(tc.cpu)
+			limit.nowFunc = func() time.Time {
+				return now
+			}
+			tc.before(limit)
+			// 算上当前请求之后的活跃请求数为 tc.inFlight
+			limit.inFlight.Store(tc.inFlight - 1)
+
+			server := gin.New()
+			server.Use(limit.Build())
+			server.GET("/bbrlimit", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+			req, err := http.NewRequest(http.MethodGet, "/bbrlimit", nil)
+			require.NoError(t, err)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+		})
+	}
+}
+
+func TestBBRLimit_Stats(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	now := time.UnixMilli(1695571200000)
+	limit := NewBBRLimit().
+		SetWindow(time.Second, 10).
+		SetCPUFunc(func() float64 { return 0.3 })
+	limit.nowFunc = func() time.Time {
+		return now
+	}
+	server := gin.New()
+	server.Use(limit.Build())
+	server.GET("/bbrlimit", func(ctx *gin.Context) {
+		// 每个请求耗时 20ms
+		now = now.Add(20 * time.Millisecond)
+		ctx.Status(http.StatusOK)
+	})
+	// 前 200ms 完成 10 个请求
+	for i := 0; i < 10; i++ {
+		req, err := http.NewRequest(http.MethodGet, "/bbrlimit", nil)
+		require.NoError(t, err)
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	now = now.Add(100 * time.Millisecond)
+
+	stats := limit.Stats()
+	assert.Equal(t, Stats{
+		CPU:         0.3,
+		MaxPass:     5,
+		MinRt:       20 * time.Millisecond,
+		MaxInFlight: 1,
+	}, stats)
+}
+
+func TestBBRLimit_SetWindow(t *testing.T) {
+	assert.NotPanics(t, func() {
+		NewBBRLimit().SetWindow(time.Second, 10)
+	})
+	assert.Panics(t, func() {
+		NewBBRLimit().SetWindow(time.Second, 0)
+	})
+	assert.Panics(t, func() {
+		NewBBRLimit().SetWindow(time.Second, -1)
+	})
+	// 时间片长度为 0
+	assert.Panics(t, func() {
+		NewBBRLimit().SetWindow(time.Nanosecond, 10)
+	})
+}
@@ -0,0 +1,123 @@
+package bbrlimit
+
+import (
+	"bufio"
+	"errors"
+	"go.uber.org/atomic"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProcCPU 定时读取 /proc/stat 计算整机的 CPU 使用率,
+// 只支持 Linux, 其他系统 NewProcCPU 会返回错误.
+type ProcCPU struct {
+	path     string
+	usage    *atomic.Float64
+	interval time.Duration
+	// 上一次采样的 CPU 时间
+	total, idle uint64
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+}
+
+// NewProcCPU 每隔 interval 采样一次 CPU 使用率, 不再使用的时候需要调用 Close.
+func NewProcCPU(interval time.Duration) (*ProcCPU, error) {
+	return newProcCPU("/proc/stat", interval)
+}
+
+func newProcCPU(path string, interval time.Duration) (*ProcCPU, error) {
+	c := &ProcCPU{
+		path:     path,
+		usage:    atomic.NewFloat64(0),
+		interval: interval,
+		closeCh:  make(chan struct{}),
+	}
+	var err error
+	c.total, c.idle, err = c.read()
+	if err != nil {
+		return nil, err
+	}
+	go c.loop()
+	return c, nil
+}
+
+// Usage 最近一次采样的 CPU 使用率, 取值范围 [0, 1]
+func (c *ProcCPU) Usage() float64 {
+	return c.usage.Load()
+}
+
+func (c *ProcCPU) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closeCh)
+	})
+}
+
+func (c *ProcCPU) loop() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.sample()
+		case <-c.closeCh:
+			return
+		}
+	}
+}
+
+func (c *ProcCPU) sample() {
+	total, idle, err := c.read()
+	if err != nil {
+		return
+	}
+	if total > c.total {
+		busy := float64((total-c.total)-(idle-c.idle)) / float64(total-c.total)
+		c.usage.Store(min(max(busy, 0), 1))
+	}
+	c.total, c.idle = total, idle
+}
+
+func (c *ProcCPU) read() (total uint64, idle uint64, err error) {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return parseProcStat(f)
+}
+
+// parseProcStat 解析 /proc/stat 第一行的 cpu 汇总数据,
+// 依次是 user nice system idle iowait irq softirq steal, idle 和 iowait 视为空闲.
+func parseProcStat(r io.Reader) (total uint64, idle uint64, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		for i, field := range fields[1:] {
+			val, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+			// guest 和 guest_nice 已经包含在 user 和 nice 里面
+			if i >= 8 {
+				break
+			}
+			total += val
+			if i == 3 || i == 4 {
+				idle += val
+			}
+		}
+		return total, idle, nil
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	return 0, 0, errors.New("/proc/stat 中没有 cpu 数据")
+}
@@ -0,0 +1,75 @@
+package bbrlimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+
+		wantTotal uint64
+		wantIdle  uint64
+		wantErr   bool
+	}{
+		{
+			name: "完整的数据",
+			input: "cpu  100 10 50 800 20 5 5 10 7 3\n" +
+				"cpu0 50 5 25 400 10 2 3 5 4 2\n",
+			wantTotal: 1000,
+			wantIdle:  820,
+		},
+		{
+			name:      "旧版本内核只有四列",
+			input:     "cpu  100 0 100 800\n",
+			wantTotal: 1000,
+			wantIdle:  800,
+		},
+		{
+			name:    "没有 cpu 数据",
+			input:   "intr 1 2 3\n",
+			wantErr: true,
+		},
+		{
+			name:    "数据格式错误",
+			input:   "cpu  100 abc 100 800\n",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			total, idle, err := parseProcStat(strings.NewReader(tc.input))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantTotal, total)
+			assert.Equal(t, tc.wantIdle, idle)
+		})
+	}
+}
+
+func TestProcCPU_Usage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stat")
+	require.NoError(t, os.WriteFile(path, []byte("cpu  100 0 100 800\n"), 0644))
+	c, err := newProcCPU(path, time.Hour)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, float64(0), c.Usage())
+
+	// 新增 1000 个时间片, 其中 250 个空闲
+	require.NoError(t, os.WriteFile(path, []byte("cpu  600 0 350 1050\n"), 0644))
+	c.sample()
+	assert.Equal(t, 0.75, c.Usage())
+
+	_, err = newProcCPU(filepath.Join(t.TempDir(), "not_exist"), time.Hour)
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package bbrlimit
+
+import (
+	"math"
+	"time"
+)
+
+// bucket 一个时间片内完成的请求数和总耗时
+type bucket struct {
+	// id 时间片的编号, 也就是 unix 纳秒 / 时间片长度, 用于惰性清空过期的时间片
+	id    int64
+	pass  int64
+	rtSum time.Duration
+}
+
+// rollingWindow 把统计窗口切分成若干个时间片, 只统计已经结束的时间片,
+// 不是并发安全的, 由调用方加锁.
+type rollingWindow struct {
+	buckets []bucket
+	size    time.Duration
+}
+
+func newRollingWindow(window time.Duration, buckets int) *rollingWindow {
+	return &rollingWindow{
+		buckets: make([]bucket, buckets),
+		size:    window / time.Duration(buckets),
+	}
+}
+
+func (w *rollingWindow) bucketID(now time.Time) int64 {
+	return now.UnixNano() / int64(w.size)
+}
+
+// add 记录一个完成的请求
+func (w *rollingWindow) add(now time.Time, rt time.Duration) {
+	id := w.bucketID(now)
+	b := &w.buckets[id%int64(len(w.buckets))]
+	if b.id != id {
+		*b = bucket{id: id}
+	}
+	b.pass++
+	b.rtSum += rt
+}
+
+// each 遍历窗口内已经结束并且有请求的时间片
+func (w *rollingWindow) each(now time.Time, fn func(b bucket)) {
+	cur := w.bucketID(now)
+	for _, b := range w.buckets {
+		if b.pass > 0 && b.id < cur && b.id > cur-int64(len(w.buckets)) {
+			fn(b)
+		}
+	}
+}
+
+// maxPass 单个时间片内最多完成的请求数
+func (w *rollingWindow) maxPass(now time.Time) int64 {
+	var res int64
+	w.each(now, func(b bucket) {
+		res = max(res, b.pass)
+	})
+	return res
+}
+
+// minRt 单个时间片内最小的平均耗时, 没有数据时返回 0
+func (w *rollingWindow) minRt(now time.Time) time.Duration {
+	res := time.Duration(math.MaxInt64)
+	w.each(now, func(b bucket) {
+		res = min(res, b.rtSum/time.Duration(b.pass))
+	})
+	if res == math.MaxInt64 {
+		return 0
+	}
+	return res
+}
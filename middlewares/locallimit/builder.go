@@ -1,9 +1,13 @@
 package locallimit
 
 import (
+	"ginx/adaptive"
+	"ginx/logger"
+	"ginx/priority"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/atomic"
 	"net/http"
+	"time"
 )
 
 type LocalActiveLimit struct {
@@ -11,12 +15,25 @@ type LocalActiveLimit struct {
 	maxActive *atomic.Int64
 	// 当前活跃数量
 	countActive *atomic.Int64
+	// l 默认使用 slog.Default()
+	l logger.Logger
+	// queue 为 nil 时超过 maxActive 的请求直接被限流
+	queue *waitQueue
+	// priorityFn 排队时的优先级, 越大越优先, 默认都为 0, 也就是先来先服务
+	priorityFn func(ctx *gin.Context) int
+	// policy 不为 nil 时低优先级的请求不能占用为高优先级预留的容量
+	policy *priority.Policy
+	// algo 不为 nil 时由算法根据请求耗时动态调整并发上限, maxActive 不再生效
+	algo    adaptive.Algorithm
+	nowFunc func() time.Time
 }
 
 func NewLocalActiveLimit(maxActive int64) *LocalActiveLimit {
 	return &LocalActiveLimit{
 		maxActive:   atomic.NewInt64(maxActive),
 		countActive: atomic.NewInt64(0),
+		l:           logger.NewSlogLogger(nil),
+		nowFunc:     time.Now,
 	}
 }
 
@@ -25,18 +42,121 @@ func (limit *LocalActiveLimit) SetMaxActive(maxActive int64) *LocalActiveLimit {
 	return limit
 }
 
+func (limit *LocalActiveLimit) SetLogger(l logger.Logger) *LocalActiveLimit {
+	limit.l = l
+	return limit
+}
+
+// SetQueue 活跃请求数达到上限之后, 最多 maxQueue 个请求排队等待,
+// 等待超过 maxWait 或者请求被取消之后才会被限流.
+func (limit *LocalActiveLimit) SetQueue(maxQueue int, maxWait time.Duration) *LocalActiveLimit {
+	limit.queue = newWaitQueue(maxQueue, maxWait)
+	return limit
+}
+
+// SetPriorityFunc 设置排队时的优先级, 越大越优先, 相同优先级先来先服务.
+func (limit *LocalActiveLimit) SetPriorityFunc(fn func(ctx *gin.Context) int) *LocalActiveLimit {
+	limit.priorityFn = fn
+	return limit
+}
+
+// SetPriorityPolicy 按照请求的优先级预留容量, 过载时先丢弃低优先级的请求.
+// 排队时如果没有调用 SetPriorityFunc, 也按照请求的优先级排队.
+func (limit *LocalActiveLimit) SetPriorityPolicy(policy *priority.Policy) *LocalActiveLimit {
+	limit.policy = policy
+	return limit
+}
+
+// SetAdaptive 使用自适应算法动态调整并发上限, 例如 adaptive.NewAIMD,
+// 请求返回 5xx 状态码时视为失败.
+func (limit *LocalActiveLimit) SetAdaptive(algo adaptive.Algorithm) *LocalActiveLimit {
+	limit.algo = algo
+	return limit
+}
+
+// QueueStats 排队的统计数据, 没有调用 SetQueue 时返回零值.
+func (limit *LocalActiveLimit) QueueStats() QueueStats {
+	if limit.queue == nil {
+		return QueueStats{}
+	}
+	return limit.queue.snapshot()
+}
+
 func (limit *LocalActiveLimit) Build() gin.HandlerFunc {
+	if limit.queue != nil {
+		return limit.buildQueue()
+	}
 	return func(ctx *gin.Context) {
 		current := limit.countActive.Add(1)
 		defer func() {
 			limit.countActive.Sub(1)
 		}()
-		if current <= limit.maxActive.Load() {
-			ctx.Next()
+		if current <= limit.limitFor(ctx) {
+			limit.next(ctx, current)
 		} else {
 			// 执行限流
+			limit.l.Debug("触发限流",
+				logger.Int64("active", current),
+				logger.String("path", ctx.Request.URL.Path))
+			ctx.AbortWithStatus(http.StatusTooManyRequests)
+		}
+		return
+	}
+}
+
+func (limit *LocalActiveLimit) buildQueue() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		p := 0
+		switch {
+		case limit.priorityFn != nil:
+			p = limit.priorityFn(ctx)
+		case limit.policy != nil:
+			p = int(limit.policy.Classify(ctx))
+		}
+		err := limit.queue.acquire(ctx.Request.Context(), limit.limitFor(ctx), p)
+		if err != nil {
+			limit.l.Debug("触发限流",
+				logger.String("path", ctx.Request.URL.Path),
+				logger.Error(err))
 			ctx.AbortWithStatus(http.StatusTooManyRequests)
+			return
 		}
+		defer func() {
+			limit.queue.release(limit.limit())
+		}()
+		current := limit.countActive.Add(1)
+		defer func() {
+			limit.countActive.Sub(1)
+		}()
+		limit.next(ctx, current)
+	}
+}
+
+func (limit *LocalActiveLimit) limit() int64 {
+	if limit.algo != nil {
+		return limit.algo.Limit()
+	}
+	return limit.maxActive.Load()
+}
+
+// limitFor 当前请求可以使用的最大活跃请求数
+func (limit *LocalActiveLimit) limitFor(ctx *gin.Context) int64 {
+	if limit.policy == nil {
+		return limit.limit()
+	}
+	_, res := limit.policy.Limit(ctx, limit.limit())
+	return res
+}
+
+// next 执行请求, 设置了自适应算法时把请求耗时反馈给算法
+func (limit *LocalActiveLimit) next(ctx *gin.Context, inflight int64) {
+	if limit.algo == nil {
+		ctx.Next()
 		return
 	}
+	start := limit.nowFunc()
+	ctx.Next()
+	rtt := limit.nowFunc().Sub(start)
+	dropped := ctx.Writer.Status() >= http.StatusInternalServerError
+	limit.algo.OnSample(rtt, inflight, dropped)
 }
@@ -1,6 +1,8 @@
 package locallimit
 
 import (
+	"ginx/adaptive"
+	"ginx/priority"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -89,3 +91,135 @@ func TestLocalActiveLimit_Build(t *testing.T) {
 		})
 	}
 }
+
+func TestLocalActiveLimit_SetAdaptive(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	testCases := []struct {
+		name string
+		// 请求的耗时和返回的状态码
+		rtt  time.Duration
+		code int
+
+		wantLimit int64
+	}{
+		{
+			name:      "请求成功, 并发上限加一",
+			rtt:       10 * time.Millisecond,
+			code:      http.StatusOK,
+			wantLimit: 3,
+		},
+		{
+			name:      "请求超时, 并发上限减半",
+			rtt:       time.Second,
+			code:      http.StatusOK,
+			wantLimit: 1,
+		},
+		{
+			name:      "请求失败, 并发上限减半",
+			rtt:       10 * time.Millisecond,
+			code:      http.StatusInternalServerError,
+			wantLimit: 1,
+		},
+		{
+			name:      "业务错误不影响并发上限",
+			rtt:       10 * time.Millisecond,
+			code:      http.StatusBadRequest,
+			wantLimit: 3,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			algo := adaptive.NewAIMD(2).
+				SetBackoffRatio(0.5).
+				SetTimeout(100 * time.Millisecond)
+			limit := NewLocalActiveLimit(100).SetAdaptive(algo)
+			// 假的时钟, 由 handler 推进
+			now := time.UnixMilli(1695571200000)
+			limit.nowFunc = func() time.Time {
+				return now
+			}
+			server := gin.New()
+			server.Use(limit.Build())
+			server.GET("/activelimit", func(ctx *gin.Context) {
+				now = now.Add(tc.rtt)
+				ctx.Status(tc.code)
+			})
+
+			req, err := http.NewRequest(http.MethodGet, "/activelimit", nil)
+			require.NoError(t, err)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.code, resp.Code)
+			assert.Equal(t, tc.wantLimit, algo.Limit())
+		})
+	}
+}
+
+func TestLocalActiveLimit_SetAdaptiveLimit(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	// 并发上限由算法决定, 忽略 maxActive
+	limit := NewLocalActiveLimit(100).SetAdaptive(adaptive.NewAIMD(1))
+	server := gin.New()
+	server.Use(limit.Build())
+	server.GET("/activelimit", func(ctx *gin.Context) {
+		time.Sleep(100 * time.Millisecond)
+		ctx.Status(http.StatusOK)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req, err := http.NewRequest(http.MethodGet, "/activelimit", nil)
+		require.NoError(t, err)
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	req, err := http.NewRequest(http.MethodGet, "/activelimit", nil)
+	require.NoError(t, err)
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	<-done
+}
+
+func TestLocalActiveLimit_SetPriorityPolicy(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	// 一共 2 个容量, 为健康检查预留 1 个
+	limit := NewLocalActiveLimit(2).SetPriorityPolicy(
+		priority.NewPolicy(priority.NewClassifier(priority.TierNormal).
+			AddRoute(priority.TierCritical, "/health")).
+			SetReserved(priority.TierCritical, 1))
+	server := gin.New()
+	server.Use(limit.Build())
+	server.GET("/activelimit", func(ctx *gin.Context) {
+		time.Sleep(100 * time.Millisecond)
+		ctx.Status(http.StatusOK)
+	})
+	server.GET("/health", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req, err := http.NewRequest(http.MethodGet, "/activelimit", nil)
+		require.NoError(t, err)
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// 普通请求不能使用预留的容量
+	req, err := http.NewRequest(http.MethodGet, "/activelimit", nil)
+	require.NoError(t, err)
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+
+	req, err = http.NewRequest(http.MethodGet, "/health", nil)
+	require.NoError(t, err)
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	<-done
+}
@@ -0,0 +1,106 @@
+package locallimit
+
+import (
+	"ginx/clientip"
+	"ginx/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/atomic"
+	"net/http"
+	"sync"
+)
+
+// LocalKeyActiveLimit 按照 key 限制活跃请求数, 例如每个用户最多同时导出 3 次.
+// 只保存有活跃请求的 key, 请求全部结束之后删除, 所以占用的内存不超过活跃请求数,
+// 同时最多保存 maxKeys 个 key, 超出之后新的 key 直接被限流.
+type LocalKeyActiveLimit struct {
+	// 每个 key 的最大活跃请求数
+	maxActive *atomic.Int64
+	// 最多同时保存的 key 数量
+	maxKeys int
+	// genKeyFn 默认使用 clientip.Key 限流
+	genKeyFn func(ctx *gin.Context) string
+	// l 默认使用 slog.Default()
+	l logger.Logger
+
+	mu     sync.Mutex
+	active map[string]int64
+}
+
+func NewLocalKeyActiveLimit(maxActive int64) *LocalKeyActiveLimit {
+	return &LocalKeyActiveLimit{
+		maxActive: atomic.NewInt64(maxActive),
+		maxKeys:   65536,
+		genKeyFn:  clientip.Key,
+		l:         logger.NewSlogLogger(nil),
+		active:    make(map[string]int64),
+	}
+}
+
+func (limit *LocalKeyActiveLimit) SetMaxActive(maxActive int64) *LocalKeyActiveLimit {
+	limit.maxActive.Store(maxActive)
+	return limit
+}
+
+// SetMaxKeys 设置最多同时保存的 key 数量
+func (limit *LocalKeyActiveLimit) SetMaxKeys(maxKeys int) *LocalKeyActiveLimit {
+	limit.maxKeys = maxKeys
+	return limit
+}
+
+func (limit *LocalKeyActiveLimit) SetKeyGenFunc(fn func(ctx *gin.Context) string) *LocalKeyActiveLimit {
+	limit.genKeyFn = fn
+	return limit
+}
+
+func (limit *LocalKeyActiveLimit) SetLogger(l logger.Logger) *LocalKeyActiveLimit {
+	limit.l = l
+	return limit
+}
+
+// Active 返回 key 当前的活跃请求数
+func (limit *LocalKeyActiveLimit) Active(key string) int64 {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	return limit.active[key]
+}
+
+func (limit *LocalKeyActiveLimit) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := limit.genKeyFn(ctx)
+		if !limit.Acquire(key) {
+			limit.l.Debug("触发限流",
+				logger.String("key", key),
+				logger.String("path", ctx.Request.URL.Path))
+			ctx.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		defer limit.Release(key)
+		ctx.Next()
+	}
+}
+
+// Acquire 增加 key 的活跃请求数, 返回 false 表示触发限流, 返回 true 之后必须调用 Release
+func (limit *LocalKeyActiveLimit) Acquire(key string) bool {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	current, ok := limit.active[key]
+	if !ok && len(limit.active) >= limit.maxKeys {
+		return false
+	}
+	if current >= limit.maxActive.Load() {
+		return false
+	}
+	limit.active[key] = current + 1
+	return true
+}
+
+// Release 减少 key 的活跃请求数
+func (limit *LocalKeyActiveLimit) Release(key string) {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	if limit.active[key] <= 1 {
+		delete(limit.active, key)
+		return
+	}
+	limit.active[key]--
+}
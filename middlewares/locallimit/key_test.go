@@ -0,0 +1,118 @@
+package locallimit
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalKeyActiveLimit_Build(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	testCases := []struct {
+		name string
+		// 正在处理的请求的 key
+		activeKeys []string
+		key        string
+
+		wantCode int
+	}{
+		{
+			name:     "没有活跃请求",
+			key:      "user-1",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "活跃请求数未达到上限",
+			activeKeys: []string{"user-1"},
+			key:        "user-1",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "活跃请求数达到上限",
+			activeKeys: []string{"user-1", "user-1"},
+			key:        "user-1",
+			wantCode:   http.StatusTooManyRequests,
+		},
+		{
+			name:       "不同的 key 互不影响",
+			activeKeys: []string{"user-1", "user-1"},
+			key:        "user-2",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "key 的数量达到上限",
+			activeKeys: []string{"user-1", "user-2", "user-3"},
+			key:        "user-4",
+			wantCode:   http.StatusTooManyRequests,
+		},
+		{
+			name:       "key 的数量达到上限, 已有的 key 不受影响",
+			activeKeys: []string{"user-1", "user-2", "user-3"},
+			key:        "user-1",
+			wantCode:   http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limit := NewLocalKeyActiveLimit(2).
+				SetMaxKeys(3).
+				SetKeyGenFunc(func(ctx *gin.Context) string {
+					return ctx.GetHeader("uid")
+				})
+			server := gin.New()
+			server.Use(limit.Build())
+			done := make(chan struct{})
+			server.GET("/export", func(ctx *gin.Context) {
+				if ctx.GetHeader("block") != "" {
+					<-done
+				}
+				ctx.Status(http.StatusOK)
+			})
+
+			var wg sync.WaitGroup
+			for _, key := range tc.activeKeys {
+				wg.Add(1)
+				go func(key string) {
+					defer wg.Done()
+					req, err := http.NewRequest(http.MethodGet, "/export", nil)
+					require.NoError(t, err)
+					req.Header.Set("uid", key)
+					req.Header.Set("block", "true")
+					server.ServeHTTP(httptest.NewRecorder(), req)
+				}(key)
+			}
+			for limit.activeCount() != len(tc.activeKeys) {
+				time.Sleep(time.Millisecond)
+			}
+
+			req, err := http.NewRequest(http.MethodGet, "/export", nil)
+			require.NoError(t, err)
+			req.Header.Set("uid", tc.key)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+
+			close(done)
+			wg.Wait()
+			// 请求全部结束之后不再保存 key
+			assert.Equal(t, 0, limit.activeCount())
+			assert.Equal(t, int64(0), limit.Active(tc.key))
+		})
+	}
+}
+
+// activeCount 所有 key 的活跃请求数之和
+func (limit *LocalKeyActiveLimit) activeCount() int {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	var res int
+	for _, cnt := range limit.active {
+		res += int(cnt)
+	}
+	return res
+}
@@ -0,0 +1,198 @@
+package locallimit
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	errQueueFull   = errors.New("排队的请求数已满")
+	errWaitTimeout = errors.New("排队超时")
+)
+
+// QueueStats 排队的统计数据
+type QueueStats struct {
+	// 当前活跃的请求数
+	Active int64
+	// 当前排队的请求数
+	Queued int64
+	// 排队之后获得执行机会的请求数, 以及它们的总等待时间和最长等待时间
+	Dequeued    int64
+	TotalWait   time.Duration
+	LongestWait time.Duration
+	// 排队超时的请求数
+	Timeouts int64
+	// 排队期间请求被取消的数量, 例如客户端断开连接
+	Canceled int64
+	// 队列已满直接拒绝的请求数
+	Rejected int64
+}
+
+// waitQueue 活跃请求数达到上限之后, 新的请求排队等待,
+// 有请求结束时按照优先级从高到低, 相同优先级先来先服务的顺序唤醒.
+type waitQueue struct {
+	mu      sync.Mutex
+	active  int64
+	waiters waiterHeap
+	// 用于保证相同优先级先来先服务
+	seq   uint64
+	stats QueueStats
+
+	// 最多排队的请求数
+	maxQueue int
+	// 最长等待时间
+	maxWait time.Duration
+}
+
+type waiter struct {
+	priority int
+	// 这个请求可以使用的最大活跃请求数, 按照优先级预留容量时每个请求可能不同
+	maxActive int64
+	seq       uint64
+	// 获得执行机会时关闭
+	ready   chan struct{}
+	granted bool
+	// 在堆中的下标, 超时的时候用于删除
+	index int
+}
+
+func newWaitQueue(maxQueue int, maxWait time.Duration) *waitQueue {
+	return &waitQueue{
+		maxQueue: maxQueue,
+		maxWait:  maxWait,
+	}
+}
+
+// acquire 获取执行机会, 返回 nil 之后必须调用 release
+func (q *waitQueue) acquire(ctx context.Context, maxActive int64, priority int) error {
+	q.mu.Lock()
+	if q.active < maxActive && !q.blockedBy(priority) {
+		q.active++
+		q.mu.Unlock()
+		return nil
+	}
+	if q.waiters.Len() >= q.maxQueue {
+		q.stats.Rejected++
+		q.mu.Unlock()
+		return errQueueFull
+	}
+	q.seq++
+	w := &waiter{
+		priority:  priority,
+		maxActive: maxActive,
+		seq:       q.seq,
+		ready:     make(chan struct{}),
+	}
+	heap.Push(&q.waiters, w)
+	q.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(q.maxWait)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-w.ready:
+		q.mu.Lock()
+		q.dequeued(time.Since(start))
+		q.mu.Unlock()
+		return nil
+	case <-timer.C:
+		err = errWaitTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w.granted {
+		// 超时的同时获得了执行机会, 直接使用
+		q.dequeued(time.Since(start))
+		return nil
+	}
+	heap.Remove(&q.waiters, w.index)
+	if err == errWaitTimeout {
+		q.stats.Timeouts++
+	} else {
+		q.stats.Canceled++
+	}
+	return err
+}
+
+// blockedBy 是否需要让排队的请求先执行.
+// 只有排在最前面的请求优先级不低于 priority, 并且它自己的容量还有空余时才需要让,
+// 否则预留给高优先级的容量会因为低优先级的请求在排队而无法使用.
+func (q *waitQueue) blockedBy(priority int) bool {
+	if q.waiters.Len() == 0 {
+		return false
+	}
+	top := q.waiters[0]
+	return top.priority >= priority && q.active < top.maxActive
+}
+
+// release 请求结束, 唤醒排队的请求
+func (q *waitQueue) release(maxActive int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active--
+	for q.waiters.Len() > 0 && q.active < min(maxActive, q.waiters[0].maxActive) {
+		w := heap.Pop(&q.waiters).(*waiter)
+		w.granted = true
+		q.active++
+		close(w.ready)
+	}
+}
+
+func (q *waitQueue) dequeued(wait time.Duration) {
+	q.stats.Dequeued++
+	q.stats.TotalWait += wait
+	if wait > q.stats.LongestWait {
+		q.stats.LongestWait = wait
+	}
+}
+
+func (q *waitQueue) snapshot() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.Active = q.active
+	stats.Queued = int64(q.waiters.Len())
+	return stats
+}
+
+// waiterHeap 优先级高的在前, 相同优先级先来的在前
+type waiterHeap []*waiter
+
+func (h waiterHeap) Len() int {
+	return len(h)
+}
+
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waiterHeap) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waiterHeap) Pop() any {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return w
+}
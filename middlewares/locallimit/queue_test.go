@@ -0,0 +1,209 @@
+package locallimit
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitQueue_Acquire(t *testing.T) {
+	testCases := []struct {
+		name     string
+		maxQueue int
+		maxWait  time.Duration
+		// 排队期间做的事情
+		during    func(q *waitQueue, cancel context.CancelFunc)
+		wantErr   error
+		wantStats QueueStats
+	}{
+		{
+			name:     "等待前面的请求结束",
+			maxQueue: 1,
+			maxWait:  time.Second,
+			during: func(q *waitQueue, cancel context.CancelFunc) {
+				q.release(1)
+			},
+			wantStats: QueueStats{Active: 1, Dequeued: 1},
+		},
+		{
+			name:     "排队超时",
+			maxQueue: 1,
+			maxWait:  20 * time.Millisecond,
+			during: func(q *waitQueue, cancel context.CancelFunc) {
+			},
+			wantErr:   errWaitTimeout,
+			wantStats: QueueStats{Active: 1, Timeouts: 1},
+		},
+		{
+			name:     "排队期间请求被取消",
+			maxQueue: 1,
+			maxWait:  time.Second,
+			during: func(q *waitQueue, cancel context.CancelFunc) {
+				cancel()
+			},
+			wantErr:   context.Canceled,
+			wantStats: QueueStats{Active: 1, Canceled: 1},
+		},
+		{
+			name:      "不排队",
+			maxQueue:  0,
+			maxWait:   time.Second,
+			during:    func(q *waitQueue, cancel context.CancelFunc) {},
+			wantErr:   errQueueFull,
+			wantStats: QueueStats{Active: 1, Rejected: 1},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			q := newWaitQueue(tc.maxQueue, tc.maxWait)
+			// 占满唯一的执行机会
+			require.NoError(t, q.acquire(context.Background(), 1, 0))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			done := make(chan struct{})
+			go func() {
+				// 等待请求进入队列
+				for q.snapshot().Queued == 0 {
+					select {
+					case <-done:
+						return
+					case <-time.After(time.Millisecond):
+					}
+				}
+				tc.during(q, cancel)
+			}()
+			err := q.acquire(ctx, 1, 0)
+			close(done)
+			assert.Equal(t, tc.wantErr, err)
+
+			stats := q.snapshot()
+			stats.TotalWait, stats.LongestWait = 0, 0
+			assert.Equal(t, tc.wantStats, stats)
+		})
+	}
+}
+
+func TestWaitQueue_Order(t *testing.T) {
+	q := newWaitQueue(10, time.Second)
+	require.NoError(t, q.acquire(context.Background(), 1, 0))
+
+	// 依次入队, 第 i 个请求的优先级为 priorities[i]
+	priorities := []int{0, 0, 5, 1, 5}
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i, p := range priorities {
+		wg.Add(1)
+		go func(i, p int) {
+			defer wg.Done()
+			require.NoError(t, q.acquire(context.Background(), 1, p))
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			q.release(1)
+		}(i, p)
+		for q.snapshot().Queued != int64(i+1) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	q.release(1)
+	wg.Wait()
+	// 优先级高的先执行, 相同优先级先来先服务
+	assert.Equal(t, []int{2, 4, 3, 0, 1}, order)
+	assert.Equal(t, int64(len(priorities)), q.snapshot().Dequeued)
+}
+
+func TestLocalActiveLimit_SetQueue(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	limit := NewLocalActiveLimit(1).
+		SetQueue(1, 500*time.Millisecond).
+		SetPriorityFunc(func(ctx *gin.Context) int {
+			p, _ := strconv.Atoi(ctx.GetHeader("priority"))
+			return p
+		})
+	server := gin.New()
+	server.Use(limit.Build())
+	server.GET("/activelimit", func(ctx *gin.Context) {
+		time.Sleep(100 * time.Millisecond)
+		ctx.Status(http.StatusOK)
+	})
+
+	// 第一个请求执行, 第二个请求排队, 第三个请求因为队列已满被限流
+	codes := make([]int, 3)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, err := http.NewRequest(http.MethodGet, "/activelimit", nil)
+			require.NoError(t, err)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			codes[i] = resp.Code
+		}(i)
+		time.Sleep(20 * time.Millisecond)
+	}
+	wg.Wait()
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+
+	stats := limit.QueueStats()
+	assert.Equal(t, int64(1), stats.Dequeued)
+	assert.Equal(t, int64(1), stats.Rejected)
+	assert.Equal(t, int64(0), stats.Active)
+	assert.True(t, stats.LongestWait > 0)
+}
+
+func TestWaitQueue_ReservedCapacity(t *testing.T) {
+	q := newWaitQueue(10, time.Second)
+	require.NoError(t, q.acquire(context.Background(), 2, 0))
+	require.NoError(t, q.acquire(context.Background(), 2, 0))
+
+	// 低优先级的请求最多使用 1 个容量
+	acquired := make(chan struct{})
+	go func() {
+		defer close(acquired)
+		require.NoError(t, q.acquire(context.Background(), 1, 0))
+	}()
+	for q.snapshot().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 还有 1 个活跃请求, 不能唤醒
+	q.release(2)
+	assert.Equal(t, int64(1), q.snapshot().Queued)
+	q.release(2)
+	<-acquired
+	assert.Equal(t, int64(1), q.snapshot().Active)
+}
+
+func TestWaitQueue_ReservedCapacityWhileQueued(t *testing.T) {
+	q := newWaitQueue(10, time.Second)
+	// 低优先级的请求最多使用 1 个容量, 高优先级的请求可以使用 2 个
+	require.NoError(t, q.acquire(context.Background(), 1, 0))
+	go func() {
+		_ = q.acquire(context.Background(), 1, 0)
+	}()
+	for q.snapshot().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 低优先级的请求在排队, 高优先级的请求仍然可以直接使用预留的容量
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.NoError(t, q.acquire(ctx, 2, 1))
+	stats := q.snapshot()
+	assert.Equal(t, int64(2), stats.Active)
+	assert.Equal(t, int64(1), stats.Queued)
+	assert.Equal(t, int64(0), stats.Dequeued)
+}
@@ -0,0 +1,185 @@
+package loginguard
+
+import (
+	"context"
+	"ginx/clientip"
+	"ginx/internal/ratelimit"
+	"ginx/logger"
+	limitkey "ginx/middlewares/ratelimit"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// Guard 防止暴力破解登录, 实现了 jwt.LoginGuard.
+// 每次校验失败分别占用用户名和 IP 限流器的 1 个配额,
+// 配额用完之后对应的用户名或者 IP 被 lockout 锁定, 锁定时长由 lockout 的 PenaltyRule 决定.
+// 校验失败的响应按照失败次数逐次翻倍延迟, 拖慢暴力破解的速度.
+// 登录成功之后清零用户名的失败次数, 要求 users 实现了 ratelimit.Resetter, 本包提供的限流器都实现了;
+// IP 的失败次数不清零, 避免攻击者用自己的账号登录成功来掩盖对其它账号的猜测.
+type Guard struct {
+	// users 和 ips 统计失败次数, 为 nil 时不统计对应的维度
+	users ratelimit.DecisionLimiter
+	// userResetter 为 nil 时登录成功不清零用户名的失败次数
+	userResetter ratelimit.Resetter
+	ips          ratelimit.DecisionLimiter
+	lockout      ratelimit.PenaltyBox
+
+	// 第 n 次失败延迟 baseDelay * 2^(n-1), 最长 maxDelay
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	sleepFunc func(ctx context.Context, d time.Duration)
+
+	ipFunc func(ctx *gin.Context) string
+	// keyBuilder 生成用户名和 IP 的限流 key, 避免和共用 Redis 的其它限流器冲突
+	keyBuilder *limitkey.KeyBuilder
+	// l 默认使用 slog.Default()
+	l logger.Logger
+}
+
+// guardKey 统计失败次数的维度
+type guardKey struct {
+	limiter ratelimit.DecisionLimiter
+	key     string
+}
+
+// NewGuard users 和 ips 统计用户名和 IP 的失败次数, 例如 15 分钟 5 次和 15 分钟 100 次的滑动窗口,
+// 其中一个为 nil 时不统计对应的维度.
+// lockout 的 Threshold 一般为 1, 即配额用完立刻锁定, 解锁之后再次用完时锁定时长翻倍, 例如
+// PenaltyRule{Threshold: 1, Window: time.Minute, BaseBan: 15 * time.Minute, MaxBan: 24 * time.Hour, Memory: 24 * time.Hour}.
+// 默认不延迟, 使用 clientip.Key, IPv6 按照 /64 网段统计,
+// key 的命名空间为 loginguard, 例如 ginx:ratelimit:loginguard:{user:tom}. lockout 为 nil 时 panic.
+func NewGuard(users, ips ratelimit.Limiter, lockout ratelimit.PenaltyBox) *Guard {
+	if lockout == nil {
+		panic("loginguard: lockout 不能为 nil")
+	}
+	g := &Guard{
+		lockout:    lockout,
+		sleepFunc:  sleep,
+		ipFunc:     clientip.Key,
+		keyBuilder: limitkey.NewKeyBuilder("loginguard"),
+		l:          logger.NewSlogLogger(nil),
+	}
+	if users != nil {
+		g.users = ratelimit.AsDecisionLimiter(users)
+		g.userResetter, _ = users.(ratelimit.Resetter)
+	}
+	if ips != nil {
+		g.ips = ratelimit.AsDecisionLimiter(ips)
+	}
+	return g
+}
+
+// SetDelay 校验失败之后延迟响应, 第 n 次失败延迟 base * 2^(n-1), 最长 max.
+// 限流器无法提供失败次数时每次都延迟 base.
+func (g *Guard) SetDelay(base, max time.Duration) *Guard {
+	g.baseDelay = base
+	g.maxDelay = max
+	return g
+}
+
+// SetIPFunc 设置获取客户端 IP 的方法, 默认使用 clientip.Default, 例如单独配置了可信代理的 clientip.Resolver 的 Key
+func (g *Guard) SetIPFunc(fn func(ctx *gin.Context) string) *Guard {
+	g.ipFunc = fn
+	return g
+}
+
+// SetKeyBuilder 设置限流 key 的前缀, 命名空间和版本, 默认命名空间为 loginguard.
+func (g *Guard) SetKeyBuilder(kb *limitkey.KeyBuilder) *Guard {
+	g.keyBuilder = kb
+	return g
+}
+
+func (g *Guard) SetLogger(l logger.Logger) *Guard {
+	g.l = l
+	return g
+}
+
+// Check 返回用户名和 IP 剩余锁定时长中较长的一个, 0 表示没有锁定
+func (g *Guard) Check(ctx *gin.Context, username string) (time.Duration, error) {
+	var res time.Duration
+	for _, k := range g.keys(ctx, username) {
+		d, err := g.lockout.Banned(ctx, k.key)
+		if err != nil {
+			return 0, err
+		}
+		res = max(res, d)
+	}
+	return res, nil
+}
+
+// Fail 记录一次校验失败, 返回锁定时长, 0 表示没有锁定.
+// 没有锁定时按照失败次数延迟返回.
+func (g *Guard) Fail(ctx *gin.Context, username string) (time.Duration, error) {
+	var (
+		lock     time.Duration
+		failures int64
+	)
+	for _, k := range g.keys(ctx, username) {
+		d, err := k.limiter.Decide(ctx, k.key)
+		if err != nil {
+			return 0, err
+		}
+		if d.Limit > 0 {
+			failures = max(failures, d.Limit-d.Remaining)
+		} else {
+			failures = max(failures, 1)
+		}
+		if d.Allowed {
+			continue
+		}
+		ban, err := g.lockout.Violate(ctx, k.key)
+		if err != nil {
+			return 0, err
+		}
+		if ban > 0 {
+			g.l.Info("登录失败次数过多, 锁定",
+				logger.String("key", k.key),
+				logger.String("ban", ban.String()))
+		}
+		lock = max(lock, ban)
+	}
+	if lock == 0 && failures > 0 {
+		g.sleepFunc(ctx.Request.Context(), g.delay(failures))
+	}
+	return lock, nil
+}
+
+// Succeed 校验成功之后清零用户名的失败次数, username 为空时什么也不做
+func (g *Guard) Succeed(ctx *gin.Context, username string) error {
+	if g.users == nil || g.userResetter == nil || username == "" {
+		return nil
+	}
+	return g.userResetter.Reset(ctx, g.keyBuilder.Build("user", username))
+}
+
+func (g *Guard) keys(ctx *gin.Context, username string) []guardKey {
+	keys := make([]guardKey, 0, 2)
+	if g.users != nil && username != "" {
+		keys = append(keys, guardKey{limiter: g.users, key: g.keyBuilder.Build("user", username)})
+	}
+	if g.ips != nil {
+		keys = append(keys, guardKey{limiter: g.ips, key: g.keyBuilder.Build("ip", g.ipFunc(ctx))})
+	}
+	return keys
+}
+
+// delay 第 failures 次失败的延迟
+func (g *Guard) delay(failures int64) time.Duration {
+	d := g.baseDelay
+	for i := int64(1); i < failures && d < g.maxDelay; i++ {
+		d *= 2
+	}
+	return min(d, g.maxDelay)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
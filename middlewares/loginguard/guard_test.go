@@ -0,0 +1,245 @@
+package loginguard
+
+import (
+	"context"
+	"errors"
+	"ginx/internal/ratelimit"
+	limitmocks "ginx/internal/ratelimit/mocks"
+	"ginx/jwt"
+	limitkey "ginx/middlewares/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var lockoutRule = ratelimit.PenaltyRule{
+	Threshold: 1,
+	Window:    time.Minute,
+	BaseBan:   15 * time.Minute,
+	MaxBan:    24 * time.Hour,
+	Memory:    24 * time.Hour,
+}
+
+func newContext(t *testing.T) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	req, err := http.NewRequest(http.MethodPost, "/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "10.0.0.1:1234"
+	ctx.Request = req
+	return ctx
+}
+
+func TestGuard_Fail(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mock      func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter)
+		username  string
+		wantLock  time.Duration
+		wantDelay time.Duration
+		wantErr   error
+	}{
+		{
+			name: "第三次失败, 延迟",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				users := limitmocks.NewMockDecisionLimiter(ctrl)
+				users.EXPECT().Decide(gomock.Any(), "ginx:ratelimit:loginguard:{user:tom}").
+					Return(ratelimit.Decision{Allowed: true, Limit: 5, Remaining: 2}, nil)
+				ips := limitmocks.NewMockDecisionLimiter(ctrl)
+				ips.EXPECT().Decide(gomock.Any(), "ginx:ratelimit:loginguard:{ip:10.0.0.1}").
+					Return(ratelimit.Decision{Allowed: true, Limit: 100, Remaining: 99}, nil)
+				return users, ips
+			},
+			username:  "tom",
+			wantDelay: 400 * time.Millisecond,
+		},
+		{
+			name: "延迟不超过上限",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				users := limitmocks.NewMockDecisionLimiter(ctrl)
+				users.EXPECT().Decide(gomock.Any(), "ginx:ratelimit:loginguard:{user:tom}").
+					Return(ratelimit.Decision{Allowed: true, Limit: 100, Remaining: 1}, nil)
+				return users, nil
+			},
+			username:  "tom",
+			wantDelay: 2 * time.Second,
+		},
+		{
+			name: "限流器无法提供失败次数",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				ips := limitmocks.NewMockLimiter(ctrl)
+				ips.EXPECT().Limit(gomock.Any(), "ginx:ratelimit:loginguard:{ip:10.0.0.1}").Return(false, nil)
+				return nil, ips
+			},
+			username:  "tom",
+			wantDelay: 100 * time.Millisecond,
+		},
+		{
+			name: "用户名失败次数用完, 锁定",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				users := limitmocks.NewMockDecisionLimiter(ctrl)
+				users.EXPECT().Decide(gomock.Any(), "ginx:ratelimit:loginguard:{user:tom}").
+					Return(ratelimit.Decision{Limit: 5}, nil)
+				ips := limitmocks.NewMockDecisionLimiter(ctrl)
+				ips.EXPECT().Decide(gomock.Any(), "ginx:ratelimit:loginguard:{ip:10.0.0.1}").
+					Return(ratelimit.Decision{Allowed: true, Limit: 100, Remaining: 90}, nil)
+				return users, ips
+			},
+			username: "tom",
+			wantLock: 15 * time.Minute,
+		},
+		{
+			name: "没有用户名只统计 IP",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				users := limitmocks.NewMockDecisionLimiter(ctrl)
+				ips := limitmocks.NewMockDecisionLimiter(ctrl)
+				ips.EXPECT().Decide(gomock.Any(), "ginx:ratelimit:loginguard:{ip:10.0.0.1}").
+					Return(ratelimit.Decision{Limit: 100}, nil)
+				return users, ips
+			},
+			wantLock: 15 * time.Minute,
+		},
+		{
+			name: "限流器出错",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				users := limitmocks.NewMockDecisionLimiter(ctrl)
+				users.EXPECT().Decide(gomock.Any(), "ginx:ratelimit:loginguard:{user:tom}").
+					Return(ratelimit.Decision{}, errors.New("mock error"))
+				return users, nil
+			},
+			username: "tom",
+			wantErr:  errors.New("mock error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			users, ips := tc.mock(ctrl)
+			var delay time.Duration
+			g := NewGuard(users, ips, ratelimit.NewLocalPenaltyBox(lockoutRule)).
+				SetDelay(100*time.Millisecond, 2*time.Second)
+			g.sleepFunc = func(ctx context.Context, d time.Duration) {
+				delay = d
+			}
+			lock, err := g.Fail(newContext(t), tc.username)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantLock, lock)
+			assert.Equal(t, tc.wantDelay, delay)
+		})
+	}
+}
+
+func TestGuard_Check(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := limitmocks.NewMockDecisionLimiter(ctrl)
+	users.EXPECT().Decide(gomock.Any(), "ginx:ratelimit:loginguard:{user:tom}").
+		Return(ratelimit.Decision{Limit: 5}, nil)
+	ips := limitmocks.NewMockDecisionLimiter(ctrl)
+	ips.EXPECT().Decide(gomock.Any(), "ginx:ratelimit:loginguard:{ip:10.0.0.1}").
+		Return(ratelimit.Decision{Allowed: true, Limit: 100, Remaining: 90}, nil)
+	var g jwt.LoginGuard = NewGuard(users, ips, ratelimit.NewLocalPenaltyBox(lockoutRule))
+
+	ctx := newContext(t)
+	_, err := g.Fail(ctx, "tom")
+	require.NoError(t, err)
+
+	lock, err := g.Check(ctx, "tom")
+	require.NoError(t, err)
+	assert.InDelta(t, 15*time.Minute, lock, float64(time.Second))
+	// 只锁定用户名, 同一个 IP 的其他用户不受影响
+	lock, err = g.Check(ctx, "jerry")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), lock)
+}
+
+func TestGuard_Succeed(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter)
+		// 成功之前失败的次数
+		failures  int
+		wantDelay time.Duration
+	}{
+		{
+			name: "清零用户名的失败次数",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				return ratelimit.NewLocalSlidingWindowLimiter(time.Minute, 5), nil
+			},
+			failures:  2,
+			wantDelay: 100 * time.Millisecond,
+		},
+		{
+			name: "不清零 IP 的失败次数",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				return nil, ratelimit.NewLocalSlidingWindowLimiter(time.Minute, 5)
+			},
+			failures:  2,
+			wantDelay: 400 * time.Millisecond,
+		},
+		{
+			name: "限流器不支持清零",
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				users := limitmocks.NewMockDecisionLimiter(ctrl)
+				users.EXPECT().Decide(gomock.Any(), "ginx:ratelimit:loginguard:{user:tom}").
+					Return(ratelimit.Decision{Allowed: true, Limit: 5, Remaining: 2}, nil)
+				return users, nil
+			},
+			wantDelay: 400 * time.Millisecond,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			users, ips := tc.mock(ctrl)
+			var delay time.Duration
+			g := NewGuard(users, ips, ratelimit.NewLocalPenaltyBox(lockoutRule)).
+				SetDelay(100*time.Millisecond, 2*time.Second)
+			g.sleepFunc = func(ctx context.Context, d time.Duration) {
+				delay = d
+			}
+			ctx := newContext(t)
+			for i := 0; i < tc.failures; i++ {
+				_, err := g.Fail(ctx, "tom")
+				require.NoError(t, err)
+			}
+			require.NoError(t, g.Succeed(ctx, "tom"))
+			_, err := g.Fail(ctx, "tom")
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantDelay, delay)
+		})
+	}
+}
+
+func TestNewGuard(t *testing.T) {
+	assert.PanicsWithValue(t, "loginguard: lockout 不能为 nil", func() {
+		NewGuard(nil, nil, nil)
+	})
+}
+
+func TestGuard_SetKeyBuilder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := limitmocks.NewMockDecisionLimiter(ctrl)
+	users.EXPECT().Decide(gomock.Any(), "app:login:v2:{user:tom}").
+		Return(ratelimit.Decision{Allowed: true}, nil)
+	ips := limitmocks.NewMockDecisionLimiter(ctrl)
+	ips.EXPECT().Decide(gomock.Any(), "app:login:v2:{ip:10.0.0.1}").
+		Return(ratelimit.Decision{Allowed: true}, nil)
+	g := NewGuard(users, ips, ratelimit.NewLocalPenaltyBox(lockoutRule)).
+		SetKeyBuilder(limitkey.NewKeyBuilder("login").SetPrefix("app").SetVersion(2))
+	_, err := g.Fail(newContext(t), "tom")
+	require.NoError(t, err)
+}
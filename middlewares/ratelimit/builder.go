@@ -1,37 +1,61 @@
 package ratelimit
 
 import (
+	"errors"
+	"ginx/clientip"
+	"ginx/degrade"
 	"ginx/internal/ratelimit"
+	"ginx/logger"
 	"github.com/gin-gonic/gin"
-	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	// 参考 IETF draft-ietf-httpapi-ratelimit-headers
+	headerRateLimitLimit     = "RateLimit-Limit"
+	headerRateLimitRemaining = "RateLimit-Remaining"
+	headerRateLimitReset     = "RateLimit-Reset"
+	headerRetryAfter         = "Retry-After"
 )
 
 type Builder struct {
-	limiter ratelimit.Limiter
-	// genKeyFn 默认使用 IP 限流
+	limiter ratelimit.WeightedLimiter
+	// genKeyFn 默认使用 clientip.Default 解析的 IP 限流, 参考 SetClientIPResolver
 	genKeyFn func(ctx *gin.Context) string
-	// logFn 默认使用 log.Println()
-	logFn func(msg any, args ...any)
+	// keyBuilder 不为 nil 时使用 genKeyFn 的结果作为限流对象生成 key
+	keyBuilder *KeyBuilder
+	// costFn 默认每个请求占用 1 个配额
+	costFn func(ctx *gin.Context) int64
+	// l 默认使用 slog.Default()
+	l logger.Logger
+	// failPolicy 限流器出错时的处理策略, 默认 degrade.FailClosed
+	failPolicy degrade.Policy
+	// fallback 使用 degrade.Fallback 策略时的本地限流器
+	fallback ratelimit.WeightedLimiter
+	// breaker 为 nil 时每个请求都会访问限流器
+	breaker *degrade.Breaker
+	// overrides 不为 nil 时先查询限流对象的白名单, 黑名单和自定义频率
+	overrides *OverrideStore
+	// penaltyBox 不为 nil 时频繁触发限流的限流对象会被临时封禁
+	penaltyBox ratelimit.PenaltyBox
 }
 
+// NewBuilder 创建限流中间件.
+// limiter 实现了 ratelimit.DecisionLimiter 时,
+// 会在响应中设置 RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset 和 Retry-After 响应头.
+// 默认按照 clientip.Default 解析的客户端 IP 限流, 部署在代理之后时需要通过
+// clientip.SetDefault 或者 SetClientIPResolver 设置可信代理.
 func NewBuilder(limiter ratelimit.Limiter) *Builder {
 	return &Builder{
-		limiter: limiter,
-		genKeyFn: func(ctx *gin.Context) string {
-			var b strings.Builder
-			b.WriteString("ip-limiter")
-			b.WriteString(":")
-			b.WriteString(ctx.ClientIP())
-			return b.String()
-		},
-		logFn: func(msg any, args ...any) {
-			v := make([]any, 0, len(args)-1)
-			v = append(v, msg)
-			v = append(v, args...)
-			log.Println(v...)
+		limiter:  ratelimit.AsWeightedLimiter(limiter),
+		genKeyFn: ipKeyFunc(clientip.Key),
+		costFn: func(ctx *gin.Context) int64 {
+			return 1
 		},
+		l: logger.NewSlogLogger(nil),
 	}
 }
 
@@ -40,20 +64,136 @@ func (b *Builder) SetKeyGenFunc(fn func(ctx *gin.Context) string) *Builder {
 	return b
 }
 
+// SetClientIPResolver 按照 resolver 解析的客户端 IP 限流, IPv6 按照网段聚合.
+// 会覆盖 SetKeyGenFunc 的设置.
+func (b *Builder) SetClientIPResolver(resolver *clientip.Resolver) *Builder {
+	b.genKeyFn = ipKeyFunc(resolver.Key)
+	return b
+}
+
+func ipKeyFunc(keyFn func(ctx *gin.Context) string) func(ctx *gin.Context) string {
+	return func(ctx *gin.Context) string {
+		var b strings.Builder
+		b.WriteString("ip-limiter")
+		b.WriteString(":")
+		b.WriteString(keyFn(ctx))
+		return b.String()
+	}
+}
+
+// SetKeyBuilder 给 genKeyFn 生成的 key 加上前缀, 命名空间, 版本和 hash tag,
+// 使用 Redis Cluster 时必须设置.
+func (b *Builder) SetKeyBuilder(kb *KeyBuilder) *Builder {
+	b.keyBuilder = kb
+	return b
+}
+
+// SetCostFunc 设置每个请求占用的配额, 例如 CostByRoute.
+// 返回值小于等于 0 时不限流.
+// 占用多个配额需要 limiter 实现 ratelimit.WeightedLimiter, 否则会返回 500.
+func (b *Builder) SetCostFunc(fn func(ctx *gin.Context) int64) *Builder {
+	b.costFn = fn
+	return b
+}
+
+func (b *Builder) SetLogger(l logger.Logger) *Builder {
+	b.l = l
+	return b
+}
+
+// Deprecated: 使用 SetLogger.
 func (b *Builder) SetLogFunc(fn func(msg any, args ...any)) *Builder {
-	b.logFn = fn
+	return b.SetLogger(logger.NewFuncLogger(fn))
+}
+
+// SetFailPolicy 设置限流器(一般是 Redis)出错或者熔断时的处理策略.
+// 使用 degrade.Fallback 时需要通过 SetFallback 设置本地限流器.
+func (b *Builder) SetFailPolicy(policy degrade.Policy) *Builder {
+	b.failPolicy = policy
+	return b
+}
+
+// SetFallback 限流器出错或者熔断时降级到 fallback,
+// 一般是配额按照实例数缩小的本地限流器, 例如 NewLocalSlidingWindowLimiter(time.Second, rate/实例数).
+func (b *Builder) SetFallback(fallback ratelimit.Limiter) *Builder {
+	b.failPolicy = degrade.Fallback
+	b.fallback = ratelimit.AsWeightedLimiter(fallback)
+	return b
+}
+
+// SetBreaker 设置熔断器, 熔断期间不访问限流器, 直接按照 failPolicy 处理.
+func (b *Builder) SetBreaker(breaker *degrade.Breaker) *Builder {
+	b.breaker = breaker
+	return b
+}
+
+// SetOverrides 使用 Redis 中的动态配置, 白名单中的限流对象不限流,
+// 黑名单中的限流对象返回 403, 设置了自定义频率的限流对象使用对应的限流器.
+// 查询动态配置失败时按照没有动态配置处理.
+// 设置了 SetBreaker 时本地缓存之外的查询也经过熔断器, 熔断期间不访问 Redis, 按照没有动态配置处理.
+func (b *Builder) SetOverrides(store *OverrideStore) *Builder {
+	b.overrides = store
+	return b
+}
+
+// SetPenaltyBox 限流对象频繁触发限流之后临时封禁, 封禁时长逐次翻倍, 例如
+// NewRedisPenaltyBox(cmd, PenaltyRule{Threshold: 10, Window: time.Minute, BaseBan: time.Minute, MaxBan: time.Hour, Memory: time.Hour}).
+// 封禁期间不访问限流器, 直接返回 429 和剩余的封禁时长.
+// 访问 penaltyBox 出错或者熔断时按照没有封禁处理.
+func (b *Builder) SetPenaltyBox(box ratelimit.PenaltyBox) *Builder {
+	b.penaltyBox = box
 	return b
 }
 
 func (b *Builder) Build() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		isLimited, err := b.limit(ctx)
+		obj := b.genKeyFn(ctx)
+		key := b.buildKey(obj)
+		// 使用自定义频率时也按照同一个 key 封禁, 避免通过动态配置绕过封禁
+		banKey := key
+		limiter := b.limiter
+		if b.overrides != nil {
+			o, err := b.override(ctx, obj)
+			now := b.overrides.nowFunc()
+			switch {
+			case err != nil:
+				b.l.Warn("查询限流动态配置失败",
+					logger.String("key", obj),
+					logger.Error(err))
+			case o.Allowed:
+				ctx.Next()
+				return
+			case o.Blocked(now):
+				ctx.Header(headerRetryAfter, ratelimit.Seconds(o.BlockedUntil.Sub(now)))
+				b.l.Debug("限流对象在黑名单中",
+					logger.String("key", obj),
+					logger.String("path", ctx.Request.URL.Path))
+				ctx.AbortWithStatus(http.StatusForbidden)
+				return
+			case o.Rate != nil:
+				// 和默认限流器的算法可能不同, 使用不同的 key
+				limiter = b.overrides.limiter(*o.Rate)
+				key += ":override"
+			}
+		}
+		if b.banned(ctx, banKey) {
+			return
+		}
+		d, err := b.limit(ctx, limiter, key)
 		if err != nil {
-			b.logFn(err)
+			b.l.Error("限流器出错",
+				logger.String("key", key),
+				logger.Error(err))
 			ctx.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
-		if isLimited {
+		setHeaders(ctx, d)
+		if !d.Allowed {
+			b.l.Debug("触发限流",
+				logger.String("key", key),
+				logger.String("rule", d.Rule),
+				logger.String("path", ctx.Request.URL.Path))
+			b.violate(ctx, banKey)
 			ctx.AbortWithStatus(http.StatusTooManyRequests)
 			return
 		}
@@ -61,6 +201,162 @@ func (b *Builder) Build() gin.HandlerFunc {
 	}
 }
 
-func (b *Builder) limit(ctx *gin.Context) (bool, error) {
-	return b.limiter.Limit(ctx, b.genKeyFn(ctx))
+// override 查询动态配置, 本地缓存没有命中时和限流器共用熔断器
+func (b *Builder) override(ctx *gin.Context, obj string) (Override, error) {
+	if o, ok := b.overrides.cached(obj, b.overrides.nowFunc()); ok {
+		return o, nil
+	}
+	var o Override
+	err := b.withBreaker(func() (err error) {
+		o, err = b.overrides.Get(ctx, obj)
+		return err
+	})
+	return o, err
+}
+
+// withBreaker 经过熔断器执行 fn, 熔断期间返回 degrade.ErrBreakerOpen
+func (b *Builder) withBreaker(fn func() error) error {
+	if b.breaker == nil {
+		return fn()
+	}
+	if !b.breaker.Allow() {
+		return degrade.ErrBreakerOpen
+	}
+	if err := fn(); err != nil {
+		b.breaker.Failure()
+		return err
+	}
+	b.breaker.Success()
+	return nil
+}
+
+// banned 限流对象被封禁时直接返回 429
+func (b *Builder) banned(ctx *gin.Context, key string) bool {
+	if b.penaltyBox == nil {
+		return false
+	}
+	var ban time.Duration
+	err := b.withBreaker(func() (err error) {
+		ban, err = b.penaltyBox.Banned(ctx, key)
+		return err
+	})
+	if err != nil {
+		b.l.Warn("查询封禁状态失败",
+			logger.String("key", key),
+			logger.Error(err))
+		return false
+	}
+	if ban <= 0 {
+		return false
+	}
+	ctx.Header(headerRetryAfter, ratelimit.Seconds(ban))
+	ctx.AbortWithStatus(http.StatusTooManyRequests)
+	return true
+}
+
+// violate 记录一次触发限流, 因此被封禁时 Retry-After 改为封禁时长
+func (b *Builder) violate(ctx *gin.Context, key string) {
+	if b.penaltyBox == nil {
+		return
+	}
+	var ban time.Duration
+	err := b.withBreaker(func() (err error) {
+		ban, err = b.penaltyBox.Violate(ctx, key)
+		return err
+	})
+	if err != nil {
+		b.l.Warn("记录触发限流失败",
+			logger.String("key", key),
+			logger.Error(err))
+		return
+	}
+	if ban > 0 {
+		b.l.Info("频繁触发限流, 临时封禁",
+			logger.String("key", key),
+			logger.String("ban", ban.String()))
+		ctx.Header(headerRetryAfter, ratelimit.Seconds(ban))
+	}
+}
+
+// buildKey 根据限流对象生成 key
+func (b *Builder) buildKey(key string) string {
+	if b.keyBuilder != nil {
+		return b.keyBuilder.Build(key)
+	}
+	return key
+}
+
+func (b *Builder) limit(ctx *gin.Context, limiter ratelimit.WeightedLimiter,
+	key string) (ratelimit.Decision, error) {
+	cost := b.costFn(ctx)
+	if cost <= 0 {
+		return ratelimit.Decision{Allowed: true}, nil
+	}
+	if b.breaker != nil && !b.breaker.Allow() {
+		return b.degrade(ctx, key, cost, degrade.ErrBreakerOpen)
+	}
+	d, err := limiter.DecideN(ctx, key, cost)
+	if errors.Is(err, ratelimit.ErrCostExceedsCapacity) {
+		// 限流器本身没有问题, 这个请求永远不会被放行, 不能降级
+		if b.breaker != nil {
+			b.breaker.Success()
+		}
+		return ratelimit.Decision{}, nil
+	}
+	if err != nil {
+		if b.breaker != nil {
+			b.breaker.Failure()
+		}
+		return b.degrade(ctx, key, cost, err)
+	}
+	if b.breaker != nil {
+		b.breaker.Success()
+	}
+	return d, nil
+}
+
+// degrade 按照 failPolicy 处理限流器的错误
+func (b *Builder) degrade(ctx *gin.Context, key string, cost int64, err error) (ratelimit.Decision, error) {
+	switch b.failPolicy {
+	case degrade.FailOpen:
+		b.l.Warn("限流器不可用, 直接放行",
+			logger.String("key", key),
+			logger.Error(err))
+		return ratelimit.Decision{Allowed: true}, nil
+	case degrade.Fallback:
+		if b.fallback == nil {
+			return ratelimit.Decision{}, err
+		}
+		b.l.Warn("限流器不可用, 降级到本地限流",
+			logger.String("key", key),
+			logger.Error(err))
+		return b.fallback.DecideN(ctx, key, cost)
+	default:
+		return ratelimit.Decision{}, err
+	}
+}
+
+// CostByRoute 按照路由(ctx.FullPath())设置每个请求占用的配额,
+// 不在 costs 中的路由占用 defaultCost 个配额.
+func CostByRoute(costs map[string]int64, defaultCost int64) func(ctx *gin.Context) int64 {
+	return func(ctx *gin.Context) int64 {
+		if cost, ok := costs[ctx.FullPath()]; ok {
+			return cost
+		}
+		return defaultCost
+	}
+}
+
+// setHeaders 设置限流相关的响应头
+func setHeaders(ctx *gin.Context, d ratelimit.Decision) {
+	// 限流器无法提供详细信息
+	if d.Limit <= 0 {
+		return
+	}
+	ctx.Header(headerRateLimitLimit, strconv.FormatInt(d.Limit, 10))
+	ctx.Header(headerRateLimitRemaining, strconv.FormatInt(d.Remaining, 10))
+	ctx.Header(headerRateLimitReset, ratelimit.Seconds(d.ResetAfter))
+	if !d.Allowed && d.RetryAfter > 0 {
+		ctx.Header(headerRetryAfter, ratelimit.Seconds(d.RetryAfter))
+	}
 }
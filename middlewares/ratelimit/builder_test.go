@@ -2,6 +2,8 @@ package ratelimit
 
 import (
 	"errors"
+	"ginx/clientip"
+	"ginx/degrade"
 	"ginx/internal/ratelimit"
 	limitmocks "ginx/internal/ratelimit/mocks"
 	"github.com/gin-gonic/gin"
@@ -10,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestBuilder_SetKeyGenFunc(t *testing.T) {
@@ -18,7 +21,11 @@ func TestBuilder_SetKeyGenFunc(t *testing.T) {
 		name       string
 		reqBuilder func(t *testing.T) *http.Request
 		fn         func(ctx *gin.Context) string
-		want       string
+		kb         *KeyBuilder
+		resolver   func(t *testing.T) *clientip.Resolver
+		// 全局的 Resolver
+		defaultResolver func(t *testing.T) *clientip.Resolver
+		want            string
 	}{
 		{
 			name: "设置key成功！",
@@ -47,20 +54,97 @@ func TestBuilder_SetKeyGenFunc(t *testing.T) {
 			},
 			want: "ip-limiter:127.0.0.1",
 		},
+		{
+			name: "使用 KeyBuilder",
+			reqBuilder: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, "", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.RemoteAddr = "127.0.0.1:80"
+				return req
+			},
+			kb:   NewKeyBuilder("api").SetVersion(1),
+			want: "ginx:ratelimit:api:v1:{ip-limiter:127.0.0.1}",
+		},
+		{
+			name: "默认不信任 X-Forwarded-For",
+			reqBuilder: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, "", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.RemoteAddr = "127.0.0.1:80"
+				req.Header.Set("X-Forwarded-For", "1.1.1.1")
+				return req
+			},
+			want: "ip-limiter:127.0.0.1",
+		},
+		{
+			name: "可信代理, IPv6 按照网段聚合",
+			reqBuilder: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, "", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.RemoteAddr = "127.0.0.1:80"
+				req.Header.Set("X-Forwarded-For", "2001:db8:1:2:3::4")
+				return req
+			},
+			resolver: func(t *testing.T) *clientip.Resolver {
+				r, err := clientip.NewResolver("127.0.0.1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return r
+			},
+			want: "ip-limiter:2001:db8:1:2::/64",
+		},
+		{
+			name: "使用全局的 Resolver",
+			reqBuilder: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, "", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.RemoteAddr = "127.0.0.1:80"
+				req.Header.Set("X-Forwarded-For", "1.1.1.1")
+				return req
+			},
+			defaultResolver: func(t *testing.T) *clientip.Resolver {
+				r, err := clientip.NewResolver("127.0.0.1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return r
+			},
+			want: "ip-limiter:1.1.1.1",
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
+			if tc.defaultResolver != nil {
+				old := clientip.Default()
+				clientip.SetDefault(tc.defaultResolver(t))
+				defer clientip.SetDefault(old)
+			}
 			b := NewBuilder(nil)
 			if tc.fn != nil {
 				b.SetKeyGenFunc(tc.fn)
 			}
+			if tc.kb != nil {
+				b.SetKeyBuilder(tc.kb)
+			}
+			if tc.resolver != nil {
+				b.SetClientIPResolver(tc.resolver(t))
+			}
 
 			resp := httptest.NewRecorder()
 			ctx, _ := gin.CreateTestContext(resp)
 			req := tc.reqBuilder(t)
 			ctx.Request = req
 
-			assert.Equal(t, tc.want, b.genKeyFn(ctx))
+			assert.Equal(t, tc.want, b.buildKey(b.genKeyFn(ctx)))
 		})
 	}
 }
@@ -72,6 +156,7 @@ func TestBuilder_Build(t *testing.T) {
 		mock       func(ctrl *gomock.Controller) ratelimit.Limiter
 		reqBuilder func(t *testing.T) *http.Request
 		wantCode   int
+		wantHeader http.Header
 	}{
 		{
 			name: "不限流",
@@ -124,6 +209,62 @@ func TestBuilder_Build(t *testing.T) {
 			},
 			wantCode: http.StatusInternalServerError,
 		},
+		{
+			name: "不限流并返回剩余配额",
+			mock: func(ctrl *gomock.Controller) ratelimit.Limiter {
+				limiter := limitmocks.NewMockDecisionLimiter(ctrl)
+				limiter.EXPECT().Decide(gomock.Any(), gomock.Any()).
+					Return(ratelimit.Decision{
+						Allowed:    true,
+						Limit:      10,
+						Remaining:  9,
+						ResetAfter: 1500 * time.Millisecond,
+					}, nil)
+				return limiter
+			},
+			reqBuilder: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, limitURL, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return req
+			},
+			wantCode: http.StatusOK,
+			wantHeader: http.Header{
+				"Ratelimit-Limit":     []string{"10"},
+				"Ratelimit-Remaining": []string{"9"},
+				"Ratelimit-Reset":     []string{"2"},
+			},
+		},
+		{
+			name: "限流并返回重试时间",
+			mock: func(ctrl *gomock.Controller) ratelimit.Limiter {
+				limiter := limitmocks.NewMockDecisionLimiter(ctrl)
+				limiter.EXPECT().Decide(gomock.Any(), gomock.Any()).
+					Return(ratelimit.Decision{
+						Allowed:    false,
+						Limit:      10,
+						Remaining:  0,
+						ResetAfter: 10 * time.Second,
+						RetryAfter: 200 * time.Millisecond,
+					}, nil)
+				return limiter
+			},
+			reqBuilder: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, limitURL, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return req
+			},
+			wantCode: http.StatusTooManyRequests,
+			wantHeader: http.Header{
+				"Ratelimit-Limit":     []string{"10"},
+				"Ratelimit-Remaining": []string{"0"},
+				"Ratelimit-Reset":     []string{"10"},
+				"Retry-After":         []string{"1"},
+			},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -140,6 +281,262 @@ func TestBuilder_Build(t *testing.T) {
 			server.ServeHTTP(resp, req)
 
 			assert.Equal(t, tc.wantCode, resp.Code)
+			for _, h := range []string{headerRateLimitLimit, headerRateLimitRemaining,
+				headerRateLimitReset, headerRetryAfter} {
+				assert.Equal(t, tc.wantHeader.Get(h), resp.Header().Get(h))
+			}
+		})
+	}
+}
+
+func TestBuilder_Build_LocalLimiter(t *testing.T) {
+	const limitURL = "/limit"
+	testCases := []struct {
+		name    string
+		limiter ratelimit.Limiter
+		// 按顺序发起请求的 IP
+		ips       []string
+		wantCodes []int
+	}{
+		{
+			name:      "滑动窗口按 IP 限流",
+			limiter:   NewLocalSlidingWindowLimiter(time.Minute, 1),
+			ips:       []string{"127.0.0.1", "127.0.0.1", "127.0.0.2"},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name:      "令牌桶按 IP 限流",
+			limiter:   NewLocalTokenBucketLimiter(time.Minute, 1, 2),
+			ips:       []string{"127.0.0.1", "127.0.0.1", "127.0.0.1", "127.0.0.2"},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewBuilder(tc.limiter)
+			server := gin.Default()
+			server.Use(svc.Build())
+			svc.RegisterRoutes(server)
+
+			codes := make([]int, 0, len(tc.ips))
+			for _, ip := range tc.ips {
+				req, err := http.NewRequest(http.MethodGet, limitURL, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.RemoteAddr = ip + ":80"
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				codes = append(codes, resp.Code)
+			}
+			assert.Equal(t, tc.wantCodes, codes)
+		})
+	}
+}
+
+func TestBuilder_SetCostFunc(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+	}
+	testCases := []struct {
+		name      string
+		builder   func(ctrl *gomock.Controller) *Builder
+		reqs      []request
+		wantCodes []int
+	}{
+		{
+			name: "按路由占用配额",
+			builder: func(ctrl *gomock.Controller) *Builder {
+				return NewBuilder(NewLocalSlidingWindowLimiter(time.Minute, 10)).
+					SetCostFunc(CostByRoute(map[string]int64{
+						"/export": 6,
+						"/health": 0,
+					}, 1))
+			},
+			reqs: []request{
+				{method: http.MethodGet, path: "/export"},
+				{method: http.MethodGet, path: "/limit"},
+				{method: http.MethodGet, path: "/export"},
+				{method: http.MethodGet, path: "/limit"},
+				// 不占用配额
+				{method: http.MethodGet, path: "/health"},
+			},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests,
+				http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "传递配额",
+			builder: func(ctrl *gomock.Controller) *Builder {
+				limiter := limitmocks.NewMockWeightedLimiter(ctrl)
+				limiter.EXPECT().DecideN(gomock.Any(), gomock.Any(), int64(5)).
+					Return(ratelimit.Decision{Allowed: true}, nil)
+				return NewBuilder(limiter).SetCostFunc(func(ctx *gin.Context) int64 {
+					return 5
+				})
+			},
+			reqs:      []request{{method: http.MethodGet, path: "/limit"}},
+			wantCodes: []int{http.StatusOK},
+		},
+		{
+			name: "限流器不支持权重",
+			builder: func(ctrl *gomock.Controller) *Builder {
+				return NewBuilder(limitmocks.NewMockLimiter(ctrl)).SetCostFunc(func(ctx *gin.Context) int64 {
+					return 5
+				})
+			},
+			reqs:      []request{{method: http.MethodGet, path: "/limit"}},
+			wantCodes: []int{http.StatusInternalServerError},
+		},
+		{
+			name: "超过令牌桶容量时直接限流, 不会降级",
+			builder: func(ctrl *gomock.Controller) *Builder {
+				return NewBuilder(NewLocalTokenBucketLimiter(time.Minute, 10, 10)).
+					SetCostFunc(CostByRoute(map[string]int64{"/export": 11}, 1)).
+					SetFailPolicy(degrade.FailOpen)
+			},
+			reqs: []request{
+				{method: http.MethodGet, path: "/export"},
+				{method: http.MethodGet, path: "/limit"},
+			},
+			wantCodes: []int{http.StatusTooManyRequests, http.StatusOK},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := tc.builder(ctrl)
+			server := gin.Default()
+			server.Use(svc.Build())
+			svc.RegisterRoutes(server)
+			server.GET("/export", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+			server.GET("/health", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			codes := make([]int, 0, len(tc.reqs))
+			for _, r := range tc.reqs {
+				req, err := http.NewRequest(r.method, r.path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				codes = append(codes, resp.Code)
+			}
+			assert.Equal(t, tc.wantCodes, codes)
+		})
+	}
+}
+
+func TestBuilder_SetFailPolicy(t *testing.T) {
+	const limitURL = "/limit"
+	testCases := []struct {
+		name    string
+		builder func(ctrl *gomock.Controller) *Builder
+		// 发起请求的次数
+		cnt       int
+		wantCodes []int
+	}{
+		{
+			name: "默认拒绝请求",
+			builder: func(ctrl *gomock.Controller) *Builder {
+				limiter := limitmocks.NewMockWeightedLimiter(ctrl)
+				limiter.EXPECT().DecideN(gomock.Any(), gomock.Any(), int64(1)).
+					Return(ratelimit.Decision{}, errors.New("模拟 Redis 错误"))
+				return NewBuilder(limiter)
+			},
+			cnt:       1,
+			wantCodes: []int{http.StatusInternalServerError},
+		},
+		{
+			name: "出错时放行",
+			builder: func(ctrl *gomock.Controller) *Builder {
+				limiter := limitmocks.NewMockWeightedLimiter(ctrl)
+				limiter.EXPECT().DecideN(gomock.Any(), gomock.Any(), int64(1)).
+					Return(ratelimit.Decision{}, errors.New("模拟 Redis 错误"))
+				return NewBuilder(limiter).SetFailPolicy(degrade.FailOpen)
+			},
+			cnt:       1,
+			wantCodes: []int{http.StatusOK},
+		},
+		{
+			name: "降级到本地限流",
+			builder: func(ctrl *gomock.Controller) *Builder {
+				limiter := limitmocks.NewMockWeightedLimiter(ctrl)
+				limiter.EXPECT().DecideN(gomock.Any(), gomock.Any(), int64(1)).
+					Return(ratelimit.Decision{}, errors.New("模拟 Redis 错误")).Times(3)
+				return NewBuilder(limiter).
+					SetFallback(NewLocalSlidingWindowLimiter(time.Minute, 2))
+			},
+			cnt:       3,
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "没有设置本地限流器",
+			builder: func(ctrl *gomock.Controller) *Builder {
+				limiter := limitmocks.NewMockWeightedLimiter(ctrl)
+				limiter.EXPECT().DecideN(gomock.Any(), gomock.Any(), int64(1)).
+					Return(ratelimit.Decision{}, errors.New("模拟 Redis 错误"))
+				return NewBuilder(limiter).SetFailPolicy(degrade.Fallback)
+			},
+			cnt:       1,
+			wantCodes: []int{http.StatusInternalServerError},
+		},
+		{
+			name: "熔断之后不再访问 Redis",
+			builder: func(ctrl *gomock.Controller) *Builder {
+				limiter := limitmocks.NewMockWeightedLimiter(ctrl)
+				limiter.EXPECT().DecideN(gomock.Any(), gomock.Any(), int64(1)).
+					Return(ratelimit.Decision{}, errors.New("模拟 Redis 错误")).Times(2)
+				return NewBuilder(limiter).
+					SetFallback(NewLocalSlidingWindowLimiter(time.Minute, 3)).
+					SetBreaker(degrade.NewBreaker(2, time.Minute))
+			},
+			cnt: 4,
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK,
+				http.StatusTooManyRequests},
+		},
+		{
+			name: "Redis 正常时不降级",
+			builder: func(ctrl *gomock.Controller) *Builder {
+				limiter := limitmocks.NewMockWeightedLimiter(ctrl)
+				limiter.EXPECT().DecideN(gomock.Any(), gomock.Any(), int64(1)).
+					Return(ratelimit.Decision{Allowed: false}, nil)
+				return NewBuilder(limiter).
+					SetFailPolicy(degrade.FailOpen).
+					SetBreaker(degrade.NewBreaker(1, time.Minute))
+			},
+			cnt:       1,
+			wantCodes: []int{http.StatusTooManyRequests},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := tc.builder(ctrl)
+			server := gin.Default()
+			server.Use(svc.Build())
+			svc.RegisterRoutes(server)
+
+			codes := make([]int, 0, tc.cnt)
+			for i := 0; i < tc.cnt; i++ {
+				req, err := http.NewRequest(http.MethodGet, limitURL, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.RemoteAddr = "127.0.0.1:80"
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				codes = append(codes, resp.Code)
+			}
+			assert.Equal(t, tc.wantCodes, codes)
 		})
 	}
 }
@@ -149,7 +546,7 @@ func TestBuilder_limit(t *testing.T) {
 		name       string
 		mock       func(ctrl *gomock.Controller) ratelimit.Limiter
 		reqBuilder func(t *testing.T) *http.Request
-		want       bool
+		want       ratelimit.Decision
 		wantErr    error
 	}{
 		{
@@ -168,7 +565,7 @@ func TestBuilder_limit(t *testing.T) {
 				req.RemoteAddr = "127.0.0.1:80"
 				return req
 			},
-			want: false,
+			want: ratelimit.Decision{Allowed: true},
 		},
 		{
 			name: "限流",
@@ -186,7 +583,7 @@ func TestBuilder_limit(t *testing.T) {
 				req.RemoteAddr = "127.0.0.1:80"
 				return req
 			},
-			want: true,
+			want: ratelimit.Decision{Allowed: false},
 		},
 		{
 			name: "限流代码出错",
@@ -204,7 +601,7 @@ func TestBuilder_limit(t *testing.T) {
 				req.RemoteAddr = "127.0.0.1:80"
 				return req
 			},
-			want:    false,
+			want:    ratelimit.Decision{},
 			wantErr: errors.New("模拟系统错误"),
 		},
 	}
@@ -220,7 +617,7 @@ func TestBuilder_limit(t *testing.T) {
 			req := tc.reqBuilder(t)
 			ctx.Request = req
 
-			got, err := b.limit(ctx)
+			got, err := b.limit(ctx, b.limiter, b.genKeyFn(ctx))
 			assert.Equal(t, tc.wantErr, err)
 			assert.Equal(t, tc.want, got)
 		})
@@ -0,0 +1,212 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 限流算法, 参考对应的 NewXXXLimiter
+const (
+	AlgorithmSlidingWindow        = "sliding_window"
+	AlgorithmSlidingWindowCounter = "sliding_window_counter"
+	AlgorithmFixedWindow          = "fixed_window"
+	AlgorithmTokenBucket          = "token_bucket"
+	// AlgorithmGCRA 只支持 Redis
+	AlgorithmGCRA = "gcra"
+)
+
+// 限流状态的存储
+const (
+	StoreLocal = "local"
+	StoreRedis = "redis"
+)
+
+// LimitConfig 所有限流规则的配置, 支持 YAML 和 JSON, 例如
+//
+//	rates:
+//	  - name: login
+//	    routes: ["/login"]
+//	    methods: ["POST"]
+//	    key: ip
+//	    store: redis
+//	    algorithm: sliding_window
+//	    interval: 1m
+//	    rate: 10
+//	concurrency:
+//	  - name: export
+//	    routes: ["/export"]
+//	    key: header:X-User-Id
+//	    max_active: 3
+type LimitConfig struct {
+	Rates       []RateConfig        `json:"rates" yaml:"rates"`
+	Concurrency []ConcurrencyConfig `json:"concurrency" yaml:"concurrency"`
+}
+
+// RateConfig 频率限制, 匹配的所有规则都没有触发限流时才会放行
+type RateConfig struct {
+	// 规则名称, 不能重复, 会作为限流 key 的前缀
+	Name string `json:"name" yaml:"name"`
+	// 匹配的路由和 HTTP 方法, 为空时匹配所有
+	Routes  []string `json:"routes" yaml:"routes"`
+	Methods []string `json:"methods" yaml:"methods"`
+	// 限流对象, 参考 ConfigManager.SetKeyFunc, 为空时使用 ip
+	Key string `json:"key" yaml:"key"`
+	// 为空时使用 local
+	Store string `json:"store" yaml:"store"`
+	// 为空时使用 sliding_window
+	Algorithm string   `json:"algorithm" yaml:"algorithm"`
+	Interval  Duration `json:"interval" yaml:"interval"`
+	Rate      int      `json:"rate" yaml:"rate"`
+	// 令牌桶的容量, 为空时等于 Rate;
+	// GCRA 允许的突发流量, 为空时为 1. 其他算法不使用
+	Capacity int `json:"capacity" yaml:"capacity"`
+}
+
+// ConcurrencyConfig 活跃请求数限制
+type ConcurrencyConfig struct {
+	// 规则名称, 不能重复
+	Name    string   `json:"name" yaml:"name"`
+	Routes  []string `json:"routes" yaml:"routes"`
+	Methods []string `json:"methods" yaml:"methods"`
+	// 限流对象, 为空时限制所有请求的活跃请求数
+	Key       string `json:"key" yaml:"key"`
+	Store     string `json:"store" yaml:"store"`
+	MaxActive int64  `json:"max_active" yaml:"max_active"`
+	// Redis 中租约的时长, 参考 redislimit.NewRedisKeyActiveLimit, 为空时使用 1 分钟
+	TTL Duration `json:"ttl" yaml:"ttl"`
+}
+
+// Duration 支持 "1m30s" 这种格式的时长
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.parse(node.Value)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) parse(s string) error {
+	val, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(val)
+	return nil
+}
+
+// ParseLimitConfig 解析配置, format 为 yaml 或者 json
+func ParseLimitConfig(data []byte, format string) (LimitConfig, error) {
+	var cfg LimitConfig
+	var err error
+	switch format {
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &cfg)
+	case "json":
+		err = json.Unmarshal(data, &cfg)
+	default:
+		return LimitConfig{}, fmt.Errorf("不支持的配置格式 %s", format)
+	}
+	if err != nil {
+		return LimitConfig{}, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// formatOf 根据文件的扩展名判断配置格式
+func formatOf(path string) string {
+	return strings.TrimPrefix(filepath.Ext(path), ".")
+}
+
+// Validate 检查配置并填充默认值
+func (c *LimitConfig) Validate() error {
+	names := make(map[string]struct{}, len(c.Rates)+len(c.Concurrency))
+	checkName := func(name string) error {
+		if name == "" {
+			return errors.New("规则名称不能为空")
+		}
+		if _, ok := names[name]; ok {
+			return fmt.Errorf("规则名称 %s 重复", name)
+		}
+		names[name] = struct{}{}
+		return nil
+	}
+	for i := range c.Rates {
+		r := &c.Rates[i]
+		if err := checkName(r.Name); err != nil {
+			return err
+		}
+		if r.Key == "" {
+			r.Key = "ip"
+		}
+		if r.Store == "" {
+			r.Store = StoreLocal
+		}
+		if r.Algorithm == "" {
+			r.Algorithm = AlgorithmSlidingWindow
+		}
+		if r.Capacity == 0 && r.Algorithm == AlgorithmTokenBucket {
+			r.Capacity = r.Rate
+		}
+		if r.Interval <= 0 || r.Rate <= 0 {
+			return fmt.Errorf("规则 %s 的 interval 和 rate 必须大于 0", r.Name)
+		}
+		if r.Algorithm == AlgorithmTokenBucket && r.Capacity <= 0 {
+			return fmt.Errorf("规则 %s 的 capacity 必须大于 0", r.Name)
+		}
+		if r.Store != StoreLocal && r.Store != StoreRedis {
+			return fmt.Errorf("规则 %s 的 store %s 不存在", r.Name, r.Store)
+		}
+		// Redis 中的窗口按照毫秒计算
+		if r.Store == StoreRedis && time.Duration(r.Interval) < time.Millisecond {
+			return fmt.Errorf("规则 %s 的 interval 不能小于 1ms", r.Name)
+		}
+		switch r.Algorithm {
+		case AlgorithmSlidingWindow, AlgorithmSlidingWindowCounter,
+			AlgorithmFixedWindow, AlgorithmTokenBucket:
+		case AlgorithmGCRA:
+			if r.Store != StoreRedis {
+				return fmt.Errorf("规则 %s 的 gcra 算法只支持 redis", r.Name)
+			}
+		default:
+			return fmt.Errorf("规则 %s 的算法 %s 不存在", r.Name, r.Algorithm)
+		}
+	}
+	for i := range c.Concurrency {
+		r := &c.Concurrency[i]
+		if err := checkName(r.Name); err != nil {
+			return err
+		}
+		if r.Store == "" {
+			r.Store = StoreLocal
+		}
+		if r.TTL == 0 {
+			r.TTL = Duration(time.Minute)
+		}
+		if r.MaxActive <= 0 {
+			return fmt.Errorf("规则 %s 的 max_active 必须大于 0", r.Name)
+		}
+		if r.Store != StoreLocal && r.Store != StoreRedis {
+			return fmt.Errorf("规则 %s 的 store %s 不存在", r.Name, r.Store)
+		}
+	}
+	return nil
+}
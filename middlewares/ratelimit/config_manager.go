@@ -0,0 +1,410 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ginx/clientip"
+	"ginx/internal/ratelimit"
+	"ginx/logger"
+	"ginx/middlewares/locallimit"
+	"ginx/middlewares/redislimit"
+	"github.com/ecodeclub/ekit/set"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/atomic"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigManager 根据 LimitConfig 限流, 配置可以在运行期间热更新.
+// 更新时整体替换所有规则, 正在处理的请求继续使用旧的规则.
+// 存储, 算法和窗口大小没有变化的频率限制复用原来的限流器, 只修改阈值和桶容量, 不会丢失窗口内的计数;
+// 修改存储, 算法或者窗口大小时创建新的限流器, 本地限流器的计数重新开始, redis 限流器的计数仍然保存在 redis 里.
+// 同名的活跃请求数限制复用原来的计数, 只修改最大活跃请求数, 正在处理的请求结束之后照常减少计数.
+type ConfigManager struct {
+	cmd    redis.Cmdable
+	keyFns map[string]func(ctx *gin.Context) string
+	// keyBuilder 生成 store 为 redis 的规则的 key, 规则名称和限流对象一起作为 hash tag
+	keyBuilder *KeyBuilder
+	// l 默认使用 slog.Default()
+	l logger.Logger
+
+	// mu 保证同一时间只有一个 Apply
+	mu    sync.Mutex
+	state *atomic.Pointer[configState]
+}
+
+type configState struct {
+	cfg         LimitConfig
+	rates       []*rateRule
+	concurrency []*concurrencyRule
+}
+
+type rateRule struct {
+	RateConfig
+	routes  set.Set[string]
+	methods set.Set[string]
+	keyFn   func(ctx *gin.Context) string
+	limiter ratelimit.WeightedLimiter
+}
+
+type concurrencyRule struct {
+	ConcurrencyConfig
+	routes  set.Set[string]
+	methods set.Set[string]
+	keyFn   func(ctx *gin.Context) string
+	// 根据 Store 二选一
+	local *locallimit.LocalKeyActiveLimit
+	redis *redislimit.RedisKeyActiveLimit
+}
+
+// NewConfigManager 创建之后需要调用 Apply 或者 Watch 设置配置, 在此之前不限流.
+func NewConfigManager() *ConfigManager {
+	return &ConfigManager{
+		keyFns: map[string]func(ctx *gin.Context) string{
+			"ip": clientip.Key,
+			"global": func(ctx *gin.Context) string {
+				return "global"
+			},
+		},
+		keyBuilder: NewKeyBuilder("config"),
+		l:          logger.NewSlogLogger(nil),
+		state:      atomic.NewPointer(&configState{}),
+	}
+}
+
+// SetRedis 规则的 store 为 redis 时使用
+func (m *ConfigManager) SetRedis(cmd redis.Cmdable) *ConfigManager {
+	m.cmd = cmd
+	return m
+}
+
+// SetKeyBuilder 设置 store 为 redis 的规则的 key 的前缀, 命名空间和版本,
+// 默认为 ginx:ratelimit:config:{<规则名称>:<限流对象>}.
+func (m *ConfigManager) SetKeyBuilder(kb *KeyBuilder) *ConfigManager {
+	m.keyBuilder = kb
+	return m
+}
+
+// SetKeyFunc 注册限流对象, 配置中的 key 使用 name 引用.
+// 内置了 ip(clientip.Key), global(所有请求共用一个 key) 和 header:<请求头>, 请求头为空时按照 ip 限流.
+func (m *ConfigManager) SetKeyFunc(name string, fn func(ctx *gin.Context) string) *ConfigManager {
+	m.keyFns[name] = fn
+	return m
+}
+
+func (m *ConfigManager) SetLogger(l logger.Logger) *ConfigManager {
+	m.l = l
+	return m
+}
+
+// Config 返回当前生效的配置
+func (m *ConfigManager) Config() LimitConfig {
+	return m.state.Load().cfg
+}
+
+// Apply 校验并且原子地替换配置, 出错时保留原来的配置.
+// 默认值填充在 cfg 的副本上, 不会修改调用方的切片.
+func (m *ConfigManager) Apply(cfg LimitConfig) error {
+	cfg.Rates = slices.Clone(cfg.Rates)
+	cfg.Concurrency = slices.Clone(cfg.Concurrency)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.state.Load()
+	// 所有规则都没有错误之后才修改复用的限流器
+	var updates []func()
+	st := &configState{
+		cfg:         cfg,
+		rates:       make([]*rateRule, 0, len(cfg.Rates)),
+		concurrency: make([]*concurrencyRule, 0, len(cfg.Concurrency)),
+	}
+	for _, c := range cfg.Rates {
+		r, update, err := m.rateRule(c, old)
+		if err != nil {
+			return err
+		}
+		st.rates = append(st.rates, r)
+		updates = append(updates, update)
+	}
+	for _, c := range cfg.Concurrency {
+		r, update, err := m.concurrencyRule(c, old)
+		if err != nil {
+			return err
+		}
+		st.concurrency = append(st.concurrency, r)
+		updates = append(updates, update)
+	}
+	for _, update := range updates {
+		update()
+	}
+	m.state.Store(st)
+	return nil
+}
+
+// Watch 读取配置之后在后台监听配置的变化, 直到 ctx 结束.
+// 第一次读取失败时返回错误, 之后的配置有错误时只记录日志, 继续使用原来的配置.
+func (m *ConfigManager) Watch(ctx context.Context, source ConfigSource) error {
+	cfg, err := source.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if err = m.Apply(cfg); err != nil {
+		return err
+	}
+	go source.Watch(ctx, func(cfg LimitConfig) {
+		if err := m.Apply(cfg); err != nil {
+			m.l.Error("更新限流配置失败", logger.Error(err))
+			return
+		}
+		m.l.Info("更新限流配置成功")
+	})
+	return nil
+}
+
+func (m *ConfigManager) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		st := m.state.Load()
+		for _, r := range st.rates {
+			if !r.match(ctx) {
+				continue
+			}
+			key := m.rateKey(r, r.keyFn(ctx))
+			d, err := r.limiter.Decide(ctx, key)
+			if err != nil {
+				m.l.Error("限流器出错",
+					logger.String("key", key),
+					logger.Error(err))
+				ctx.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			setHeaders(ctx, d)
+			if !d.Allowed {
+				m.l.Debug("触发限流",
+					logger.String("key", key),
+					logger.String("path", ctx.Request.URL.Path))
+				ctx.AbortWithStatus(http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		releases := make([]func(), 0, len(st.concurrency))
+		defer func() {
+			for i := len(releases) - 1; i >= 0; i-- {
+				releases[i]()
+			}
+		}()
+		for _, r := range st.concurrency {
+			if !r.match(ctx) {
+				continue
+			}
+			key := r.keyFn(ctx)
+			release, err := r.acquire(ctx, key)
+			if err != nil {
+				m.l.Error("增加活跃请求数失败",
+					logger.String("rule", r.Name),
+					logger.String("key", key),
+					logger.Error(err))
+				ctx.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			if release == nil {
+				m.l.Debug("触发限流",
+					logger.String("rule", r.Name),
+					logger.String("key", key),
+					logger.String("path", ctx.Request.URL.Path))
+				ctx.AbortWithStatus(http.StatusTooManyRequests)
+				return
+			}
+			releases = append(releases, release)
+		}
+		ctx.Next()
+	}
+}
+
+// rateRule 返回的 update 用来修改复用的限流器的参数
+func (m *ConfigManager) rateRule(c RateConfig, old *configState) (r *rateRule, update func(), err error) {
+	keyFn, err := m.keyFn(c.Key, "ip")
+	if err != nil {
+		return nil, nil, fmt.Errorf("规则 %s: %w", c.Name, err)
+	}
+	r = &rateRule{
+		RateConfig: c,
+		routes:     newSet(c.Routes),
+		methods:    newSet(c.Methods),
+		keyFn:      keyFn,
+	}
+	for _, o := range old.rates {
+		if o.Name != c.Name {
+			continue
+		}
+		if update, ok := o.reuse(c); ok {
+			r.limiter = o.limiter
+			return r, update, nil
+		}
+	}
+	limiter, err := m.newLimiter(c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("规则 %s: %w", c.Name, err)
+	}
+	r.limiter = ratelimit.AsWeightedLimiter(limiter)
+	return r, func() {}, nil
+}
+
+func (m *ConfigManager) newLimiter(c RateConfig) (ratelimit.Limiter, error) {
+	interval := time.Duration(c.Interval)
+	if c.Store == StoreLocal {
+		switch c.Algorithm {
+		case AlgorithmSlidingWindow:
+			return NewLocalSlidingWindowLimiter(interval, c.Rate), nil
+		case AlgorithmSlidingWindowCounter:
+			return NewLocalSlidingWindowCounterLimiter(interval, c.Rate), nil
+		case AlgorithmFixedWindow:
+			return NewLocalFixedWindowLimiter(interval, c.Rate), nil
+		case AlgorithmTokenBucket:
+			return NewLocalTokenBucketLimiter(interval, c.Rate, c.Capacity), nil
+		}
+		return nil, fmt.Errorf("本地不支持算法 %s", c.Algorithm)
+	}
+	if m.cmd == nil {
+		return nil, errors.New("使用 redis 之前需要调用 SetRedis")
+	}
+	switch c.Algorithm {
+	case AlgorithmSlidingWindow:
+		return NewRedisSlidingWindowLimiter(m.cmd, interval, c.Rate), nil
+	case AlgorithmSlidingWindowCounter:
+		return NewRedisSlidingWindowCounterLimiter(m.cmd, interval, c.Rate), nil
+	case AlgorithmFixedWindow:
+		return NewRedisFixedWindowLimiter(m.cmd, interval, c.Rate), nil
+	case AlgorithmTokenBucket:
+		return NewRedisTokenBucketLimiter(m.cmd, interval, c.Rate, c.Capacity), nil
+	case AlgorithmGCRA:
+		return NewRedisGCRALimiter(m.cmd, interval, c.Rate, c.Capacity), nil
+	}
+	return nil, fmt.Errorf("redis 不支持算法 %s", c.Algorithm)
+}
+
+// concurrencyRule 返回的 update 用来修改复用的计数的最大活跃请求数
+func (m *ConfigManager) concurrencyRule(c ConcurrencyConfig,
+	old *configState) (r *concurrencyRule, update func(), err error) {
+	keyFn, err := m.keyFn(c.Key, "global")
+	if err != nil {
+		return nil, nil, fmt.Errorf("规则 %s: %w", c.Name, err)
+	}
+	r = &concurrencyRule{
+		ConcurrencyConfig: c,
+		routes:            newSet(c.Routes),
+		methods:           newSet(c.Methods),
+		keyFn:             keyFn,
+	}
+	for _, o := range old.concurrency {
+		if o.Name != c.Name || o.Store != c.Store || o.TTL != c.TTL {
+			continue
+		}
+		// 复用原来的计数, 正在处理的请求结束之后减少的也是同一个计数
+		r.local, r.redis = o.local, o.redis
+		return r, func() {
+			if r.local != nil {
+				r.local.SetMaxActive(c.MaxActive)
+			} else {
+				r.redis.SetMaxActive(c.MaxActive)
+			}
+		}, nil
+	}
+	if c.Store == StoreLocal {
+		r.local = locallimit.NewLocalKeyActiveLimit(c.MaxActive).SetLogger(m.l)
+		return r, func() {}, nil
+	}
+	if m.cmd == nil {
+		return nil, nil, fmt.Errorf("规则 %s: 使用 redis 之前需要调用 SetRedis", c.Name)
+	}
+	kb := m.keyBuilder
+	r.redis = redislimit.NewRedisKeyActiveLimit(m.cmd, c.MaxActive, c.Name, time.Duration(c.TTL)).
+		SetRedisKeyFunc(func(key string) string {
+			return kb.Build(c.Name, key)
+		}).
+		SetLogger(m.l)
+	return r, func() {}, nil
+}
+
+// rateKey 频率限制的 key, redis 的 key 加上命名空间和 hash tag
+func (m *ConfigManager) rateKey(r *rateRule, key string) string {
+	if r.Store == StoreRedis {
+		return m.keyBuilder.Build(r.Name, key)
+	}
+	return r.Name + ":" + key
+}
+
+// keyFn 解析配置中的 key, 为空时使用 defaultKey
+func (m *ConfigManager) keyFn(key string, defaultKey string) (func(ctx *gin.Context) string, error) {
+	if key == "" {
+		key = defaultKey
+	}
+	if header, ok := strings.CutPrefix(key, "header:"); ok {
+		ipFn := m.keyFns["ip"]
+		return func(ctx *gin.Context) string {
+			if val := ctx.GetHeader(header); val != "" {
+				return val
+			}
+			// 没有请求头时按照 IP 限流, 避免所有请求共用一个空的 key
+			return "ip:" + ipFn(ctx)
+		}, nil
+	}
+	fn, ok := m.keyFns[key]
+	if !ok {
+		return nil, fmt.Errorf("限流对象 %s 不存在", key)
+	}
+	return fn, nil
+}
+
+func (r *rateRule) match(ctx *gin.Context) bool {
+	return matchSet(r.routes, ctx.FullPath()) && matchSet(r.methods, ctx.Request.Method)
+}
+
+// reuse 能否复用原来的限流器, 返回的 update 修改限流器的阈值和桶容量.
+// 只有本地限流器支持修改阈值和桶容量; redis 限流器参数不同时新建, 计数保存在 redis 里不受影响.
+func (r *rateRule) reuse(c RateConfig) (update func(), ok bool) {
+	if r.Store != c.Store || r.Algorithm != c.Algorithm || r.Interval != c.Interval {
+		return nil, false
+	}
+	if r.Rate == c.Rate && r.Capacity == c.Capacity {
+		return func() {}, true
+	}
+	rs, ok := r.limiter.(ratelimit.RateSetter)
+	if !ok {
+		return nil, false
+	}
+	cs, ok := r.limiter.(ratelimit.CapacitySetter)
+	if !ok && r.Capacity != c.Capacity {
+		return nil, false
+	}
+	return func() {
+		if cs != nil {
+			cs.SetCapacity(c.Capacity)
+		}
+		rs.SetRate(c.Rate)
+	}, true
+}
+
+func (r *concurrencyRule) match(ctx *gin.Context) bool {
+	return matchSet(r.routes, ctx.FullPath()) && matchSet(r.methods, ctx.Request.Method)
+}
+
+// acquire 触发限流时返回的 release 为 nil
+func (r *concurrencyRule) acquire(ctx context.Context, key string) (release func(), err error) {
+	if r.local != nil {
+		if !r.local.Acquire(key) {
+			return nil, nil
+		}
+		return func() {
+			r.local.Release(key)
+		}, nil
+	}
+	return r.redis.Acquire(ctx, key)
+}
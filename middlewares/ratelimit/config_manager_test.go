@@ -0,0 +1,338 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"ginx/middlewares/redislimit/redismocks"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfigManager_Build(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	type request struct {
+		path string
+		uid  string
+		ip   string
+	}
+	loginRule := RateConfig{
+		Name:     "login",
+		Routes:   []string{"/login"},
+		Interval: Duration(time.Minute),
+		Rate:     2,
+	}
+	testCases := []struct {
+		name      string
+		cfg       LimitConfig
+		reqs      []request
+		wantCodes []int
+	}{
+		{
+			name:      "没有配置不限流",
+			reqs:      []request{{path: "/login"}, {path: "/login"}, {path: "/login"}},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			name:      "只限制匹配的路由",
+			cfg:       LimitConfig{Rates: []RateConfig{loginRule}},
+			reqs:      []request{{path: "/login"}, {path: "/login"}, {path: "/profile"}, {path: "/login"}},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "匹配的所有规则都要满足",
+			cfg: LimitConfig{Rates: []RateConfig{
+				loginRule,
+				{Name: "global", Key: "global", Interval: Duration(time.Minute), Rate: 3},
+			}},
+			reqs:      []request{{path: "/profile"}, {path: "/login"}, {path: "/profile"}, {path: "/profile"}},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "使用注册的限流对象",
+			cfg: LimitConfig{Rates: []RateConfig{
+				{Name: "user", Key: "user", Interval: Duration(time.Minute), Rate: 1},
+			}},
+			reqs:      []request{{path: "/profile", uid: "1"}, {path: "/profile", uid: "2"}, {path: "/profile", uid: "1"}},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "没有请求头时按照 IP 限流",
+			cfg: LimitConfig{Rates: []RateConfig{
+				{Name: "user", Key: "header:uid", Interval: Duration(time.Minute), Rate: 1},
+			}},
+			reqs: []request{{path: "/profile", uid: "1", ip: "1.1.1.1"},
+				{path: "/profile", ip: "1.1.1.1"}, {path: "/profile", ip: "2.2.2.2"}, {path: "/profile", ip: "1.1.1.1"}},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewConfigManager().SetKeyFunc("user", func(ctx *gin.Context) string {
+				return ctx.GetHeader("uid")
+			})
+			require.NoError(t, m.Apply(tc.cfg))
+			server := gin.New()
+			server.Use(m.Build())
+			server.GET("/login", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+			server.GET("/profile", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			codes := make([]int, 0, len(tc.reqs))
+			for _, r := range tc.reqs {
+				req, err := http.NewRequest(http.MethodGet, r.path, nil)
+				require.NoError(t, err)
+				req.Header.Set("uid", r.uid)
+				if r.ip != "" {
+					req.RemoteAddr = r.ip + ":1234"
+				}
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				codes = append(codes, resp.Code)
+			}
+			assert.Equal(t, tc.wantCodes, codes)
+		})
+	}
+}
+
+func TestConfigManager_Apply(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cfg     LimitConfig
+		wantErr string
+	}{
+		{
+			name: "没有设置 Redis",
+			cfg: LimitConfig{Rates: []RateConfig{
+				{Name: "login", Store: StoreRedis, Interval: Duration(time.Minute), Rate: 1},
+			}},
+			wantErr: "规则 login: 使用 redis 之前需要调用 SetRedis",
+		},
+		{
+			name: "限流对象不存在",
+			cfg: LimitConfig{Concurrency: []ConcurrencyConfig{
+				{Name: "export", Key: "user", MaxActive: 1},
+			}},
+			wantErr: "规则 export: 限流对象 user 不存在",
+		},
+		{
+			name: "配置错误",
+			cfg: LimitConfig{Rates: []RateConfig{
+				{Name: "login"},
+			}},
+			wantErr: "规则 login 的 interval 和 rate 必须大于 0",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewConfigManager()
+			old := LimitConfig{Rates: []RateConfig{
+				{Name: "old", Interval: Duration(time.Minute), Rate: 1},
+			}}
+			require.NoError(t, m.Apply(old))
+			assert.EqualError(t, m.Apply(tc.cfg), tc.wantErr)
+			// 出错时保留原来的配置
+			assert.Equal(t, "old", m.Config().Rates[0].Name)
+		})
+	}
+}
+
+func TestConfigManager_ApplyDefaults(t *testing.T) {
+	m := NewConfigManager()
+	cfg := LimitConfig{
+		Rates:       []RateConfig{{Name: "login", Interval: Duration(time.Minute), Rate: 1}},
+		Concurrency: []ConcurrencyConfig{{Name: "export", MaxActive: 1}},
+	}
+	require.NoError(t, m.Apply(cfg))
+	// 默认值只填充到生效的配置里
+	assert.Equal(t, RateConfig{Name: "login", Interval: Duration(time.Minute), Rate: 1}, cfg.Rates[0])
+	assert.Equal(t, ConcurrencyConfig{Name: "export", MaxActive: 1}, cfg.Concurrency[0])
+	assert.Equal(t, StoreLocal, m.Config().Rates[0].Store)
+	assert.Equal(t, StoreLocal, m.Config().Concurrency[0].Store)
+}
+
+func TestConfigManager_RedisKey(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	testCases := []struct {
+		name    string
+		cfg     LimitConfig
+		kb      *KeyBuilder
+		wantKey string
+	}{
+		{
+			name: "频率限制",
+			cfg: LimitConfig{Rates: []RateConfig{
+				{Name: "login", Store: StoreRedis, Interval: Duration(time.Minute), Rate: 1},
+			}},
+			wantKey: "ginx:ratelimit:config:{login:1.2.3.4}",
+		},
+		{
+			name: "活跃请求数限制",
+			cfg: LimitConfig{Concurrency: []ConcurrencyConfig{
+				{Name: "export", Store: StoreRedis, MaxActive: 1},
+			}},
+			wantKey: "ginx:ratelimit:config:{export:global}",
+		},
+		{
+			name: "自定义命名空间",
+			cfg: LimitConfig{Concurrency: []ConcurrencyConfig{
+				{Name: "export", Store: StoreRedis, MaxActive: 1},
+			}},
+			kb:      NewKeyBuilder("order").SetVersion(2),
+			wantKey: "ginx:ratelimit:order:v2:{export:global}",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(context.Background())
+			res.SetErr(errors.New("redis 异常"))
+			cmd.EXPECT().EvalSha(gomock.Any(), gomock.Any(), []string{tc.wantKey}, gomock.Any()).
+				Return(res)
+
+			m := NewConfigManager().SetRedis(cmd)
+			if tc.kb != nil {
+				m.SetKeyBuilder(tc.kb)
+			}
+			require.NoError(t, m.Apply(tc.cfg))
+			server := gin.New()
+			server.Use(m.Build())
+			server.GET("/", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			require.NoError(t, err)
+			req.RemoteAddr = "1.2.3.4:1234"
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusInternalServerError, resp.Code)
+		})
+	}
+}
+
+func TestConfigManager_Reload(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	m := NewConfigManager()
+	cfg := LimitConfig{
+		Rates: []RateConfig{
+			{Name: "login", Routes: []string{"/login"}, Interval: Duration(time.Minute), Rate: 1},
+		},
+		Concurrency: []ConcurrencyConfig{
+			{Name: "export", Routes: []string{"/export"}, MaxActive: 1},
+		},
+	}
+	require.NoError(t, m.Apply(cfg))
+	server := gin.New()
+	server.Use(m.Build())
+	server.GET("/login", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	done := make(chan struct{})
+	server.GET("/export", func(ctx *gin.Context) {
+		if ctx.GetHeader("block") != "" {
+			<-done
+		}
+		ctx.Status(http.StatusOK)
+	})
+	serve := func(path string, block bool) int {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		require.NoError(t, err)
+		if block {
+			req.Header.Set("block", "true")
+		}
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/login", false))
+	// 一个导出请求正在处理
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Equal(t, http.StatusOK, serve("/export", true))
+	}()
+	active := func() int64 {
+		return m.state.Load().concurrency[0].local.Active("global")
+	}
+	for active() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serve("/export", false))
+
+	// 参数没有变化的限流器保留原来的计数
+	cfg.Concurrency[0].MaxActive = 2
+	require.NoError(t, m.Apply(cfg))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/login", false))
+	// 活跃请求数保留原来的计数, 新的上限立刻生效
+	assert.Equal(t, int64(1), active())
+	assert.Equal(t, http.StatusOK, serve("/export", false))
+
+	// 更新失败时不修改复用的限流器
+	bad := cfg
+	bad.Rates = []RateConfig{cfg.Rates[0]}
+	bad.Rates[0].Rate = 3
+	bad.Concurrency = []ConcurrencyConfig{{Name: "bad", Key: "user", MaxActive: 1}}
+	require.Error(t, m.Apply(bad))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/login", false))
+
+	// 修改阈值之后保留窗口内的计数
+	cfg.Rates[0].Rate = 2
+	require.NoError(t, m.Apply(cfg))
+	assert.Equal(t, http.StatusOK, serve("/login", false))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/login", false))
+
+	// 修改窗口大小之后重新计数
+	cfg.Rates[0].Interval = Duration(time.Hour)
+	require.NoError(t, m.Apply(cfg))
+	assert.Equal(t, http.StatusOK, serve("/login", false))
+
+	// 更新之前的请求结束之后减少的是同一个计数
+	close(done)
+	wg.Wait()
+	assert.Equal(t, int64(0), active())
+}
+
+func TestConfigManager_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.yaml")
+	write := func(rate string) {
+		data := "rates:\n  - name: login\n    interval: 1s\n    rate: " + rate + "\n"
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	}
+	write("10")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewConfigManager()
+	require.NoError(t, m.Watch(ctx, NewFileSource(path).SetInterval(10*time.Millisecond)))
+	assert.Equal(t, 10, m.Config().Rates[0].Rate)
+
+	// 错误的配置不会生效
+	write("abc")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 10, m.Config().Rates[0].Rate)
+
+	write("20")
+	assert.Eventually(t, func() bool {
+		return m.Config().Rates[0].Rate == 20
+	}, time.Second, 10*time.Millisecond)
+
+	// 第一次读取失败时返回错误
+	err := NewConfigManager().Watch(ctx, NewFileSource(filepath.Join(t.TempDir(), "not_exist.yaml")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"ginx/logger"
+	"os"
+	"time"
+)
+
+// ConfigSource 限流配置的来源, 例如本地文件和配置中心
+type ConfigSource interface {
+	// Load 读取当前的配置
+	Load(ctx context.Context) (LimitConfig, error)
+	// Watch 配置变化时调用 onChange, 直到 ctx 结束
+	Watch(ctx context.Context, onChange func(cfg LimitConfig))
+}
+
+// FileSource 从本地文件读取配置, 根据扩展名判断是 YAML 还是 JSON,
+// 定期检查文件的修改时间, 发生变化之后重新读取.
+type FileSource struct {
+	path     string
+	interval time.Duration
+	// l 默认使用 slog.Default()
+	l logger.Logger
+}
+
+// NewFileSource 默认每 5 秒检查一次文件是否发生变化
+func NewFileSource(path string) *FileSource {
+	return &FileSource{
+		path:     path,
+		interval: 5 * time.Second,
+		l:        logger.NewSlogLogger(nil),
+	}
+}
+
+func (s *FileSource) SetInterval(interval time.Duration) *FileSource {
+	s.interval = interval
+	return s
+}
+
+func (s *FileSource) SetLogger(l logger.Logger) *FileSource {
+	s.l = l
+	return s
+}
+
+func (s *FileSource) Load(ctx context.Context) (LimitConfig, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return LimitConfig{}, err
+	}
+	return ParseLimitConfig(data, formatOf(s.path))
+}
+
+// Watch 读取或者解析失败时保留之前的配置, 等待文件下一次变化
+func (s *FileSource) Watch(ctx context.Context, onChange func(cfg LimitConfig)) {
+	version := s.version()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		v := s.version()
+		if v == version {
+			continue
+		}
+		version = v
+		cfg, err := s.Load(ctx)
+		if err != nil {
+			s.l.Error("读取限流配置失败",
+				logger.String("path", s.path),
+				logger.Error(err))
+			continue
+		}
+		onChange(cfg)
+	}
+}
+
+// fileVersion 修改时间的精度可能不够, 同时比较文件大小
+type fileVersion struct {
+	modTime int64
+	size    int64
+}
+
+// version 文件不存在时返回零值
+func (s *FileSource) version() fileVersion {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fileVersion{}
+	}
+	return fileVersion{modTime: info.ModTime().UnixNano(), size: info.Size()}
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseLimitConfig(t *testing.T) {
+	want := LimitConfig{
+		Rates: []RateConfig{
+			{
+				Name:      "login",
+				Routes:    []string{"/login"},
+				Methods:   []string{"POST"},
+				Key:       "ip",
+				Store:     StoreRedis,
+				Algorithm: AlgorithmSlidingWindow,
+				Interval:  Duration(time.Minute),
+				Rate:      10,
+			},
+			{
+				Name:      "api",
+				Key:       "header:X-Api-Key",
+				Store:     StoreLocal,
+				Algorithm: AlgorithmTokenBucket,
+				Interval:  Duration(time.Second),
+				Rate:      100,
+				Capacity:  200,
+			},
+		},
+		Concurrency: []ConcurrencyConfig{
+			{
+				Name:      "export",
+				Routes:    []string{"/export"},
+				Key:       "user",
+				Store:     StoreLocal,
+				MaxActive: 3,
+				TTL:       Duration(time.Minute),
+			},
+		},
+	}
+	testCases := []struct {
+		name   string
+		data   string
+		format string
+
+		want    LimitConfig
+		wantErr string
+	}{
+		{
+			name: "yaml",
+			data: `
+rates:
+  - name: login
+    routes: ["/login"]
+    methods: ["POST"]
+    store: redis
+    interval: 1m
+    rate: 10
+  - name: api
+    key: header:X-Api-Key
+    algorithm: token_bucket
+    interval: 1s
+    rate: 100
+    capacity: 200
+concurrency:
+  - name: export
+    routes: ["/export"]
+    key: user
+    max_active: 3
+`,
+			format: "yaml",
+			want:   want,
+		},
+		{
+			name: "json",
+			data: `{
+  "rates": [
+    {"name": "login", "routes": ["/login"], "methods": ["POST"], "store": "redis", "interval": "1m", "rate": 10},
+    {"name": "api", "key": "header:X-Api-Key", "algorithm": "token_bucket", "interval": "1s", "rate": 100, "capacity": 200}
+  ],
+  "concurrency": [
+    {"name": "export", "routes": ["/export"], "key": "user", "max_active": 3}
+  ]
+}`,
+			format: "json",
+			want:   want,
+		},
+		{
+			name:    "不支持的格式",
+			data:    "rates = []",
+			format:  "toml",
+			wantErr: "不支持的配置格式 toml",
+		},
+		{
+			name:    "时长格式错误",
+			data:    `{"rates": [{"name": "login", "interval": "1min", "rate": 10}]}`,
+			format:  "json",
+			wantErr: `time: unknown unit "min" in duration "1min"`,
+		},
+		{
+			name:    "规则名称重复",
+			data:    `{"rates": [{"name": "login", "interval": "1s", "rate": 10}], "concurrency": [{"name": "login", "max_active": 1}]}`,
+			format:  "json",
+			wantErr: "规则名称 login 重复",
+		},
+		{
+			name:    "缺少 rate",
+			data:    `{"rates": [{"name": "login", "interval": "1s"}]}`,
+			format:  "json",
+			wantErr: "规则 login 的 interval 和 rate 必须大于 0",
+		},
+		{
+			name:    "redis 的 interval 小于 1ms",
+			data:    `{"rates": [{"name": "login", "store": "redis", "interval": "500us", "rate": 10}]}`,
+			format:  "json",
+			wantErr: "规则 login 的 interval 不能小于 1ms",
+		},
+		{
+			name:    "令牌桶容量为负数",
+			data:    `{"rates": [{"name": "login", "algorithm": "token_bucket", "interval": "1s", "rate": 10, "capacity": -1}]}`,
+			format:  "json",
+			wantErr: "规则 login 的 capacity 必须大于 0",
+		},
+		{
+			name:    "本地不支持 gcra",
+			data:    `{"rates": [{"name": "login", "algorithm": "gcra", "interval": "1s", "rate": 10}]}`,
+			format:  "json",
+			wantErr: "规则 login 的 gcra 算法只支持 redis",
+		},
+		{
+			name:    "算法不存在",
+			data:    `{"rates": [{"name": "login", "algorithm": "leaky_bucket", "interval": "1s", "rate": 10}]}`,
+			format:  "json",
+			wantErr: "规则 login 的算法 leaky_bucket 不存在",
+		},
+		{
+			name:    "缺少 max_active",
+			data:    `{"concurrency": [{"name": "export"}]}`,
+			format:  "json",
+			wantErr: "规则 export 的 max_active 必须大于 0",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := ParseLimitConfig([]byte(tc.data), tc.format)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, cfg)
+		})
+	}
+}
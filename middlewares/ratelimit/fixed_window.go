@@ -0,0 +1,28 @@
+package ratelimit
+
+import (
+	"ginx/internal/ratelimit"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// NewRedisFixedWindowLimiter 基于 Redis 的固定窗口限流器.
+// 开销最小, 但是窗口边界上最多会通过两倍的 rate. interval 小于 1ms 时 panic.
+func NewRedisFixedWindowLimiter(cmd redis.Cmdable,
+	interval time.Duration, rate int) ratelimit.Limiter {
+	if interval < time.Millisecond {
+		panic("ratelimit: 固定窗口限流器的窗口不能小于 1ms")
+	}
+	return &ratelimit.RedisFixedWindowLimiter{
+		Cmd:      cmd,
+		Interval: interval,
+		Rate:     rate,
+	}
+}
+
+// NewLocalFixedWindowLimiter 基于内存的固定窗口限流器, 适用于单实例部署.
+func NewLocalFixedWindowLimiter(interval time.Duration, rate int,
+	opts ...option.Option[ratelimit.LocalOptions]) ratelimit.Limiter {
+	return ratelimit.NewLocalFixedWindowLimiter(interval, rate, opts...)
+}
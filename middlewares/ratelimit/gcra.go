@@ -0,0 +1,24 @@
+package ratelimit
+
+import (
+	"ginx/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// NewRedisGCRALimiter 基于 Redis 的 GCRA 限流器, 每个 key 只占用 O(1) 的内存.
+// 每 interval/rate 放行一个请求, 空闲之后允许一次性通过 burst 个请求,
+// 任意 interval 内最多通过 burst + rate 个请求. burst 小于等于 0 时使用 1.
+// interval 小于 1ms 时 panic.
+func NewRedisGCRALimiter(cmd redis.Cmdable,
+	interval time.Duration, rate int, burst int) ratelimit.Limiter {
+	if interval < time.Millisecond {
+		panic("ratelimit: GCRA 限流器的窗口不能小于 1ms")
+	}
+	return &ratelimit.RedisGCRALimiter{
+		Cmd:      cmd,
+		Interval: interval,
+		Rate:     rate,
+		Burst:    burst,
+	}
+}
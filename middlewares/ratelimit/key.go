@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"strconv"
+	"strings"
+)
+
+// braceReplacer 去掉 key 中的 {}, 避免破坏 hash tag
+var braceReplacer = strings.NewReplacer("{", "_", "}", "_")
+
+// KeyBuilder 生成 Redis 限流 key, 格式为 <prefix>:<namespace>:v<version>:{<parts>}.
+// {} 是 Redis Cluster 的 hash tag, 同一个限流对象的所有 key,
+// 例如多规则限流的每条规则, 都会在同一个 slot, Lua 脚本才能同时访问.
+// 修改 version 可以让旧的限流状态全部失效, 例如调整了限流算法之后.
+type KeyBuilder struct {
+	prefix    string
+	namespace string
+	// 为 0 时 key 中没有版本
+	version int
+	hashTag bool
+}
+
+// NewKeyBuilder 默认前缀为 ginx:ratelimit, 开启 hash tag, 没有版本.
+func NewKeyBuilder(namespace string) *KeyBuilder {
+	return &KeyBuilder{
+		prefix:    "ginx:ratelimit",
+		namespace: namespace,
+		hashTag:   true,
+	}
+}
+
+// SetPrefix 设置前缀, 一般用于区分共用同一个 Redis 的不同应用.
+func (b *KeyBuilder) SetPrefix(prefix string) *KeyBuilder {
+	b.prefix = prefix
+	return b
+}
+
+func (b *KeyBuilder) SetVersion(version int) *KeyBuilder {
+	b.version = version
+	return b
+}
+
+// SetHashTag 是否使用 hash tag, 单机 Redis 可以关闭.
+func (b *KeyBuilder) SetHashTag(enabled bool) *KeyBuilder {
+	b.hashTag = enabled
+	return b
+}
+
+// Build 使用 : 连接 parts 作为限流对象, 例如 Build("ip", clientip.Key(ctx)).
+func (b *KeyBuilder) Build(parts ...string) string {
+	var sb strings.Builder
+	for _, seg := range []string{b.prefix, b.namespace} {
+		if seg != "" {
+			sb.WriteString(b.escape(seg))
+			sb.WriteString(":")
+		}
+	}
+	if b.version > 0 {
+		sb.WriteString("v")
+		sb.WriteString(strconv.Itoa(b.version))
+		sb.WriteString(":")
+	}
+	if b.hashTag {
+		sb.WriteString("{")
+	}
+	for i, part := range parts {
+		if i > 0 {
+			sb.WriteString(":")
+		}
+		sb.WriteString(b.escape(part))
+	}
+	if b.hashTag {
+		sb.WriteString("}")
+	}
+	return sb.String()
+}
+
+func (b *KeyBuilder) escape(s string) string {
+	if !b.hashTag {
+		return s
+	}
+	return braceReplacer.Replace(s)
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKeyBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name  string
+		kb    *KeyBuilder
+		parts []string
+		want  string
+	}{
+		{
+			name:  "默认配置",
+			kb:    NewKeyBuilder("api"),
+			parts: []string{"ip", "127.0.0.1"},
+			want:  "ginx:ratelimit:api:{ip:127.0.0.1}",
+		},
+		{
+			name:  "设置前缀和版本",
+			kb:    NewKeyBuilder("api").SetPrefix("shop").SetVersion(2),
+			parts: []string{"user", "123"},
+			want:  "shop:api:v2:{user:123}",
+		},
+		{
+			name:  "没有前缀和命名空间",
+			kb:    NewKeyBuilder("").SetPrefix(""),
+			parts: []string{"ip", "127.0.0.1"},
+			want:  "{ip:127.0.0.1}",
+		},
+		{
+			name:  "关闭 hash tag",
+			kb:    NewKeyBuilder("api").SetHashTag(false),
+			parts: []string{"ip", "127.0.0.1"},
+			want:  "ginx:ratelimit:api:ip:127.0.0.1",
+		},
+		{
+			name:  "去掉 {} 避免破坏 hash tag",
+			kb:    NewKeyBuilder("{api}"),
+			parts: []string{"user", "{123}"},
+			want:  "ginx:ratelimit:_api_:{user:_123_}",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.kb.Build(tc.parts...))
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package ratelimit
+
+import (
+	"ginx/internal/ratelimit"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// NewRedisLeaseLimiter 两级限流器, 每个实例每次从 Redis 租借 batch 个配额, 在本地放行请求,
+// 只有本地配额用完的时候才会访问 Redis.
+// 全局每个 interval 窗口最多放行 rate 个请求, 但是各实例没有用完的配额不能互相使用,
+// 最多有 实例数 * (batch - 1) 个配额被浪费. 实例退出时调用 Close 归还没有用完的配额.
+// interval 小于 1ms 时 panic.
+func NewRedisLeaseLimiter(cmd redis.Cmdable, interval time.Duration, rate int, batch int64,
+	opts ...option.Option[ratelimit.LocalOptions]) *ratelimit.LeaseLimiter {
+	if interval < time.Millisecond {
+		panic("ratelimit: 租借配额的窗口不能小于 1ms")
+	}
+	return ratelimit.NewLeaseLimiter(&ratelimit.RedisQuotaLeaser{
+		Cmd:      cmd,
+		Interval: interval,
+		Rate:     rate,
+	}, interval, batch, opts...)
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewRedisLimiter_IntervalTooSmall(t *testing.T) {
+	const interval = 500 * time.Microsecond
+	testCases := []struct {
+		name      string
+		fn        func()
+		wantPanic string
+	}{
+		{
+			name:      "固定窗口",
+			fn:        func() { NewRedisFixedWindowLimiter(nil, interval, 10) },
+			wantPanic: "ratelimit: 固定窗口限流器的窗口不能小于 1ms",
+		},
+		{
+			name:      "滑动窗口",
+			fn:        func() { NewRedisSlidingWindowLimiter(nil, interval, 10) },
+			wantPanic: "ratelimit: 滑动窗口限流器的窗口不能小于 1ms",
+		},
+		{
+			name:      "滑动窗口计数",
+			fn:        func() { NewRedisSlidingWindowCounterLimiter(nil, interval, 10) },
+			wantPanic: "ratelimit: 滑动窗口计数限流器的窗口不能小于 1ms",
+		},
+		{
+			name:      "GCRA",
+			fn:        func() { NewRedisGCRALimiter(nil, interval, 10, 1) },
+			wantPanic: "ratelimit: GCRA 限流器的窗口不能小于 1ms",
+		},
+		{
+			name: "多规则",
+			fn: func() {
+				NewRedisMultiRuleLimiter(nil, Rule{Interval: time.Second, Rate: 10}, Rule{Interval: interval, Rate: 1})
+			},
+			wantPanic: "ratelimit: 多规则限流器的窗口不能小于 1ms",
+		},
+		{
+			name:      "令牌桶",
+			fn:        func() { NewRedisTokenBucketLimiter(nil, interval, 10, 10) },
+			wantPanic: "ratelimit: 令牌桶的 interval 不能小于 1ms",
+		},
+		{
+			name:      "租借配额",
+			fn:        func() { NewRedisLeaseLimiter(nil, interval, 10, 2) },
+			wantPanic: "ratelimit: 租借配额的窗口不能小于 1ms",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.PanicsWithValue(t, tc.wantPanic, tc.fn)
+		})
+	}
+}
+
+func TestNewTokenBucketLimiter_Invalid(t *testing.T) {
+	testCases := []struct {
+		name      string
+		fn        func()
+		wantPanic string
+	}{
+		{
+			name:      "Redis 令牌桶 rate 为 0",
+			fn:        func() { NewRedisTokenBucketLimiter(nil, time.Second, 0, 10) },
+			wantPanic: "ratelimit: 令牌桶的 rate 和 capacity 必须大于 0",
+		},
+		{
+			name:      "Redis 令牌桶 capacity 为 0",
+			fn:        func() { NewRedisTokenBucketLimiter(nil, time.Second, 10, 0) },
+			wantPanic: "ratelimit: 令牌桶的 rate 和 capacity 必须大于 0",
+		},
+		{
+			name:      "本地令牌桶 interval 为 0",
+			fn:        func() { NewLocalTokenBucketLimiter(0, 10, 10) },
+			wantPanic: "ratelimit: 令牌桶的 interval, rate 和 capacity 必须大于 0",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.PanicsWithValue(t, tc.wantPanic, tc.fn)
+		})
+	}
+}
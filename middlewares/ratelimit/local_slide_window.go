@@ -0,0 +1,25 @@
+package ratelimit
+
+import (
+	"ginx/internal/ratelimit"
+	"github.com/ecodeclub/ekit/bean/option"
+	"time"
+)
+
+// NewLocalSlidingWindowLimiter 基于内存的滑动窗口限流器, 适用于单实例部署和测试.
+// 每个 key 分别限流, 闲置的 key 会被淘汰, 可以使用 WithShards 和 WithMaxKeys 控制内存.
+func NewLocalSlidingWindowLimiter(interval time.Duration, rate int,
+	opts ...option.Option[ratelimit.LocalOptions]) ratelimit.Limiter {
+	return ratelimit.NewLocalSlidingWindowLimiter(interval, rate, opts...)
+}
+
+// WithShards 设置本地限流器分段锁的数量, 默认为 32.
+func WithShards(shards int) option.Option[ratelimit.LocalOptions] {
+	return ratelimit.WithShards(shards)
+}
+
+// WithMaxKeys 设置本地限流器最多保存多少个 key, 默认为 65536.
+// 超出之后淘汰最久没有访问的 key, 被淘汰的 key 会重新开始计算.
+func WithMaxKeys(maxKeys int) option.Option[ratelimit.LocalOptions] {
+	return ratelimit.WithMaxKeys(maxKeys)
+}
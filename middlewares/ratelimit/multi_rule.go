@@ -0,0 +1,32 @@
+package ratelimit
+
+import (
+	"ginx/internal/ratelimit"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// Rule 限流规则, 每 Interval 最多通过 Rate 个请求.
+type Rule = ratelimit.Rule
+
+// NewRedisMultiRuleLimiter 基于 Redis 的多规则限流器,
+// 例如同一个 key 每秒最多 10 个请求并且每小时最多 1000 个请求.
+// 所有规则在一次 lua 脚本中原子地检查, 任何一条规则触发限流都不会占用其它规则的配额.
+// 任何一条规则的 Interval 小于 1ms 时 panic.
+func NewRedisMultiRuleLimiter(cmd redis.Cmdable, rules ...Rule) ratelimit.Limiter {
+	for _, rule := range rules {
+		if rule.Interval < time.Millisecond {
+			panic("ratelimit: 多规则限流器的窗口不能小于 1ms")
+		}
+	}
+	return &ratelimit.RedisMultiRuleLimiter{
+		Cmd:   cmd,
+		Rules: rules,
+	}
+}
+
+// NewLocalMultiRuleLimiter 基于内存的多规则限流器, 适用于单实例部署.
+func NewLocalMultiRuleLimiter(rules []Rule, opts ...option.Option[ratelimit.LocalOptions]) ratelimit.Limiter {
+	return ratelimit.NewLocalMultiRuleLimiter(rules, opts...)
+}
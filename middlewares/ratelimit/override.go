@@ -0,0 +1,328 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"ginx/internal/ratelimit"
+	"ginx/logger"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	//go:embed override_get.lua
+	luaOverrideGet string
+
+	overrideGetScript = redis.NewScript(luaOverrideGet)
+)
+
+// Override 限流对象的动态配置
+type Override struct {
+	// 白名单中的限流对象不限流
+	Allowed bool `json:"allowed"`
+	// 黑名单中的限流对象在解封之前直接拒绝, 零值表示不在黑名单中
+	BlockedUntil time.Time `json:"blocked_until"`
+	// 不为 nil 时使用自定义的频率代替默认的限流器
+	Rate *RateOverride `json:"rate,omitempty"`
+}
+
+// Blocked 是否在黑名单中
+func (o Override) Blocked(now time.Time) bool {
+	return now.Before(o.BlockedUntil)
+}
+
+// RateOverride 每 Interval 最多通过 Rate 个请求
+type RateOverride struct {
+	Interval Duration `json:"interval"`
+	Rate     int      `json:"rate"`
+}
+
+// Subscriber 订阅失效通知, redis.Client 和 redis.ClusterClient 都实现了这个接口
+type Subscriber interface {
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+type cachedOverride struct {
+	Override
+	expireAt time.Time
+}
+
+// OverrideStore 保存在 Redis 中的白名单, 带过期时间的黑名单和自定义频率,
+// 运维可以通过管理接口临时限制或者放开某个限流对象, 不需要重新部署.
+// 限流对象是 Builder.SetKeyGenFunc 返回的 key, 例如 ip-limiter:127.0.0.1.
+//
+// 查询结果缓存在本地, 修改之后通过 pub/sub 通知所有实例删除缓存,
+// 没有调用 Watch 或者通知丢失时, 最多过 cacheTTL 生效.
+type OverrideStore struct {
+	cmd redis.Cmdable
+	// 三个 key 使用相同的 hash tag, 兼容 Redis Cluster
+	allowKey string
+	blockKey string
+	rateKey  string
+	// 失效通知的频道
+	channel string
+
+	cacheTTL time.Duration
+	// 本地最多缓存的限流对象数量, 超出之后清空
+	maxCacheKeys int
+	// 最多保存多少种自定义频率的限流器, 超出之后清空
+	maxLimiters int
+	// limiterFn 根据自定义频率创建限流器, 默认使用 Redis 滑动窗口
+	limiterFn func(interval time.Duration, rate int) ratelimit.Limiter
+	nowFunc   func() time.Time
+	// l 默认使用 slog.Default()
+	l logger.Logger
+
+	mu       sync.Mutex
+	cache    map[string]cachedOverride
+	limiters map[RateOverride]ratelimit.WeightedLimiter
+	// gen 每次删除缓存加 1, generations 记录每个限流对象最后一次删除缓存时的 gen,
+	// 查询 Redis 期间删除过缓存的结果可能已经过期, 不能写入缓存.
+	// generations 超过 maxCacheKeys 时清空, 之前删除的缓存都按照 genFloor 计算.
+	gen         uint64
+	genFloor    uint64
+	generations map[string]uint64
+}
+
+// NewOverrideStore 默认缓存 30 秒
+func NewOverrideStore(cmd redis.Cmdable, prefix string) *OverrideStore {
+	tag := "{" + prefix + "}"
+	return &OverrideStore{
+		cmd:          cmd,
+		allowKey:     tag + ":allow",
+		blockKey:     tag + ":block",
+		rateKey:      tag + ":rate",
+		channel:      tag + ":invalidate",
+		cacheTTL:     30 * time.Second,
+		maxCacheKeys: 65536,
+		maxLimiters:  1024,
+		limiterFn: func(interval time.Duration, rate int) ratelimit.Limiter {
+			return NewRedisSlidingWindowLimiter(cmd, interval, rate)
+		},
+		nowFunc:  time.Now,
+		l:        logger.NewSlogLogger(nil),
+		cache:    make(map[string]cachedOverride),
+		limiters: make(map[RateOverride]ratelimit.WeightedLimiter),
+
+		generations: make(map[string]uint64),
+	}
+}
+
+func (s *OverrideStore) SetCacheTTL(ttl time.Duration) *OverrideStore {
+	s.cacheTTL = ttl
+	return s
+}
+
+// SetLimiterFunc 设置根据自定义频率创建限流器的函数,
+// 例如 func(interval time.Duration, rate int) ratelimit.Limiter { return NewRedisGCRALimiter(cmd, interval, rate, 1) }.
+func (s *OverrideStore) SetLimiterFunc(fn func(interval time.Duration, rate int) ratelimit.Limiter) *OverrideStore {
+	s.limiterFn = fn
+	return s
+}
+
+func (s *OverrideStore) SetLogger(l logger.Logger) *OverrideStore {
+	s.l = l
+	return s
+}
+
+// Get 查询限流对象的动态配置, 优先使用本地缓存
+func (s *OverrideStore) Get(ctx context.Context, key string) (Override, error) {
+	now := s.nowFunc()
+	if o, ok := s.cached(key, now); ok {
+		return o, nil
+	}
+	s.mu.Lock()
+	gen := s.gen
+	s.mu.Unlock()
+	o, err := s.load(ctx, key, now)
+	if err != nil {
+		return Override{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if max(s.generations[key], s.genFloor) > gen {
+		// 查询期间收到了失效通知, 下一次重新查询
+		return o, nil
+	}
+	if len(s.cache) >= s.maxCacheKeys {
+		s.cache = make(map[string]cachedOverride)
+	}
+	s.cache[key] = cachedOverride{Override: o, expireAt: now.Add(s.cacheTTL)}
+	return o, nil
+}
+
+// cached 只查询本地缓存, 缓存不存在或者已经过期时返回 false
+func (s *OverrideStore) cached(key string, now time.Time) (Override, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.cache[key]
+	if !ok || !now.Before(c.expireAt) {
+		return Override{}, false
+	}
+	return c.Override, true
+}
+
+// load 不使用本地缓存, 直接查询 Redis
+func (s *OverrideStore) load(ctx context.Context, key string, now time.Time) (Override, error) {
+	res, err := overrideGetScript.Run(ctx, s.cmd, []string{s.allowKey, s.blockKey, s.rateKey},
+		key, now.UnixMilli()).Slice()
+	if err != nil {
+		return Override{}, err
+	}
+	return parseOverride(res)
+}
+
+func parseOverride(res []any) (Override, error) {
+	if len(res) != 3 {
+		return Override{}, fmt.Errorf("脚本返回值错误 %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	blockedUntil, _ := res[1].(int64)
+	rate, _ := res[2].(string)
+	o := Override{Allowed: allowed == 1}
+	if blockedUntil > 0 {
+		o.BlockedUntil = time.UnixMilli(blockedUntil)
+	}
+	if rate != "" {
+		var r RateOverride
+		if err := json.Unmarshal([]byte(rate), &r); err != nil {
+			return Override{}, err
+		}
+		o.Rate = &r
+	}
+	return o, nil
+}
+
+// Allow 把限流对象加入白名单
+func (s *OverrideStore) Allow(ctx context.Context, key string) error {
+	if err := s.cmd.SAdd(ctx, s.allowKey, key).Err(); err != nil {
+		return err
+	}
+	return s.publish(ctx, key)
+}
+
+// RemoveAllow 把限流对象移出白名单
+func (s *OverrideStore) RemoveAllow(ctx context.Context, key string) error {
+	if err := s.cmd.SRem(ctx, s.allowKey, key).Err(); err != nil {
+		return err
+	}
+	return s.publish(ctx, key)
+}
+
+// Block 把限流对象加入黑名单, ttl 之后自动解封
+func (s *OverrideStore) Block(ctx context.Context, key string, ttl time.Duration) error {
+	now := s.nowFunc()
+	// 顺便清理已经解封的限流对象
+	if err := s.cmd.ZRemRangeByScore(ctx, s.blockKey, "-inf",
+		strconv.FormatInt(now.UnixMilli(), 10)).Err(); err != nil {
+		return err
+	}
+	err := s.cmd.ZAdd(ctx, s.blockKey, redis.Z{
+		Score:  float64(now.Add(ttl).UnixMilli()),
+		Member: key,
+	}).Err()
+	if err != nil {
+		return err
+	}
+	return s.publish(ctx, key)
+}
+
+// Unblock 提前解封
+func (s *OverrideStore) Unblock(ctx context.Context, key string) error {
+	if err := s.cmd.ZRem(ctx, s.blockKey, key).Err(); err != nil {
+		return err
+	}
+	return s.publish(ctx, key)
+}
+
+// SetRate 设置限流对象的自定义频率
+func (s *OverrideStore) SetRate(ctx context.Context, key string, rate RateOverride) error {
+	if rate.Interval <= 0 || rate.Rate <= 0 {
+		return fmt.Errorf("interval 和 rate 必须大于 0")
+	}
+	data, err := json.Marshal(rate)
+	if err != nil {
+		return err
+	}
+	if err = s.cmd.HSet(ctx, s.rateKey, key, string(data)).Err(); err != nil {
+		return err
+	}
+	return s.publish(ctx, key)
+}
+
+// RemoveRate 删除限流对象的自定义频率
+func (s *OverrideStore) RemoveRate(ctx context.Context, key string) error {
+	if err := s.cmd.HDel(ctx, s.rateKey, key).Err(); err != nil {
+		return err
+	}
+	return s.publish(ctx, key)
+}
+
+// Invalidate 删除本地缓存, 正在查询 Redis 的结果也不会写入缓存
+func (s *OverrideStore) Invalidate(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cache, key)
+	s.gen++
+	if len(s.generations) >= s.maxCacheKeys {
+		s.generations = make(map[string]uint64)
+		s.genFloor = s.gen
+	}
+	s.generations[key] = s.gen
+}
+
+// publish 删除本地缓存, 并且通知其它实例删除缓存
+func (s *OverrideStore) publish(ctx context.Context, key string) error {
+	s.Invalidate(key)
+	return s.cmd.Publish(ctx, s.channel, key).Err()
+}
+
+// Watch 订阅失效通知, 直到 ctx 结束.
+func (s *OverrideStore) Watch(ctx context.Context, sub Subscriber) error {
+	pubsub := sub.Subscribe(ctx, s.channel)
+	// 等待订阅成功
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return err
+	}
+	go func() {
+		defer pubsub.Close()
+		s.listen(ctx, pubsub.Channel())
+	}()
+	return nil
+}
+
+func (s *OverrideStore) listen(ctx context.Context, ch <-chan *redis.Message) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			s.Invalidate(msg.Payload)
+		}
+	}
+}
+
+// limiter 相同频率的限流对象共用一个限流器.
+// 自定义频率的种类超过 maxLimiters 时清空重建, 默认的 Redis 限流器的计数保存在 Redis 里, 不受影响.
+func (s *OverrideStore) limiter(rate RateOverride) ratelimit.WeightedLimiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.limiters[rate]
+	if !ok {
+		if len(s.limiters) >= s.maxLimiters {
+			s.limiters = make(map[RateOverride]ratelimit.WeightedLimiter)
+		}
+		l = ratelimit.AsWeightedLimiter(s.limiterFn(time.Duration(rate.Interval), rate.Rate))
+		s.limiters[rate] = l
+	}
+	return l
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"ginx/logger"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+type blockReq struct {
+	TTL Duration `json:"ttl"`
+}
+
+// RegisterAdminRoutes 注册管理动态配置的接口, 需要调用方自己做好鉴权.
+// 限流对象通过查询参数 key 传递, 可以包含 / 等任意字符, 缺少时返回 400.
+//
+//	GET    /overrides?key=        查询限流对象的动态配置
+//	PUT    /overrides/allow?key=  加入白名单
+//	DELETE /overrides/allow?key=  移出白名单
+//	PUT    /overrides/block?key=  加入黑名单, 请求体 {"ttl": "10m"}
+//	DELETE /overrides/block?key=  解封
+//	PUT    /overrides/rate?key=   设置自定义频率, 请求体 {"interval": "1m", "rate": 100}
+//	DELETE /overrides/rate?key=   删除自定义频率
+func (s *OverrideStore) RegisterAdminRoutes(r gin.IRouter) {
+	g := r.Group("/overrides")
+	g.GET("", s.adminHandler(func(ctx *gin.Context, key string) {
+		o, err := s.load(ctx, key, s.nowFunc())
+		if err != nil {
+			s.adminError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, o)
+	}))
+	g.PUT("/allow", s.adminHandler(func(ctx *gin.Context, key string) {
+		s.adminResult(ctx, s.Allow(ctx, key))
+	}))
+	g.DELETE("/allow", s.adminHandler(func(ctx *gin.Context, key string) {
+		s.adminResult(ctx, s.RemoveAllow(ctx, key))
+	}))
+	g.PUT("/block", s.adminHandler(func(ctx *gin.Context, key string) {
+		var req blockReq
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.TTL <= 0 {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		s.adminResult(ctx, s.Block(ctx, key, time.Duration(req.TTL)))
+	}))
+	g.DELETE("/block", s.adminHandler(func(ctx *gin.Context, key string) {
+		s.adminResult(ctx, s.Unblock(ctx, key))
+	}))
+	g.PUT("/rate", s.adminHandler(func(ctx *gin.Context, key string) {
+		var req RateOverride
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.Interval <= 0 || req.Rate <= 0 {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		s.adminResult(ctx, s.SetRate(ctx, key, req))
+	}))
+	g.DELETE("/rate", s.adminHandler(func(ctx *gin.Context, key string) {
+		s.adminResult(ctx, s.RemoveRate(ctx, key))
+	}))
+}
+
+// adminHandler 读取查询参数中的限流对象
+func (s *OverrideStore) adminHandler(fn func(ctx *gin.Context, key string)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.Query("key")
+		if key == "" {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		fn(ctx, key)
+	}
+}
+
+func (s *OverrideStore) adminResult(ctx *gin.Context, err error) {
+	if err != nil {
+		s.adminError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (s *OverrideStore) adminError(ctx *gin.Context, err error) {
+	s.l.Error("管理限流动态配置失败",
+		logger.String("key", ctx.Query("key")),
+		logger.String("path", ctx.Request.URL.Path),
+		logger.Error(err))
+	ctx.AbortWithStatus(http.StatusInternalServerError)
+}
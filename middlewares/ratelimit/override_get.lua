@@ -0,0 +1,17 @@
+-- 白名单, 黑名单和自定义频率, 三个 key 使用相同的 hash tag
+local allowKey = KEYS[1]
+local blockKey = KEYS[2]
+local rateKey = KEYS[3]
+-- 限流对象
+local member = ARGV[1]
+-- 当前时间, 毫秒
+local now = tonumber(ARGV[2])
+
+local allowed = redis.call('SISMEMBER', allowKey, member)
+-- 黑名单的 score 是解封时间
+local blockedUntil = tonumber(redis.call('ZSCORE', blockKey, member) or 0)
+if blockedUntil <= now then
+    blockedUntil = 0
+end
+local rate = redis.call('HGET', rateKey, member) or ''
+return {allowed, blockedUntil, rate}
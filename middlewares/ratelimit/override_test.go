@@ -0,0 +1,481 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"ginx/degrade"
+	"ginx/internal/ratelimit"
+	limitmocks "ginx/internal/ratelimit/mocks"
+	"ginx/middlewares/redislimit/redismocks"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var overrideKeys = []string{"{ops}:allow", "{ops}:block", "{ops}:rate"}
+
+func overrideResult(val []any, err error) *redis.Cmd {
+	res := redis.NewCmd(context.Background())
+	res.SetVal(val)
+	res.SetErr(err)
+	return res
+}
+
+func intResult(val int64, err error) *redis.IntCmd {
+	res := redis.NewIntCmd(context.Background())
+	res.SetVal(val)
+	res.SetErr(err)
+	return res
+}
+
+func TestOverrideStore_Get(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		want    Override
+		wantErr error
+	}{
+		{
+			name: "没有动态配置",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys,
+					"tenant:1", now.UnixMilli()).Return(overrideResult([]any{int64(0), int64(0), ""}, nil))
+				return cmd
+			},
+			want: Override{},
+		},
+		{
+			name: "所有动态配置",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys,
+					"tenant:1", now.UnixMilli()).Return(overrideResult([]any{int64(1),
+					now.Add(time.Minute).UnixMilli(), `{"interval":"1m0s","rate":10}`}, nil))
+				return cmd
+			},
+			want: Override{
+				Allowed:      true,
+				BlockedUntil: now.Add(time.Minute),
+				Rate:         &RateOverride{Interval: Duration(time.Minute), Rate: 10},
+			},
+		},
+		{
+			name: "自定义频率格式错误",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys,
+					"tenant:1", now.UnixMilli()).Return(overrideResult([]any{int64(0), int64(0), `{"interval":1}`}, nil))
+				return cmd
+			},
+			wantErr: errors.New("json: cannot unmarshal number into Go value of type string"),
+		},
+		{
+			name: "Redis 异常",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys,
+					"tenant:1", now.UnixMilli()).Return(overrideResult(nil, errors.New("redis 异常")))
+				return cmd
+			},
+			wantErr: errors.New("redis 异常"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := NewOverrideStore(tc.mock(ctrl), "ops")
+			s.nowFunc = func() time.Time {
+				return now
+			}
+
+			got, err := s.Get(context.Background(), "tenant:1")
+			if tc.wantErr != nil {
+				assert.EqualError(t, err, tc.wantErr.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			// 第二次使用本地缓存, 不会访问 Redis
+			got, err = s.Get(context.Background(), "tenant:1")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestOverrideStore_Cache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1695571200000)
+	cmd := redismocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys,
+		"tenant:1", gomock.Any()).Return(overrideResult([]any{int64(0), int64(0), ""}, nil)).Times(3)
+	s := NewOverrideStore(cmd, "ops").SetCacheTTL(time.Second)
+	s.nowFunc = func() time.Time {
+		return now
+	}
+
+	_, err := s.Get(context.Background(), "tenant:1")
+	require.NoError(t, err)
+	// 缓存过期之后重新查询
+	now = now.Add(2 * time.Second)
+	_, err = s.Get(context.Background(), "tenant:1")
+	require.NoError(t, err)
+
+	// 收到失效通知之后重新查询
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *redis.Message)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.listen(ctx, ch)
+	}()
+	ch <- &redis.Message{Channel: "{ops}:invalidate", Payload: "tenant:1"}
+	cancel()
+	<-done
+	_, err = s.Get(context.Background(), "tenant:1")
+	require.NoError(t, err)
+}
+
+func TestOverrideStore_InvalidateDuringLoad(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1695571200000)
+	blockedUntil := now.Add(time.Hour)
+	cmd := redismocks.NewMockCmdable(ctrl)
+	s := NewOverrideStore(cmd, "ops")
+	s.nowFunc = func() time.Time {
+		return now
+	}
+	// 查询期间黑名单被移除, 收到失效通知
+	cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys, "tenant:1", gomock.Any()).
+		DoAndReturn(func(ctx context.Context, sha string, keys []string, args ...any) *redis.Cmd {
+			s.Invalidate("tenant:1")
+			return overrideResult([]any{int64(0), blockedUntil.UnixMilli(), ""}, nil)
+		})
+	cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys, "tenant:1", gomock.Any()).
+		Return(overrideResult([]any{int64(0), int64(0), ""}, nil))
+
+	got, err := s.Get(context.Background(), "tenant:1")
+	require.NoError(t, err)
+	assert.Equal(t, Override{BlockedUntil: blockedUntil}, got)
+	// 旧的结果没有写入缓存, 重新查询之后缓存最新的结果
+	for i := 0; i < 2; i++ {
+		got, err = s.Get(context.Background(), "tenant:1")
+		require.NoError(t, err)
+		assert.Equal(t, Override{}, got)
+	}
+}
+
+func TestOverrideStore_limiter(t *testing.T) {
+	var created int
+	s := NewOverrideStore(nil, "ops").
+		SetLimiterFunc(func(interval time.Duration, rate int) ratelimit.Limiter {
+			created++
+			return NewLocalFixedWindowLimiter(interval, rate)
+		})
+	s.maxLimiters = 2
+	minute := RateOverride{Interval: Duration(time.Minute), Rate: 10}
+	// 相同频率共用一个限流器
+	assert.Same(t, s.limiter(minute), s.limiter(minute))
+	s.limiter(RateOverride{Interval: Duration(time.Minute), Rate: 20})
+	assert.Equal(t, 2, created)
+	// 超出之后清空
+	s.limiter(RateOverride{Interval: Duration(time.Minute), Rate: 30})
+	assert.Len(t, s.limiters, 1)
+	s.limiter(minute)
+	assert.Equal(t, 4, created)
+}
+
+func TestOverrideStore_RegisterAdminRoutes(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		mock   func(cmd *redismocks.MockCmdable)
+
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:   "查询动态配置",
+			method: http.MethodGet,
+			path:   "/overrides?key=tenant:1",
+			mock: func(cmd *redismocks.MockCmdable) {
+				cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys,
+					"tenant:1", now.UnixMilli()).Return(overrideResult([]any{int64(1), int64(0), ""}, nil))
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"allowed":true,"blocked_until":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:   "加入白名单",
+			method: http.MethodPut,
+			path:   "/overrides/allow?key=tenant:1",
+			mock: func(cmd *redismocks.MockCmdable) {
+				cmd.EXPECT().SAdd(gomock.Any(), "{ops}:allow", "tenant:1").Return(intResult(1, nil))
+				cmd.EXPECT().Publish(gomock.Any(), "{ops}:invalidate", "tenant:1").Return(intResult(1, nil))
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:   "移出白名单",
+			method: http.MethodDelete,
+			path:   "/overrides/allow?key=tenant:1",
+			mock: func(cmd *redismocks.MockCmdable) {
+				cmd.EXPECT().SRem(gomock.Any(), "{ops}:allow", "tenant:1").Return(intResult(1, nil))
+				cmd.EXPECT().Publish(gomock.Any(), "{ops}:invalidate", "tenant:1").Return(intResult(1, nil))
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:   "加入黑名单",
+			method: http.MethodPut,
+			path:   "/overrides/block?key=tenant:1",
+			body:   `{"ttl":"10m"}`,
+			mock: func(cmd *redismocks.MockCmdable) {
+				cmd.EXPECT().ZRemRangeByScore(gomock.Any(), "{ops}:block", "-inf", "1695571200000").
+					Return(intResult(0, nil))
+				cmd.EXPECT().ZAdd(gomock.Any(), "{ops}:block", redis.Z{
+					Score:  float64(now.Add(10 * time.Minute).UnixMilli()),
+					Member: "tenant:1",
+				}).Return(intResult(1, nil))
+				cmd.EXPECT().Publish(gomock.Any(), "{ops}:invalidate", "tenant:1").Return(intResult(1, nil))
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "加入黑名单, 缺少 ttl",
+			method:   http.MethodPut,
+			path:     "/overrides/block?key=tenant:1",
+			body:     `{}`,
+			mock:     func(cmd *redismocks.MockCmdable) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "解封",
+			method: http.MethodDelete,
+			path:   "/overrides/block?key=tenant:1",
+			mock: func(cmd *redismocks.MockCmdable) {
+				cmd.EXPECT().ZRem(gomock.Any(), "{ops}:block", "tenant:1").Return(intResult(1, nil))
+				cmd.EXPECT().Publish(gomock.Any(), "{ops}:invalidate", "tenant:1").Return(intResult(1, nil))
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:   "设置自定义频率",
+			method: http.MethodPut,
+			path:   "/overrides/rate?key=tenant:1",
+			body:   `{"interval":"1m","rate":100}`,
+			mock: func(cmd *redismocks.MockCmdable) {
+				cmd.EXPECT().HSet(gomock.Any(), "{ops}:rate", "tenant:1", `{"interval":"1m0s","rate":100}`).
+					Return(intResult(1, nil))
+				cmd.EXPECT().Publish(gomock.Any(), "{ops}:invalidate", "tenant:1").Return(intResult(1, nil))
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "设置自定义频率, 参数错误",
+			method:   http.MethodPut,
+			path:     "/overrides/rate?key=tenant:1",
+			body:     `{"interval":"1m"}`,
+			mock:     func(cmd *redismocks.MockCmdable) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "限流对象包含 /",
+			method: http.MethodPut,
+			path:   "/overrides/allow?key=" + url.QueryEscape("route:/api/v1/users"),
+			mock: func(cmd *redismocks.MockCmdable) {
+				cmd.EXPECT().SAdd(gomock.Any(), "{ops}:allow", "route:/api/v1/users").Return(intResult(1, nil))
+				cmd.EXPECT().Publish(gomock.Any(), "{ops}:invalidate", "route:/api/v1/users").Return(intResult(1, nil))
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "缺少限流对象",
+			method:   http.MethodDelete,
+			path:     "/overrides/allow",
+			mock:     func(cmd *redismocks.MockCmdable) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "删除自定义频率, Redis 异常",
+			method: http.MethodDelete,
+			path:   "/overrides/rate?key=tenant:1",
+			mock: func(cmd *redismocks.MockCmdable) {
+				cmd.EXPECT().HDel(gomock.Any(), "{ops}:rate", "tenant:1").
+					Return(intResult(0, errors.New("redis 异常")))
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			tc.mock(cmd)
+			s := NewOverrideStore(cmd, "ops")
+			s.nowFunc = func() time.Time {
+				return now
+			}
+			server := gin.New()
+			s.RegisterAdminRoutes(server)
+
+			req, err := http.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+			if tc.wantBody != "" {
+				assert.JSONEq(t, tc.wantBody, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestBuilder_SetOverrides(t *testing.T) {
+	now := time.UnixMilli(1695571200000)
+	testCases := []struct {
+		name      string
+		override  []any
+		err       error
+		mock      func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter)
+		wantCode  int
+		wantRetry string
+	}{
+		{
+			name:     "白名单不限流",
+			override: []any{int64(1), int64(0), ""},
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				return limitmocks.NewMockLimiter(ctrl), limitmocks.NewMockLimiter(ctrl)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "黑名单直接拒绝",
+			override: []any{int64(0), now.Add(90 * time.Second).UnixMilli(), ""},
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				return limitmocks.NewMockLimiter(ctrl), limitmocks.NewMockLimiter(ctrl)
+			},
+			wantCode:  http.StatusForbidden,
+			wantRetry: "90",
+		},
+		{
+			name:     "使用自定义频率",
+			override: []any{int64(0), int64(0), `{"interval":"1m0s","rate":1000}`},
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				custom := limitmocks.NewMockLimiter(ctrl)
+				custom.EXPECT().Limit(gomock.Any(), "tenant:1:override").Return(false, nil)
+				return limitmocks.NewMockLimiter(ctrl), custom
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "没有动态配置使用默认限流器",
+			override: []any{int64(0), int64(0), ""},
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				limiter := limitmocks.NewMockLimiter(ctrl)
+				limiter.EXPECT().Limit(gomock.Any(), "tenant:1").Return(true, nil)
+				return limiter, limitmocks.NewMockLimiter(ctrl)
+			},
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name: "查询动态配置失败使用默认限流器",
+			err:  errors.New("redis 异常"),
+			mock: func(ctrl *gomock.Controller) (ratelimit.Limiter, ratelimit.Limiter) {
+				limiter := limitmocks.NewMockLimiter(ctrl)
+				limiter.EXPECT().Limit(gomock.Any(), "tenant:1").Return(false, nil)
+				return limiter, limitmocks.NewMockLimiter(ctrl)
+			},
+			wantCode: http.StatusOK,
+		},
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys,
+				"tenant:1", now.UnixMilli()).Return(overrideResult(tc.override, tc.err))
+			limiter, custom := tc.mock(ctrl)
+			s := NewOverrideStore(cmd, "ops").
+				SetLimiterFunc(func(interval time.Duration, rate int) ratelimit.Limiter {
+					assert.Equal(t, time.Minute, interval)
+					assert.Equal(t, 1000, rate)
+					return custom
+				})
+			s.nowFunc = func() time.Time {
+				return now
+			}
+			server := gin.New()
+			server.Use(NewBuilder(limiter).
+				SetKeyGenFunc(func(ctx *gin.Context) string {
+					return "tenant:1"
+				}).
+				SetOverrides(s).Build())
+			server.GET("/limit", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			req, err := http.NewRequest(http.MethodGet, "/limit", nil)
+			require.NoError(t, err)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+			assert.Equal(t, tc.wantRetry, resp.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestBuilder_SetOverrides_Breaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1695571200000)
+	cmd := redismocks.NewMockCmdable(ctrl)
+	// 熔断之后不再查询 Redis
+	cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys,
+		"tenant:1", now.UnixMilli()).Return(overrideResult(nil, errors.New("redis 异常")))
+	s := NewOverrideStore(cmd, "ops")
+	s.nowFunc = func() time.Time {
+		return now
+	}
+	gin.SetMode(gin.ReleaseMode)
+	server := gin.New()
+	server.Use(NewBuilder(limitmocks.NewMockLimiter(ctrl)).
+		SetKeyGenFunc(func(ctx *gin.Context) string {
+			return "tenant:1"
+		}).
+		SetBreaker(degrade.NewBreaker(1, time.Minute)).
+		SetFailPolicy(degrade.FailOpen).
+		SetOverrides(s).Build())
+	server.GET("/limit", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest(http.MethodGet, "/limit", nil)
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+}
@@ -0,0 +1,26 @@
+package ratelimit
+
+import (
+	"ginx/internal/ratelimit"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/redis/go-redis/v9"
+)
+
+// PenaltyRule 频繁触发限流之后封禁的规则, 参考 Builder.SetPenaltyBox.
+type PenaltyRule = ratelimit.PenaltyRule
+
+// NewLocalPenaltyBox 基于内存的封禁状态, 适用于单实例部署. rule 不合法时 panic.
+func NewLocalPenaltyBox(rule PenaltyRule, opts ...option.Option[ratelimit.LocalOptions]) ratelimit.PenaltyBox {
+	return ratelimit.NewLocalPenaltyBox(rule, opts...)
+}
+
+// NewRedisPenaltyBox 基于 Redis 的封禁状态, 所有实例共享. rule 不合法时 panic.
+func NewRedisPenaltyBox(cmd redis.Cmdable, rule PenaltyRule) ratelimit.PenaltyBox {
+	if err := rule.Validate(); err != nil {
+		panic("ratelimit: " + err.Error())
+	}
+	return &ratelimit.RedisPenaltyBox{
+		Cmd:  cmd,
+		Rule: rule,
+	}
+}
@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"ginx/degrade"
+	"ginx/internal/ratelimit"
+	limitmocks "ginx/internal/ratelimit/mocks"
+	"ginx/middlewares/redislimit/redismocks"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBuilder_SetPenaltyBox(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	limiter := limitmocks.NewMockLimiter(ctrl)
+	// 封禁之后不再访问限流器
+	limiter.EXPECT().Limit(gomock.Any(), gomock.Any()).Return(true, nil).Times(2)
+	box := NewLocalPenaltyBox(PenaltyRule{
+		Threshold: 2,
+		Window:    time.Minute,
+		BaseBan:   time.Minute,
+		MaxBan:    time.Hour,
+		Memory:    time.Hour,
+	})
+	svc := NewBuilder(limiter).SetPenaltyBox(box)
+	server := gin.Default()
+	server.Use(svc.Build())
+	svc.RegisterRoutes(server)
+
+	steps := []struct {
+		name           string
+		wantCode       int
+		wantRetryAfter bool
+	}{
+		{name: "第一次触发限流", wantCode: http.StatusTooManyRequests},
+		{name: "达到阈值, 封禁", wantCode: http.StatusTooManyRequests, wantRetryAfter: true},
+		{name: "封禁中", wantCode: http.StatusTooManyRequests, wantRetryAfter: true},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequest(http.MethodGet, "/limit", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		assert.Equal(t, step.wantCode, resp.Code, step.name)
+		if step.wantRetryAfter {
+			assert.Equal(t, "60", resp.Header().Get(headerRetryAfter), step.name)
+		}
+	}
+}
+
+func TestBuilder_SetPenaltyBox_Override(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1695571200000)
+	cmd := redismocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys,
+		"tenant:1", now.UnixMilli()).Return(overrideResult([]any{int64(0), int64(0), ""}, nil))
+	cmd.EXPECT().EvalSha(gomock.Any(), overrideGetScript.Hash(), overrideKeys,
+		"tenant:1", now.UnixMilli()).Return(overrideResult([]any{int64(0), int64(0), `{"interval":"1m0s","rate":1000}`}, nil))
+	s := NewOverrideStore(cmd, "ops").
+		SetLimiterFunc(func(interval time.Duration, rate int) ratelimit.Limiter {
+			// 封禁期间不访问自定义频率的限流器
+			return limitmocks.NewMockLimiter(ctrl)
+		})
+	s.nowFunc = func() time.Time {
+		return now
+	}
+	limiter := limitmocks.NewMockLimiter(ctrl)
+	limiter.EXPECT().Limit(gomock.Any(), "tenant:1").Return(true, nil)
+	box := NewLocalPenaltyBox(PenaltyRule{
+		Threshold: 1,
+		Window:    time.Minute,
+		BaseBan:   time.Minute,
+		MaxBan:    time.Hour,
+		Memory:    time.Hour,
+	})
+	gin.SetMode(gin.ReleaseMode)
+	server := gin.New()
+	server.Use(NewBuilder(limiter).
+		SetKeyGenFunc(func(ctx *gin.Context) string {
+			return "tenant:1"
+		}).
+		SetOverrides(s).
+		SetPenaltyBox(box).Build())
+	server.GET("/limit", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	serve := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/limit", nil)
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, serve().Code)
+	// 设置自定义频率之后仍然处于封禁中
+	s.Invalidate("tenant:1")
+	resp := serve()
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "60", resp.Header().Get(headerRetryAfter))
+}
+
+func TestBuilder_SetPenaltyBox_Breaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	res := redis.NewDurationCmd(context.Background(), time.Millisecond)
+	res.SetErr(errors.New("redis 异常"))
+	// 熔断之后不再访问 Redis
+	cmd.EXPECT().PTTL(gomock.Any(), "{tenant:1}:ban").Return(res)
+	box := NewRedisPenaltyBox(cmd, PenaltyRule{
+		Threshold: 1,
+		Window:    time.Minute,
+		BaseBan:   time.Minute,
+		MaxBan:    time.Hour,
+		Memory:    time.Hour,
+	})
+	gin.SetMode(gin.ReleaseMode)
+	server := gin.New()
+	server.Use(NewBuilder(limitmocks.NewMockLimiter(ctrl)).
+		SetKeyGenFunc(func(ctx *gin.Context) string {
+			return "tenant:1"
+		}).
+		SetBreaker(degrade.NewBreaker(1, time.Minute)).
+		SetFailPolicy(degrade.FailOpen).
+		SetPenaltyBox(box).Build())
+	server.GET("/limit", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest(http.MethodGet, "/limit", nil)
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+}
+
+func TestNewPenaltyBox_InvalidRule(t *testing.T) {
+	rule := PenaltyRule{Threshold: 1, Window: time.Minute, BaseBan: time.Minute}
+	assert.PanicsWithValue(t, "ratelimit: 封禁规则的 MaxBan 不能小于 BaseBan", func() {
+		NewLocalPenaltyBox(rule)
+	})
+	assert.PanicsWithValue(t, "ratelimit: 封禁规则的 MaxBan 不能小于 BaseBan", func() {
+		NewRedisPenaltyBox(nil, rule)
+	})
+}
@@ -0,0 +1,209 @@
+package ratelimit
+
+import (
+	"fmt"
+	"ginx/clientip"
+	"ginx/internal/ratelimit"
+	"ginx/jwt"
+	"ginx/logger"
+	"github.com/ecodeclub/ekit/set"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// Policy 限流策略, 所有条件都满足时才会使用该策略限流.
+type Policy struct {
+	// 策略名称, 会作为限流 key 的前缀, 不同策略的 key 互不影响
+	Name string
+	// 匹配的路由, 也就是 ctx.FullPath(), 为空时匹配所有路由
+	Routes []string
+	// 匹配的 HTTP 方法, 为空时匹配所有方法
+	Methods []string
+	// 匹配的用户等级, 参考 PolicyBuilder.SetTierFunc, 为空时匹配所有等级
+	Tiers []string
+	// 不能为 nil, 包括默认策略
+	Limiter ratelimit.Limiter
+	// 生成限流 key 的函数, 为空时使用 "<Name>:<身份标识>"
+	KeyGenFunc func(ctx *gin.Context) string
+	// 每个请求占用的配额, 参考 Builder.SetCostFunc, 为空时占用 1 个配额
+	CostFunc func(ctx *gin.Context) int64
+}
+
+type compiledPolicy struct {
+	Policy
+	routes  set.Set[string]
+	methods set.Set[string]
+	tiers   set.Set[string]
+	handler gin.HandlerFunc
+}
+
+// PolicyBuilder 根据请求选择限流策略的中间件,
+// 例如免费用户每分钟 60 个请求, 付费用户每分钟 600 个请求.
+// 按照添加的顺序匹配策略, 都不匹配时使用默认策略.
+type PolicyBuilder struct {
+	defaultPolicy Policy
+	policies      []Policy
+	// identityFn 默认使用 clientip.Key 作为身份标识
+	identityFn func(ctx *gin.Context) string
+	// tierFn 默认所有请求的等级都为 ""
+	tierFn func(ctx *gin.Context) string
+	// l 默认使用 slog.Default()
+	l logger.Logger
+	// keyBuilder 参考 Builder.SetKeyBuilder
+	keyBuilder *KeyBuilder
+}
+
+func NewPolicyBuilder(defaultPolicy Policy, policies ...Policy) *PolicyBuilder {
+	return &PolicyBuilder{
+		defaultPolicy: defaultPolicy,
+		policies:      policies,
+		identityFn: func(ctx *gin.Context) string {
+			return "ip:" + clientip.Key(ctx)
+		},
+		tierFn: func(ctx *gin.Context) string {
+			return ""
+		},
+		l: logger.NewSlogLogger(nil),
+	}
+}
+
+// AddPolicy 添加策略, 先添加的策略优先匹配.
+func (b *PolicyBuilder) AddPolicy(p Policy) *PolicyBuilder {
+	b.policies = append(b.policies, p)
+	return b
+}
+
+// SetIdentityFunc 设置获取身份标识的函数, 例如 IdentityFromClaims.
+func (b *PolicyBuilder) SetIdentityFunc(fn func(ctx *gin.Context) string) *PolicyBuilder {
+	b.identityFn = fn
+	return b
+}
+
+// SetTierFunc 设置获取用户等级的函数, 例如 TierFromClaims 和 TierFromHeader.
+func (b *PolicyBuilder) SetTierFunc(fn func(ctx *gin.Context) string) *PolicyBuilder {
+	b.tierFn = fn
+	return b
+}
+
+// SetKeyBuilder 所有策略的 key 都使用 kb 加上前缀, 命名空间, 版本和 hash tag.
+func (b *PolicyBuilder) SetKeyBuilder(kb *KeyBuilder) *PolicyBuilder {
+	b.keyBuilder = kb
+	return b
+}
+
+func (b *PolicyBuilder) SetLogger(l logger.Logger) *PolicyBuilder {
+	b.l = l
+	return b
+}
+
+// Build 存在 Limiter 为 nil 的策略时 panic, 避免在第一个请求时才发现配置错误.
+func (b *PolicyBuilder) Build() gin.HandlerFunc {
+	policies := make([]*compiledPolicy, 0, len(b.policies))
+	for _, p := range b.policies {
+		policies = append(policies, b.compile(p))
+	}
+	defaultPolicy := b.compile(b.defaultPolicy)
+	return func(ctx *gin.Context) {
+		p := defaultPolicy
+		tier := b.tierFn(ctx)
+		for _, cp := range policies {
+			if cp.match(ctx, tier) {
+				p = cp
+				break
+			}
+		}
+		p.handler(ctx)
+	}
+}
+
+func (b *PolicyBuilder) compile(p Policy) *compiledPolicy {
+	if p.Limiter == nil {
+		panic(fmt.Sprintf("ratelimit: 限流策略 %q 的 Limiter 为 nil", p.Name))
+	}
+	keyFn := p.KeyGenFunc
+	if keyFn == nil {
+		keyFn = func(ctx *gin.Context) string {
+			var sb strings.Builder
+			sb.WriteString(p.Name)
+			sb.WriteString(":")
+			sb.WriteString(b.identityFn(ctx))
+			return sb.String()
+		}
+	}
+	builder := NewBuilder(p.Limiter).
+		SetKeyGenFunc(keyFn).
+		SetKeyBuilder(b.keyBuilder).
+		SetLogger(b.l)
+	if p.CostFunc != nil {
+		builder.SetCostFunc(p.CostFunc)
+	}
+	return &compiledPolicy{
+		Policy:  p,
+		routes:  newSet(p.Routes),
+		methods: newSet(p.Methods),
+		tiers:   newSet(p.Tiers),
+		handler: builder.Build(),
+	}
+}
+
+func (p *compiledPolicy) match(ctx *gin.Context, tier string) bool {
+	return matchSet(p.routes, ctx.FullPath()) &&
+		matchSet(p.methods, ctx.Request.Method) &&
+		matchSet(p.tiers, tier)
+}
+
+// matchSet 没有设置条件时匹配所有值
+func matchSet(s set.Set[string], val string) bool {
+	return s == nil || s.Exist(val)
+}
+
+// newSet 没有设置条件时返回 nil
+func newSet(vals []string) set.Set[string] {
+	if len(vals) == 0 {
+		return nil
+	}
+	s := set.NewMapSet[string](len(vals))
+	for _, val := range vals {
+		s.Add(val)
+	}
+	return s
+}
+
+// IdentityFromClaims 使用 jwt 中间件设置的 claims 作为身份标识,
+// 没有登录时使用 clientip.Key.
+func IdentityFromClaims[T any](fn func(data T) string) func(ctx *gin.Context) string {
+	return func(ctx *gin.Context) string {
+		if clm, ok := claims[T](ctx); ok {
+			return "user:" + fn(clm.Data)
+		}
+		return "ip:" + clientip.Key(ctx)
+	}
+}
+
+// TierFromClaims 从 jwt 中间件设置的 claims 中获取用户等级,
+// 没有登录时为 "".
+func TierFromClaims[T any](fn func(data T) string) func(ctx *gin.Context) string {
+	return func(ctx *gin.Context) string {
+		if clm, ok := claims[T](ctx); ok {
+			return fn(clm.Data)
+		}
+		return ""
+	}
+}
+
+// TierFromHeader 根据请求头中的 API key 获取等级, 例如 TierFromHeader("X-Api-Key", keys).
+// 不在 tiers 中的 API key 等级为 "".
+func TierFromHeader(header string, tiers map[string]string) func(ctx *gin.Context) string {
+	return func(ctx *gin.Context) string {
+		return tiers[ctx.GetHeader(header)]
+	}
+}
+
+func claims[T any](ctx *gin.Context) (jwt.RegisteredClaims[T], bool) {
+	val, ok := ctx.Get("claims")
+	if !ok {
+		return jwt.RegisteredClaims[T]{}, false
+	}
+	clm, ok := val.(jwt.RegisteredClaims[T])
+	return clm, ok
+}
@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+	limitmocks "ginx/internal/ratelimit/mocks"
+	"ginx/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type user struct {
+	ID   string
+	Tier string
+}
+
+func TestPolicyBuilder_Build(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	type request struct {
+		method string
+		path   string
+		// 模拟 jwt 中间件登录的用户, 为空时表示没有登录
+		uid    string
+		tier   string
+		apiKey string
+	}
+	testCases := []struct {
+		name      string
+		builder   func() *PolicyBuilder
+		reqs      []request
+		wantCodes []int
+	}{
+		{
+			name: "使用默认策略按 IP 限流",
+			builder: func() *PolicyBuilder {
+				return NewPolicyBuilder(Policy{
+					Name:    "default",
+					Limiter: NewLocalSlidingWindowLimiter(time.Minute, 1),
+				})
+			},
+			reqs: []request{
+				{method: http.MethodGet, path: "/profile"},
+				{method: http.MethodGet, path: "/profile"},
+			},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "按路由和方法匹配策略",
+			builder: func() *PolicyBuilder {
+				return NewPolicyBuilder(Policy{
+					Name:    "default",
+					Limiter: NewLocalSlidingWindowLimiter(time.Minute, 1),
+				}, Policy{
+					Name:    "export",
+					Routes:  []string{"/export/:id"},
+					Methods: []string{http.MethodPost},
+					Limiter: NewLocalSlidingWindowLimiter(time.Minute, 2),
+				})
+			},
+			reqs: []request{
+				{method: http.MethodPost, path: "/export/1"},
+				{method: http.MethodPost, path: "/export/2"},
+				{method: http.MethodPost, path: "/export/3"},
+				// 方法不匹配, 使用默认策略
+				{method: http.MethodGet, path: "/export/1"},
+				{method: http.MethodGet, path: "/profile"},
+			},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests,
+				http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "按用户等级匹配策略",
+			builder: func() *PolicyBuilder {
+				return NewPolicyBuilder(Policy{
+					Name:    "free",
+					Limiter: NewLocalSlidingWindowLimiter(time.Minute, 1),
+				}, Policy{
+					Name:    "premium",
+					Tiers:   []string{"premium"},
+					Limiter: NewLocalSlidingWindowLimiter(time.Minute, 2),
+				}).SetIdentityFunc(IdentityFromClaims[user](func(u user) string {
+					return u.ID
+				})).SetTierFunc(TierFromClaims[user](func(u user) string {
+					return u.Tier
+				}))
+			},
+			reqs: []request{
+				{method: http.MethodGet, path: "/profile", uid: "1", tier: "premium"},
+				{method: http.MethodGet, path: "/profile", uid: "1", tier: "premium"},
+				{method: http.MethodGet, path: "/profile", uid: "1", tier: "premium"},
+				{method: http.MethodGet, path: "/profile", uid: "2"},
+				{method: http.MethodGet, path: "/profile", uid: "2"},
+				// 不同用户互不影响
+				{method: http.MethodGet, path: "/profile", uid: "3"},
+				// 没有登录使用 IP
+				{method: http.MethodGet, path: "/profile"},
+			},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests,
+				http.StatusOK, http.StatusTooManyRequests, http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "按 API key 匹配策略",
+			builder: func() *PolicyBuilder {
+				return NewPolicyBuilder(Policy{
+					Name:    "free",
+					Limiter: NewLocalSlidingWindowLimiter(time.Minute, 1),
+				}).AddPolicy(Policy{
+					Name:    "premium",
+					Tiers:   []string{"premium"},
+					Limiter: NewLocalSlidingWindowLimiter(time.Minute, 2),
+				}).SetTierFunc(TierFromHeader("X-Api-Key", map[string]string{
+					"key1": "premium",
+				}))
+			},
+			reqs: []request{
+				{method: http.MethodGet, path: "/profile", apiKey: "key1"},
+				{method: http.MethodGet, path: "/profile", apiKey: "key1"},
+				{method: http.MethodGet, path: "/profile", apiKey: "unknown"},
+				{method: http.MethodGet, path: "/profile", apiKey: "unknown"},
+			},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "使用 KeyBuilder 生成 key",
+			builder: func() *PolicyBuilder {
+				limiter := limitmocks.NewMockLimiter(gomock.NewController(t))
+				limiter.EXPECT().Limit(gomock.Any(), "ginx:ratelimit:api:{default:ip:127.0.0.1}").
+					Return(false, nil)
+				return NewPolicyBuilder(Policy{
+					Name:    "default",
+					Limiter: limiter,
+				}).SetKeyBuilder(NewKeyBuilder("api"))
+			},
+			reqs:      []request{{method: http.MethodGet, path: "/profile"}},
+			wantCodes: []int{http.StatusOK},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			// 模拟 jwt 中间件设置 claims
+			server.Use(func(ctx *gin.Context) {
+				if uid := ctx.GetHeader("uid"); uid != "" {
+					ctx.Set("claims", jwt.RegisteredClaims[user]{
+						Data: user{ID: uid, Tier: ctx.GetHeader("tier")},
+					})
+				}
+			})
+			server.Use(tc.builder().Build())
+			server.GET("/profile", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+			server.Any("/export/:id", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			codes := make([]int, 0, len(tc.reqs))
+			for _, r := range tc.reqs {
+				req, err := http.NewRequest(r.method, r.path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.RemoteAddr = "127.0.0.1:80"
+				req.Header.Set("uid", r.uid)
+				req.Header.Set("tier", r.tier)
+				req.Header.Set("X-Api-Key", r.apiKey)
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				codes = append(codes, resp.Code)
+			}
+			assert.Equal(t, tc.wantCodes, codes)
+		})
+	}
+}
+
+func TestPolicyBuilder_Build_NilLimiter(t *testing.T) {
+	assert.PanicsWithValue(t, `ratelimit: 限流策略 "default" 的 Limiter 为 nil`, func() {
+		NewPolicyBuilder(Policy{Name: "default"}).Build()
+	})
+	assert.PanicsWithValue(t, `ratelimit: 限流策略 "export" 的 Limiter 为 nil`, func() {
+		NewPolicyBuilder(Policy{
+			Name:    "default",
+			Limiter: NewLocalSlidingWindowLimiter(time.Minute, 1),
+		}, Policy{Name: "export"}).Build()
+	})
+}
@@ -2,15 +2,35 @@ package ratelimit
 
 import (
 	"ginx/internal/ratelimit"
+	"github.com/ecodeclub/ekit/bean/option"
 	"github.com/redis/go-redis/v9"
 	"time"
 )
 
+// NewRedisSlidingWindowLimiter 基于 Redis 的滑动窗口限流器.
+// 默认使用应用实例的时钟, 实例之间时钟偏差较大时可以使用 WithServerTime.
+// interval 小于 1ms 时 panic.
 func NewRedisSlidingWindowLimiter(cmd redis.Cmdable,
-	interval time.Duration, rate int) ratelimit.Limiter {
-	return &ratelimit.RedisSlidingWindowLimiter{
+	interval time.Duration, rate int,
+	opts ...option.Option[ratelimit.RedisSlidingWindowLimiter]) ratelimit.Limiter {
+	if interval < time.Millisecond {
+		panic("ratelimit: 滑动窗口限流器的窗口不能小于 1ms")
+	}
+	r := &ratelimit.RedisSlidingWindowLimiter{
 		Cmd:      cmd,
 		Interval: interval,
 		Rate:     rate,
 	}
+	option.Apply(r, opts...)
+	return r
+}
+
+// WithServerTime 使用 Redis 服务器的时间, 避免各个实例的时钟偏差影响窗口.
+func WithServerTime() option.Option[ratelimit.RedisSlidingWindowLimiter] {
+	return ratelimit.WithServerTime()
+}
+
+// WithClock 替换获取当前时间的函数, 一般用于测试.
+func WithClock(clock func() time.Time) option.Option[ratelimit.RedisSlidingWindowLimiter] {
+	return ratelimit.WithClock(clock)
 }
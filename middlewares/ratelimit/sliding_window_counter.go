@@ -0,0 +1,29 @@
+package ratelimit
+
+import (
+	"ginx/internal/ratelimit"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// NewRedisSlidingWindowCounterLimiter 基于 Redis 的滑动窗口计数限流器.
+// 按照上一个窗口的占比估算请求数, 精度和开销介于固定窗口和滑动窗口之间.
+// interval 小于 1ms 时 panic.
+func NewRedisSlidingWindowCounterLimiter(cmd redis.Cmdable,
+	interval time.Duration, rate int) ratelimit.Limiter {
+	if interval < time.Millisecond {
+		panic("ratelimit: 滑动窗口计数限流器的窗口不能小于 1ms")
+	}
+	return &ratelimit.RedisSlidingWindowCounterLimiter{
+		Cmd:      cmd,
+		Interval: interval,
+		Rate:     rate,
+	}
+}
+
+// NewLocalSlidingWindowCounterLimiter 基于内存的滑动窗口计数限流器, 适用于单实例部署.
+func NewLocalSlidingWindowCounterLimiter(interval time.Duration, rate int,
+	opts ...option.Option[ratelimit.LocalOptions]) ratelimit.Limiter {
+	return ratelimit.NewLocalSlidingWindowCounterLimiter(interval, rate, opts...)
+}
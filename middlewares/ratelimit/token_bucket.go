@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"ginx/internal/ratelimit"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// NewRedisTokenBucketLimiter 基于 Redis 的令牌桶限流器.
+// 每 interval 补充 rate 个令牌, 最多允许 capacity 个请求的突发流量.
+// interval 小于 1ms, rate 或者 capacity 小于等于 0 时 panic.
+func NewRedisTokenBucketLimiter(cmd redis.Cmdable,
+	interval time.Duration, rate, capacity int) ratelimit.Limiter {
+	if interval < time.Millisecond {
+		panic("ratelimit: 令牌桶的 interval 不能小于 1ms")
+	}
+	if rate <= 0 || capacity <= 0 {
+		panic("ratelimit: 令牌桶的 rate 和 capacity 必须大于 0")
+	}
+	return &ratelimit.RedisTokenBucketLimiter{
+		Cmd:      cmd,
+		Interval: interval,
+		Rate:     rate,
+		Capacity: capacity,
+	}
+}
+
+// NewLocalTokenBucketLimiter 基于内存的令牌桶限流器, 适用于单实例部署.
+// 每 interval 补充 rate 个令牌, 最多允许 capacity 个请求的突发流量.
+// interval, rate 或者 capacity 小于等于 0 时 panic.
+func NewLocalTokenBucketLimiter(interval time.Duration, rate, capacity int,
+	opts ...option.Option[ratelimit.LocalOptions]) ratelimit.Limiter {
+	return ratelimit.NewLocalTokenBucketLimiter(interval, rate, capacity, opts...)
+}
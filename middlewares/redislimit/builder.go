@@ -1,7 +1,9 @@
 package redislimit
 
 import (
-	"fmt"
+	"ginx/degrade"
+	"ginx/logger"
+	"ginx/priority"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/atomic"
@@ -14,7 +16,12 @@ type RedisActiveLimit struct {
 	key string
 	// 最大限流数量
 	maxActive *atomic.Int64
-	logFn     func(msg any, args ...any)
+	// l 默认使用 slog.Default()
+	l logger.Logger
+	// failover Redis 出错或者熔断时的处理, 默认 degrade.FailClosed
+	failover *failover
+	// policy 不为 nil 时低优先级的请求不能占用为高优先级预留的容量
+	policy *priority.Policy
 }
 
 func NewRedisActiveLimit(cmd redis.Cmdable, maxAcitve int64, key string) *RedisActiveLimit {
@@ -22,9 +29,8 @@ func NewRedisActiveLimit(cmd redis.Cmdable, maxAcitve int64, key string) *RedisA
 		cmd:       cmd,
 		key:       key,
 		maxActive: atomic.NewInt64(maxAcitve),
-		logFn: func(msg any, args ...any) {
-			fmt.Println(fmt.Sprintf("%v detail info %v", msg, args))
-		},
+		l:         logger.NewSlogLogger(nil),
+		failover:  newFailover(),
 	}
 }
 
@@ -33,33 +39,86 @@ func (limit *RedisActiveLimit) SetMaxActive(maxActive int64) *RedisActiveLimit {
 	return limit
 }
 
+func (limit *RedisActiveLimit) SetLogger(l logger.Logger) *RedisActiveLimit {
+	limit.l = l
+	return limit
+}
+
+// Deprecated: 使用 SetLogger.
 func (limit *RedisActiveLimit) SetLogFunc(fun func(msg any, args ...any)) *RedisActiveLimit {
-	limit.logFn = fun
+	return limit.SetLogger(logger.NewFuncLogger(fun))
+}
+
+// SetFailPolicy 设置 Redis 出错或者熔断时的处理策略.
+// 使用 degrade.Fallback 时需要通过 SetFallback 设置本实例的最大活跃请求数.
+func (limit *RedisActiveLimit) SetFailPolicy(policy degrade.Policy) *RedisActiveLimit {
+	limit.failover.policy = policy
+	return limit
+}
+
+// SetFallback Redis 出错或者熔断时降级到本地计数,
+// maxActive 是本实例的最大活跃请求数, 一般是全局的最大活跃请求数除以实例数.
+func (limit *RedisActiveLimit) SetFallback(maxActive int64) *RedisActiveLimit {
+	limit.failover.policy = degrade.Fallback
+	limit.failover.fallbackMaxActive.Store(maxActive)
+	return limit
+}
+
+// SetBreaker 设置熔断器, 熔断期间不访问 Redis, 直接按照 failPolicy 处理.
+func (limit *RedisActiveLimit) SetBreaker(breaker *degrade.Breaker) *RedisActiveLimit {
+	limit.failover.breaker = breaker
+	return limit
+}
+
+// SetPriorityPolicy 按照请求的优先级预留容量, 过载时先丢弃低优先级的请求.
+func (limit *RedisActiveLimit) SetPriorityPolicy(policy *priority.Policy) *RedisActiveLimit {
+	limit.policy = policy
 	return limit
 }
 
 func (limit *RedisActiveLimit) Build() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		current, err := limit.cmd.Incr(ctx, limit.key).Result()
+		var current int64
+		err := limit.failover.do(func() error {
+			var err error
+			current, err = limit.cmd.Incr(ctx, limit.key).Result()
+			return err
+		})
 		if err != nil {
-			// 记录日志
-			limit.logFn("redis + 1", err)
-			ctx.AbortWithStatus(http.StatusInternalServerError)
+			if err != degrade.ErrBreakerOpen {
+				limit.l.Error("redis 增加活跃请求数失败",
+					logger.String("key", limit.key),
+					logger.Error(err))
+			}
+			limit.failover.degrade(ctx, limit.l, limit.key, err)
 			return
 		}
 		defer func() {
 			if err = limit.cmd.Decr(ctx, limit.key).Err(); err != nil {
-				limit.logFn("redis - 1", err)
+				limit.l.Error("redis 减少活跃请求数失败",
+					logger.String("key", limit.key),
+					logger.Error(err))
 				return
 			}
 		}()
-		if current <= limit.maxActive.Load() {
+		if current <= limit.limitFor(ctx) {
 			ctx.Next()
 		} else {
 			// 执行限流
-			limit.logFn("web server->", "执行限流中")
+			limit.l.Debug("触发限流",
+				logger.String("key", limit.key),
+				logger.Int64("active", current))
 			ctx.AbortWithStatus(http.StatusTooManyRequests)
 			return
 		}
 	}
 }
+
+// limitFor 当前请求可以使用的最大活跃请求数
+func (limit *RedisActiveLimit) limitFor(ctx *gin.Context) int64 {
+	if limit.policy == nil {
+		return limit.maxActive.Load()
+	}
+	_, res := limit.policy.Limit(ctx, limit.maxActive.Load())
+	return res
+}
@@ -3,7 +3,9 @@ package redislimit
 import (
 	"context"
 	"errors"
+	"ginx/degrade"
 	"ginx/middlewares/redislimit/redismocks"
+	"ginx/priority"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -133,9 +135,109 @@ func TestRedisActiveLimit_Build(t *testing.T) {
 			},
 			wantCode: http.StatusInternalServerError,
 		},
+		{
+			name:     "Redis 异常，放行",
+			maxCount: 1,
+			key:      "test",
+			mock: func(ctrl *gomock.Controller, key string) redis.Cmdable {
+				redisClient := redismocks.NewMockCmdable(ctrl)
+				res1 := redis.NewIntCmd(context.Background())
+				res1.SetErr(errors.New("redis 异常"))
+				redisClient.EXPECT().Incr(gomock.Any(), key).Return(res1)
+				return redisClient
+			},
+			setMiddleware: func(redisClient redis.Cmdable) gin.HandlerFunc {
+				return NewRedisActiveLimit(redisClient, 1, "test").
+					SetFailPolicy(degrade.FailOpen).Build()
+			},
+			before: func(server *gin.Engine, key string) {
+
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Redis 异常，降级到本地计数之后限流",
+			maxCount: 1,
+			key:      "test",
+			interval: time.Millisecond * 20,
+			mock: func(ctrl *gomock.Controller, key string) redis.Cmdable {
+				redisClient := redismocks.NewMockCmdable(ctrl)
+				res1 := redis.NewIntCmd(context.Background())
+				res1.SetErr(errors.New("redis 异常"))
+				redisClient.EXPECT().Incr(gomock.Any(), key).Return(res1).Times(2)
+				return redisClient
+			},
+			setMiddleware: func(redisClient redis.Cmdable) gin.HandlerFunc {
+				return NewRedisActiveLimit(redisClient, 1, "test").
+					SetFallback(1).Build()
+			},
+			before: func(server *gin.Engine, key string) {
+				req, err := http.NewRequest(http.MethodGet, "/activelimit3", nil)
+				require.NoError(t, err)
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				assert.Equal(t, 200, resp.Code)
+			},
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name:     "Redis 异常，熔断之后不再访问 Redis",
+			maxCount: 1,
+			key:      "test",
+			interval: time.Millisecond * 20,
+			mock: func(ctrl *gomock.Controller, key string) redis.Cmdable {
+				redisClient := redismocks.NewMockCmdable(ctrl)
+				res1 := redis.NewIntCmd(context.Background())
+				res1.SetErr(errors.New("redis 异常"))
+				redisClient.EXPECT().Incr(gomock.Any(), key).Return(res1)
+				return redisClient
+			},
+			setMiddleware: func(redisClient redis.Cmdable) gin.HandlerFunc {
+				return NewRedisActiveLimit(redisClient, 1, "test").
+					SetFailPolicy(degrade.FailOpen).
+					SetBreaker(degrade.NewBreaker(1, time.Minute)).Build()
+			},
+			before: func(server *gin.Engine, key string) {
+				req, err := http.NewRequest(http.MethodGet, "/activelimit", nil)
+				require.NoError(t, err)
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				assert.Equal(t, 200, resp.Code)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "按照优先级预留容量，低优先级的请求被限流",
+			maxCount: 10,
+			key:      "test",
+			mock: func(ctrl *gomock.Controller, key string) redis.Cmdable {
+				return priorityMock(ctrl, key)
+			},
+			setMiddleware: func(redisClient redis.Cmdable) gin.HandlerFunc {
+				return NewRedisActiveLimit(redisClient, 10, "test").
+					SetPriorityPolicy(priorityPolicy(priority.TierNormal)).Build()
+			},
+			before:   func(server *gin.Engine, key string) {},
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name:     "按照优先级预留容量，高优先级的请求使用预留的容量",
+			maxCount: 10,
+			key:      "test",
+			mock: func(ctrl *gomock.Controller, key string) redis.Cmdable {
+				return priorityMock(ctrl, key)
+			},
+			setMiddleware: func(redisClient redis.Cmdable) gin.HandlerFunc {
+				return NewRedisActiveLimit(redisClient, 10, "test").
+					SetPriorityPolicy(priorityPolicy(priority.TierCritical)).Build()
+			},
+			before:   func(server *gin.Engine, key string) {},
+			wantCode: http.StatusOK,
+		},
 	}
 	gin.SetMode(gin.ReleaseMode)
 	for _, tc := range testCases {
+		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
@@ -163,3 +265,21 @@ func TestRedisActiveLimit_Build(t *testing.T) {
 		})
 	}
 }
+
+// priorityMock 算上当前请求一共有 9 个活跃请求
+func priorityMock(ctrl *gomock.Controller, key string) redis.Cmdable {
+	redisClient := redismocks.NewMockCmdable(ctrl)
+	res1 := redis.NewIntCmd(context.Background())
+	res1.SetVal(int64(9))
+	redisClient.EXPECT().Incr(gomock.Any(), key).Return(res1)
+	res2 := redis.NewIntCmd(context.Background())
+	res2.SetVal(int64(8))
+	redisClient.EXPECT().Decr(gomock.Any(), key).Return(res2)
+	return redisClient
+}
+
+// priorityPolicy 所有请求都是 tier, 为 TierCritical 预留 2 个容量
+func priorityPolicy(tier priority.Tier) *priority.Policy {
+	return priority.NewPolicy(priority.NewClassifier(tier)).
+		SetReserved(priority.TierCritical, 2)
+}
@@ -0,0 +1,73 @@
+package redislimit
+
+import (
+	"ginx/degrade"
+	"ginx/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/atomic"
+	"net/http"
+)
+
+// failover Redis 出错或者熔断时的处理, 被 RedisActiveLimit 和 RedisSemaphoreLimit 共用
+type failover struct {
+	// policy Redis 出错时的处理策略, 默认 degrade.FailClosed
+	policy degrade.Policy
+	// 降级之后本实例的最大活跃请求数和当前活跃请求数
+	fallbackMaxActive *atomic.Int64
+	fallbackActive    *atomic.Int64
+	// breaker 为 nil 时每个请求都会访问 Redis
+	breaker *degrade.Breaker
+}
+
+func newFailover() *failover {
+	return &failover{
+		fallbackMaxActive: atomic.NewInt64(0),
+		fallbackActive:    atomic.NewInt64(0),
+	}
+}
+
+// do 通过熔断器访问 Redis, 熔断期间不执行 fn, 直接返回 degrade.ErrBreakerOpen
+func (f *failover) do(fn func() error) error {
+	if f.breaker == nil {
+		return fn()
+	}
+	if !f.breaker.Allow() {
+		return degrade.ErrBreakerOpen
+	}
+	if err := fn(); err != nil {
+		f.breaker.Failure()
+		return err
+	}
+	f.breaker.Success()
+	return nil
+}
+
+// degrade 按照 policy 处理 Redis 的错误
+func (f *failover) degrade(ctx *gin.Context, l logger.Logger, key string, err error) {
+	switch f.policy {
+	case degrade.FailOpen:
+		l.Warn("redis 不可用, 直接放行",
+			logger.String("key", key),
+			logger.Error(err))
+		ctx.Next()
+	case degrade.Fallback:
+		maxActive := f.fallbackMaxActive.Load()
+		if maxActive <= 0 {
+			ctx.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		current := f.fallbackActive.Inc()
+		defer f.fallbackActive.Dec()
+		if current > maxActive {
+			l.Debug("降级之后触发限流",
+				logger.String("key", key),
+				logger.Int64("active", current),
+				logger.Error(err))
+			ctx.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		ctx.Next()
+	default:
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,118 @@
+package redislimit
+
+import (
+	"context"
+	"ginx/clientip"
+	"ginx/degrade"
+	"ginx/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+	"time"
+)
+
+// RedisKeyActiveLimit 按照 key 限制所有实例的活跃请求数, 例如每个用户最多同时导出 3 次.
+// 每个 key 都是一个 RedisSemaphoreLimit 的信号量, 请求处理期间定期续约,
+// 实例崩溃时没有释放的租约最多保留 ttl, 触发限流的请求不会延长已有租约的过期时间.
+type RedisKeyActiveLimit struct {
+	// sem 的 key 不使用, 每个 key 的信号量由 redisKeyFn 生成
+	sem *RedisSemaphoreLimit
+	// redisKeyFn 默认为 prefix:key
+	redisKeyFn func(key string) string
+	// genKeyFn 默认使用 clientip.Key 限流
+	genKeyFn func(ctx *gin.Context) string
+	// l 默认使用 slog.Default()
+	l logger.Logger
+}
+
+// NewRedisKeyActiveLimit ttl 为租约时长, 默认每 ttl/3 续约一次, 小于 1ms 时 panic.
+func NewRedisKeyActiveLimit(cmd redis.Cmdable, maxActive int64,
+	prefix string, ttl time.Duration) *RedisKeyActiveLimit {
+	l := logger.NewSlogLogger(nil)
+	return &RedisKeyActiveLimit{
+		sem: NewRedisSemaphoreLimit(cmd, maxActive, prefix, ttl).SetLogger(l),
+		redisKeyFn: func(key string) string {
+			return prefix + ":" + key
+		},
+		genKeyFn: clientip.Key,
+		l:        l,
+	}
+}
+
+func (limit *RedisKeyActiveLimit) SetMaxActive(maxActive int64) *RedisKeyActiveLimit {
+	limit.sem.SetMaxActive(maxActive)
+	return limit
+}
+
+// SetHeartbeat 参考 RedisSemaphoreLimit.SetHeartbeat
+func (limit *RedisKeyActiveLimit) SetHeartbeat(heartbeat time.Duration) *RedisKeyActiveLimit {
+	limit.sem.SetHeartbeat(heartbeat)
+	return limit
+}
+
+func (limit *RedisKeyActiveLimit) SetKeyGenFunc(fn func(ctx *gin.Context) string) *RedisKeyActiveLimit {
+	limit.genKeyFn = fn
+	return limit
+}
+
+// SetRedisKeyFunc 设置 key 对应的信号量在 Redis 中的 key, 例如加上命名空间和 hash tag.
+func (limit *RedisKeyActiveLimit) SetRedisKeyFunc(fn func(key string) string) *RedisKeyActiveLimit {
+	limit.redisKeyFn = fn
+	return limit
+}
+
+func (limit *RedisKeyActiveLimit) SetLogger(l logger.Logger) *RedisKeyActiveLimit {
+	limit.sem.SetLogger(l)
+	limit.l = l
+	return limit
+}
+
+// SetFailPolicy Redis 出错或者熔断时的处理策略, 不支持 degrade.Fallback.
+func (limit *RedisKeyActiveLimit) SetFailPolicy(policy degrade.Policy) *RedisKeyActiveLimit {
+	limit.sem.SetFailPolicy(policy)
+	return limit
+}
+
+// SetBreaker 参考 RedisSemaphoreLimit.SetBreaker, 熔断期间 Acquire 返回 degrade.ErrBreakerOpen.
+func (limit *RedisKeyActiveLimit) SetBreaker(breaker *degrade.Breaker) *RedisKeyActiveLimit {
+	limit.sem.SetBreaker(breaker)
+	return limit
+}
+
+func (limit *RedisKeyActiveLimit) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := limit.genKeyFn(ctx)
+		release, err := limit.Acquire(ctx, key)
+		if err != nil {
+			if err != degrade.ErrBreakerOpen {
+				limit.l.Error("redis 获取租约失败",
+					logger.String("key", key),
+					logger.Error(err))
+			}
+			limit.sem.failover.degrade(ctx, limit.l, key, err)
+			return
+		}
+		if release == nil {
+			limit.l.Debug("触发限流",
+				logger.String("key", key))
+			ctx.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		defer release()
+		ctx.Next()
+	}
+}
+
+// Acquire 获取 key 的租约并定期续约, 返回的 release 为 nil 表示触发限流,
+// 否则请求结束之后必须调用 release 停止续约并释放租约.
+func (limit *RedisKeyActiveLimit) Acquire(ctx context.Context, key string) (release func(), err error) {
+	le, err := limit.sem.acquire(ctx, limit.redisKeyFn(key))
+	if err != nil || le == nil {
+		return nil, err
+	}
+	stop := le.keepAlive()
+	return func() {
+		stop()
+		le.release()
+	}, nil
+}
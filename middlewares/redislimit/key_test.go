@@ -0,0 +1,140 @@
+package redislimit
+
+import (
+	"context"
+	"errors"
+	"ginx/degrade"
+	"ginx/middlewares/redislimit/redismocks"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRedisKeyActiveLimit_Build(t *testing.T) {
+	const key = "export:user-1"
+	evalResult := func(val int64, err error) *redis.Cmd {
+		res := redis.NewCmd(context.Background())
+		res.SetVal(val)
+		res.SetErr(err)
+		return res
+	}
+	intResult := func(val int64, err error) *redis.IntCmd {
+		res := redis.NewIntCmd(context.Background())
+		res.SetVal(val)
+		res.SetErr(err)
+		return res
+	}
+	testCases := []struct {
+		name       string
+		mock       func(ctrl *gomock.Controller) redis.Cmdable
+		redisKeyFn func(key string) string
+		failPolicy degrade.Policy
+
+		wantCode int
+	}{
+		{
+			name: "获取租约之后释放",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+					int64(60000), int64(3), "req-1").Return(evalResult(1, nil))
+				cmd.EXPECT().ZRem(gomock.Any(), key, "req-1").Return(intResult(1, nil))
+				return cmd
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "活跃请求数已满",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+					int64(60000), int64(3), "req-1").Return(evalResult(0, nil))
+				return cmd
+			},
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name: "获取租约失败",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+					int64(60000), int64(3), "req-1").Return(evalResult(0, errors.New("redis 异常")))
+				return cmd
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name: "获取租约失败直接放行",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+					int64(60000), int64(3), "req-1").Return(evalResult(0, errors.New("redis 异常")))
+				return cmd
+			},
+			failPolicy: degrade.FailOpen,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name: "释放租约失败不影响响应",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+					int64(60000), int64(3), "req-1").Return(evalResult(1, nil))
+				cmd.EXPECT().ZRem(gomock.Any(), key, "req-1").Return(intResult(0, errors.New("redis 异常")))
+				return cmd
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "自定义 redis key",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{"ginx:{export:user-1}"},
+					int64(60000), int64(3), "req-1").Return(evalResult(1, nil))
+				cmd.EXPECT().ZRem(gomock.Any(), "ginx:{export:user-1}", "req-1").Return(intResult(1, nil))
+				return cmd
+			},
+			redisKeyFn: func(key string) string {
+				return "ginx:{export:" + key + "}"
+			},
+			wantCode: http.StatusOK,
+		},
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			limit := NewRedisKeyActiveLimit(tc.mock(ctrl), 3, "export", time.Minute).
+				SetKeyGenFunc(func(ctx *gin.Context) string {
+					return ctx.GetHeader("uid")
+				}).
+				SetFailPolicy(tc.failPolicy)
+			if tc.redisKeyFn != nil {
+				limit.SetRedisKeyFunc(tc.redisKeyFn)
+			}
+			limit.sem.idFunc = func() string {
+				return "req-1"
+			}
+			server := gin.New()
+			server.Use(limit.Build())
+			server.GET("/export", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			req, err := http.NewRequest(http.MethodGet, "/export", nil)
+			require.NoError(t, err)
+			req.Header.Set("uid", "user-1")
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package redislimit
+
+import (
+	"context"
+	_ "embed"
+	"ginx/degrade"
+	"ginx/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/atomic"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	//go:embed semaphore_acquire.lua
+	luaSemaphoreAcquire string
+	//go:embed semaphore_renew.lua
+	luaSemaphoreRenew string
+
+	acquireScript = redis.NewScript(luaSemaphoreAcquire)
+	renewScript   = redis.NewScript(luaSemaphoreRenew)
+)
+
+// RedisSemaphoreLimit 基于租约的分布式信号量, 限制所有实例的活跃请求数.
+// 每个请求在 ZSET 中占用一个带过期时间的租约, 处理期间定期续约.
+// 实例崩溃时没有释放的租约过期之后会被自动清理, 不会像 RedisActiveLimit 的计数一样泄漏.
+type RedisSemaphoreLimit struct {
+	cmd redis.Cmdable
+	key string
+	// 最大活跃请求数
+	maxActive *atomic.Int64
+	// 租约时长, 实例崩溃之后最多过 leaseTTL 才会释放
+	leaseTTL time.Duration
+	// 续约间隔, 默认为 leaseTTL 的三分之一
+	heartbeat time.Duration
+	// l 默认使用 slog.Default()
+	l logger.Logger
+	// idFunc 生成请求 ID, 所有实例的请求 ID 都不能重复
+	idFunc func() string
+	// failover Redis 出错或者熔断时的处理, 默认 degrade.FailClosed
+	failover *failover
+}
+
+// NewRedisSemaphoreLimit leaseTTL 按照毫秒保存在 Redis 中, 小于 1ms 时 panic.
+func NewRedisSemaphoreLimit(cmd redis.Cmdable, maxActive int64,
+	key string, leaseTTL time.Duration) *RedisSemaphoreLimit {
+	if leaseTTL < time.Millisecond {
+		panic("redislimit: 租约时长不能小于 1ms")
+	}
+	return &RedisSemaphoreLimit{
+		cmd:       cmd,
+		key:       key,
+		maxActive: atomic.NewInt64(maxActive),
+		leaseTTL:  leaseTTL,
+		heartbeat: leaseTTL / 3,
+		l:         logger.NewSlogLogger(nil),
+		idFunc:    newRequestID(),
+		failover:  newFailover(),
+	}
+}
+
+func (limit *RedisSemaphoreLimit) SetMaxActive(maxActive int64) *RedisSemaphoreLimit {
+	limit.maxActive.Store(maxActive)
+	return limit
+}
+
+// SetHeartbeat 设置续约间隔, 必须小于租约时长, 否则处理时间较长的请求会丢失租约.
+// heartbeat 小于等于 0 或者不小于租约时长时 panic.
+func (limit *RedisSemaphoreLimit) SetHeartbeat(heartbeat time.Duration) *RedisSemaphoreLimit {
+	if heartbeat <= 0 || heartbeat >= limit.leaseTTL {
+		panic("redislimit: 续约间隔必须大于 0 并且小于租约时长")
+	}
+	limit.heartbeat = heartbeat
+	return limit
+}
+
+func (limit *RedisSemaphoreLimit) SetLogger(l logger.Logger) *RedisSemaphoreLimit {
+	limit.l = l
+	return limit
+}
+
+// SetFailPolicy 参考 RedisActiveLimit.SetFailPolicy
+func (limit *RedisSemaphoreLimit) SetFailPolicy(policy degrade.Policy) *RedisSemaphoreLimit {
+	limit.failover.policy = policy
+	return limit
+}
+
+// SetFallback 参考 RedisActiveLimit.SetFallback
+func (limit *RedisSemaphoreLimit) SetFallback(maxActive int64) *RedisSemaphoreLimit {
+	limit.failover.policy = degrade.Fallback
+	limit.failover.fallbackMaxActive.Store(maxActive)
+	return limit
+}
+
+// SetBreaker 设置熔断器, 熔断期间不访问 Redis, 直接按照 failPolicy 处理.
+// 只有获取租约会经过熔断器, 续约和释放已有的租约不受影响.
+func (limit *RedisSemaphoreLimit) SetBreaker(breaker *degrade.Breaker) *RedisSemaphoreLimit {
+	limit.failover.breaker = breaker
+	return limit
+}
+
+func (limit *RedisSemaphoreLimit) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		le, err := limit.acquire(ctx, limit.key)
+		if err != nil {
+			if err != degrade.ErrBreakerOpen {
+				limit.l.Error("redis 获取租约失败",
+					logger.String("key", limit.key),
+					logger.Error(err))
+			}
+			limit.failover.degrade(ctx, limit.l, limit.key, err)
+			return
+		}
+		if le == nil {
+			limit.l.Debug("触发限流",
+				logger.String("key", limit.key))
+			ctx.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		stop := le.keepAlive()
+		defer func() {
+			stop()
+			le.release()
+		}()
+		ctx.Next()
+	}
+}
+
+// acquire 在 key 对应的 ZSET 中获取租约, 返回 nil 表示触发限流.
+// 触发限流时不会修改 ZSET, 已有租约的过期时间不受影响.
+// 熔断期间不访问 Redis, 返回 degrade.ErrBreakerOpen.
+func (limit *RedisSemaphoreLimit) acquire(ctx context.Context, key string) (*lease, error) {
+	id := limit.idFunc()
+	var ok bool
+	err := limit.failover.do(func() error {
+		var err error
+		ok, err = acquireScript.Run(ctx, limit.cmd, []string{key},
+			limit.leaseTTL.Milliseconds(), limit.maxActive.Load(), id).Bool()
+		return err
+	})
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &lease{
+		cmd:       limit.cmd,
+		key:       key,
+		id:        id,
+		ttl:       limit.leaseTTL,
+		heartbeat: limit.heartbeat,
+		l:         limit.l,
+	}, nil
+}
+
+// lease 一个请求在信号量 ZSET 中的租约, 被 RedisSemaphoreLimit 和 RedisKeyActiveLimit 共用
+type lease struct {
+	cmd       redis.Cmdable
+	key       string
+	id        string
+	ttl       time.Duration
+	heartbeat time.Duration
+	l         logger.Logger
+}
+
+// keepAlive 定期续约, 直到调用返回的 stop
+func (le *lease) keepAlive() (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(le.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				le.renew()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (le *lease) renew() {
+	ctx, cancel := context.WithTimeout(context.Background(), le.heartbeat)
+	defer cancel()
+	ok, err := renewScript.Run(ctx, le.cmd, []string{le.key},
+		le.ttl.Milliseconds(), le.id).Bool()
+	if err != nil {
+		le.l.Error("redis 续约失败",
+			logger.String("key", le.key),
+			logger.String("id", le.id),
+			logger.Error(err))
+		return
+	}
+	if !ok {
+		le.l.Warn("租约已经过期",
+			logger.String("key", le.key),
+			logger.String("id", le.id))
+	}
+}
+
+// release 释放租约, 客户端断开连接时请求的 ctx 已经取消, 所以不能使用请求的 ctx.
+// 释放失败的租约过期之后会被清理.
+func (le *lease) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := le.cmd.ZRem(ctx, le.key, le.id).Err(); err != nil {
+		le.l.Error("redis 释放租约失败",
+			logger.String("key", le.key),
+			logger.String("id", le.id),
+			logger.Error(err))
+	}
+}
+
+// newRequestID 随机前缀区分不同的实例, 自增序号区分同一个实例的请求
+func newRequestID() func() string {
+	prefix := strconv.FormatUint(rand.Uint64(), 36)
+	seq := atomic.NewUint64(0)
+	return func() string {
+		return prefix + "-" + strconv.FormatUint(seq.Inc(), 36)
+	}
+}
@@ -0,0 +1,26 @@
+-- 活跃请求的租约, member 为请求 ID, score 为租约的过期时间
+local key = KEYS[1]
+-- 租约时长
+local ttl = tonumber(ARGV[1])
+-- 最大活跃请求数
+local max = tonumber(ARGV[2])
+-- 请求 ID
+local id = ARGV[3]
+
+-- 使用 Redis 服务器的时间, 避免各个实例的时钟偏差导致租约提前过期
+-- Redis 5 之前调用 TIME 之后不能再写入, 需要先切换到按照命令复制
+if redis.replicate_commands then
+    redis.replicate_commands()
+end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+-- 清理过期的租约, 也就是实例崩溃之后没有释放的请求
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now)
+if redis.call('ZCARD', key) >= max then
+    return 0
+end
+redis.call('ZADD', key, now + ttl, id)
+-- 所有请求都结束之后, key 也会过期
+redis.call('PEXPIRE', key, ttl)
+return 1
@@ -0,0 +1,21 @@
+-- 活跃请求的租约, member 为请求 ID, score 为租约的过期时间
+local key = KEYS[1]
+-- 租约时长
+local ttl = tonumber(ARGV[1])
+-- 请求 ID
+local id = ARGV[2]
+
+if redis.replicate_commands then
+    redis.replicate_commands()
+end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local expire = redis.call('ZSCORE', key, id)
+if not expire or tonumber(expire) <= now then
+    -- 租约已经过期, 可能已经被其他请求占用, 不能续约
+    return 0
+end
+redis.call('ZADD', key, now + ttl, id)
+redis.call('PEXPIRE', key, ttl)
+return 1
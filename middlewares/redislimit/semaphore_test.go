@@ -0,0 +1,242 @@
+package redislimit
+
+import (
+	"context"
+	"errors"
+	"ginx/degrade"
+	"ginx/middlewares/redislimit/redismocks"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRedisSemaphoreLimit_Build(t *testing.T) {
+	const key = "semaphore"
+	evalResult := func(val int64, err error) *redis.Cmd {
+		res := redis.NewCmd(context.Background())
+		res.SetVal(val)
+		res.SetErr(err)
+		return res
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+		// 请求的处理时间
+		duration time.Duration
+		wantCode int
+	}{
+		{
+			name: "获取租约之后释放",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+					int64(300), int64(1), "req-1").Return(evalResult(1, nil))
+				res := redis.NewIntCmd(context.Background())
+				res.SetVal(1)
+				cmd.EXPECT().ZRem(gomock.Any(), key, "req-1").Return(res)
+				return cmd
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "活跃请求数已满",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+					int64(300), int64(1), "req-1").Return(evalResult(0, nil))
+				return cmd
+			},
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name: "获取租约失败",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+					int64(300), int64(1), "req-1").Return(evalResult(0, errors.New("redis 异常")))
+				return cmd
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name: "处理时间较长的请求定期续约",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+					int64(300), int64(1), "req-1").Return(evalResult(1, nil))
+				cmd.EXPECT().EvalSha(gomock.Any(), renewScript.Hash(), []string{key},
+					int64(300), "req-1").Return(evalResult(1, nil)).MinTimes(2)
+				res := redis.NewIntCmd(context.Background())
+				res.SetVal(1)
+				cmd.EXPECT().ZRem(gomock.Any(), key, "req-1").Return(res)
+				return cmd
+			},
+			duration: 250 * time.Millisecond,
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "释放租约失败不影响响应",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+					int64(300), int64(1), "req-1").Return(evalResult(1, nil))
+				res := redis.NewIntCmd(context.Background())
+				res.SetErr(errors.New("redis 异常"))
+				cmd.EXPECT().ZRem(gomock.Any(), key, "req-1").Return(res)
+				return cmd
+			},
+			wantCode: http.StatusOK,
+		},
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			limit := NewRedisSemaphoreLimit(tc.mock(ctrl), 1, key, 300*time.Millisecond).
+				SetHeartbeat(100 * time.Millisecond)
+			limit.idFunc = func() string {
+				return "req-1"
+			}
+			server := gin.New()
+			server.Use(limit.Build())
+			server.GET("/semaphore", func(ctx *gin.Context) {
+				time.Sleep(tc.duration)
+				ctx.Status(http.StatusOK)
+			})
+
+			req, err := http.NewRequest(http.MethodGet, "/semaphore", nil)
+			require.NoError(t, err)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+		})
+	}
+}
+
+func TestRedisSemaphoreLimit_SetFailPolicy(t *testing.T) {
+	const key = "semaphore"
+	testCases := []struct {
+		name  string
+		limit func(cmd redis.Cmdable) *RedisSemaphoreLimit
+		// 第一个请求之后, 第二个请求是否还会访问 Redis
+		wantCalls int
+		wantCodes []int
+	}{
+		{
+			name: "默认返回 500",
+			limit: func(cmd redis.Cmdable) *RedisSemaphoreLimit {
+				return NewRedisSemaphoreLimit(cmd, 1, key, time.Second)
+			},
+			wantCalls: 2,
+			wantCodes: []int{http.StatusInternalServerError, http.StatusInternalServerError},
+		},
+		{
+			name: "直接放行",
+			limit: func(cmd redis.Cmdable) *RedisSemaphoreLimit {
+				return NewRedisSemaphoreLimit(cmd, 1, key, time.Second).
+					SetFailPolicy(degrade.FailOpen)
+			},
+			wantCalls: 2,
+			wantCodes: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "熔断之后不再访问 Redis",
+			limit: func(cmd redis.Cmdable) *RedisSemaphoreLimit {
+				return NewRedisSemaphoreLimit(cmd, 1, key, time.Second).
+					SetFailPolicy(degrade.FailOpen).
+					SetBreaker(degrade.NewBreaker(1, time.Minute))
+			},
+			wantCalls: 1,
+			wantCodes: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "降级到本地计数",
+			limit: func(cmd redis.Cmdable) *RedisSemaphoreLimit {
+				return NewRedisSemaphoreLimit(cmd, 1, key, time.Second).
+					SetFallback(1)
+			},
+			wantCalls: 2,
+			wantCodes: []int{http.StatusOK, http.StatusOK},
+		},
+	}
+	gin.SetMode(gin.ReleaseMode)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(context.Background())
+			res.SetErr(errors.New("redis 异常"))
+			cmd.EXPECT().EvalSha(gomock.Any(), acquireScript.Hash(), []string{key},
+				gomock.Any(), gomock.Any(), gomock.Any()).Return(res).Times(tc.wantCalls)
+			server := gin.New()
+			server.Use(tc.limit(cmd).Build())
+			server.GET("/semaphore", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			codes := make([]int, 0, len(tc.wantCodes))
+			for range tc.wantCodes {
+				req, err := http.NewRequest(http.MethodGet, "/semaphore", nil)
+				require.NoError(t, err)
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				codes = append(codes, resp.Code)
+			}
+			assert.Equal(t, tc.wantCodes, codes)
+		})
+	}
+}
+
+func TestRedisSemaphoreLimit_SetHeartbeat(t *testing.T) {
+	testCases := []struct {
+		name      string
+		leaseTTL  time.Duration
+		heartbeat time.Duration
+		wantPanic bool
+	}{
+		{name: "小于租约时长", leaseTTL: time.Second, heartbeat: 500 * time.Millisecond},
+		{name: "等于 0", leaseTTL: time.Second, heartbeat: 0, wantPanic: true},
+		{name: "小于 0", leaseTTL: time.Second, heartbeat: -time.Second, wantPanic: true},
+		{name: "等于租约时长", leaseTTL: time.Second, heartbeat: time.Second, wantPanic: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limit := NewRedisSemaphoreLimit(nil, 1, "semaphore", tc.leaseTTL)
+			fn := func() {
+				limit.SetHeartbeat(tc.heartbeat)
+			}
+			if tc.wantPanic {
+				assert.Panics(t, fn)
+				return
+			}
+			assert.NotPanics(t, fn)
+		})
+	}
+}
+
+func TestNewRedisSemaphoreLimit(t *testing.T) {
+	assert.Panics(t, func() {
+		NewRedisSemaphoreLimit(nil, 1, "semaphore", time.Microsecond)
+	})
+}
+
+func TestNewRequestID(t *testing.T) {
+	idFunc := newRequestID()
+	ids := make(map[string]struct{}, 100)
+	for i := 0; i < 100; i++ {
+		ids[idFunc()] = struct{}{}
+	}
+	assert.Len(t, ids, 100)
+	// 不同的实例前缀不同
+	assert.NotEqual(t, idFunc(), newRequestID()())
+}
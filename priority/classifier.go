@@ -0,0 +1,87 @@
+package priority
+
+import (
+	"ginx/jwt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/atomic"
+	"strconv"
+)
+
+// tierKeyPrefix 分类结果缓存在 gin.Context 中的 key 的前缀, 避免多个限流器重复分类
+const tierKeyPrefix = "ginx:priority:tier:"
+
+// classifierID 用于区分不同的 Classifier
+var classifierID = atomic.NewInt64(0)
+
+// Classifier 按照规则的添加顺序依次匹配请求的优先级, 都不匹配时使用默认的优先级.
+type Classifier struct {
+	rules       []func(ctx *gin.Context) (Tier, bool)
+	defaultTier Tier
+	// tierKey 每个 Classifier 的规则不同, 分类结果分开缓存
+	tierKey string
+}
+
+func NewClassifier(defaultTier Tier) *Classifier {
+	return &Classifier{
+		defaultTier: defaultTier,
+		tierKey:     tierKeyPrefix + strconv.FormatInt(classifierID.Inc(), 10),
+	}
+}
+
+// AddRoute 按照路由匹配, 使用的是注册时的路由, 例如 /users/:id
+func (c *Classifier) AddRoute(tier Tier, routes ...string) *Classifier {
+	m := make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		m[route] = struct{}{}
+	}
+	return c.AddFunc(func(ctx *gin.Context) (Tier, bool) {
+		_, ok := m[ctx.FullPath()]
+		return tier, ok
+	})
+}
+
+// AddHeader 按照请求头匹配, 例如 X-Priority: high
+func (c *Classifier) AddHeader(header, value string, tier Tier) *Classifier {
+	return c.AddFunc(func(ctx *gin.Context) (Tier, bool) {
+		return tier, ctx.GetHeader(header) == value
+	})
+}
+
+// AddFunc 添加自定义的规则, 第二个返回值表示是否匹配
+func (c *Classifier) AddFunc(fn func(ctx *gin.Context) (Tier, bool)) *Classifier {
+	c.rules = append(c.rules, fn)
+	return c
+}
+
+// Classify 返回请求的优先级, 同一个 Classifier 对同一个请求只会分类一次
+func (c *Classifier) Classify(ctx *gin.Context) Tier {
+	if val, ok := ctx.Get(c.tierKey); ok {
+		if tier, ok := val.(Tier); ok {
+			return tier
+		}
+	}
+	tier := c.defaultTier
+	for _, rule := range c.rules {
+		if t, ok := rule(ctx); ok {
+			tier = t
+			break
+		}
+	}
+	ctx.Set(c.tierKey, tier)
+	return tier
+}
+
+// ClaimsFunc 按照 jwt 中的数据匹配, 需要放在 jwt 的登录校验 middleware 之后.
+func ClaimsFunc[T any](fn func(data T) (Tier, bool)) func(ctx *gin.Context) (Tier, bool) {
+	return func(ctx *gin.Context) (Tier, bool) {
+		val, ok := ctx.Get("claims")
+		if !ok {
+			return 0, false
+		}
+		clm, ok := val.(jwt.RegisteredClaims[T])
+		if !ok {
+			return 0, false
+		}
+		return fn(clm.Data)
+	}
+}
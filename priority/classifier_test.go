@@ -0,0 +1,121 @@
+package priority
+
+import (
+	"ginx/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type claimsData struct {
+	Vip bool
+}
+
+func TestClassifier_Classify(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	testCases := []struct {
+		name   string
+		path   string
+		header map[string]string
+		claims any
+
+		wantTier Tier
+	}{
+		{
+			name:     "按照路由匹配",
+			path:     "/health",
+			wantTier: TierCritical,
+		},
+		{
+			name:     "带参数的路由",
+			path:     "/orders/123",
+			wantTier: TierHigh,
+		},
+		{
+			name:     "按照请求头匹配",
+			path:     "/sync",
+			header:   map[string]string{"X-Priority": "low"},
+			wantTier: TierLow,
+		},
+		{
+			name:     "路由优先于请求头",
+			path:     "/health",
+			header:   map[string]string{"X-Priority": "low"},
+			wantTier: TierCritical,
+		},
+		{
+			name:     "按照 jwt 中的数据匹配",
+			path:     "/sync",
+			claims:   jwt.RegisteredClaims[claimsData]{Data: claimsData{Vip: true}},
+			wantTier: TierHigh,
+		},
+		{
+			name:     "jwt 中的数据不匹配",
+			path:     "/sync",
+			claims:   jwt.RegisteredClaims[claimsData]{Data: claimsData{Vip: false}},
+			wantTier: TierNormal,
+		},
+		{
+			name:     "jwt 的数据类型不一致",
+			path:     "/sync",
+			claims:   jwt.RegisteredClaims[string]{Data: "vip"},
+			wantTier: TierNormal,
+		},
+		{
+			name:     "都不匹配使用默认的优先级",
+			path:     "/sync",
+			wantTier: TierNormal,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewClassifier(TierNormal).
+				AddRoute(TierCritical, "/health").
+				AddRoute(TierHigh, "/orders/:id").
+				AddHeader("X-Priority", "low", TierLow).
+				AddFunc(ClaimsFunc(func(data claimsData) (Tier, bool) {
+					return TierHigh, data.Vip
+				}))
+			var tier Tier
+			server := gin.New()
+			handler := func(ctx *gin.Context) {
+				if tc.claims != nil {
+					ctx.Set("claims", tc.claims)
+				}
+				tier = c.Classify(ctx)
+				// 第二次直接使用缓存的结果
+				assert.Equal(t, tier, c.Classify(ctx))
+			}
+			server.GET("/health", handler)
+			server.GET("/orders/:id", handler)
+			server.GET("/sync", handler)
+
+			req, err := http.NewRequest(http.MethodGet, tc.path, nil)
+			require.NoError(t, err)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			server.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tc.wantTier, tier)
+		})
+	}
+}
+
+func TestClassifier_Classify_Chained(t *testing.T) {
+	byRoute := NewClassifier(TierNormal).AddRoute(TierCritical, "/health")
+	byHeader := NewClassifier(TierNormal).AddHeader("X-Priority", "low", TierLow)
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	req, err := http.NewRequest(http.MethodGet, "/health", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Priority", "low")
+	ctx.Request = req
+
+	// 两个 Classifier 各自缓存分类结果, 不会互相影响
+	assert.Equal(t, TierNormal, byRoute.Classify(ctx))
+	assert.Equal(t, TierLow, byHeader.Classify(ctx))
+	assert.Equal(t, TierNormal, byRoute.Classify(ctx))
+}
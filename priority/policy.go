@@ -0,0 +1,50 @@
+package priority
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Policy 为每个优先级预留容量, 低优先级的请求不能占用为更高优先级预留的容量,
+// 所以过载时低优先级的请求最先被丢弃, 最高优先级的请求可以使用全部容量.
+//
+// 例如最大活跃请求数为 100, TierCritical 预留 5, TierHigh 预留 20,
+// 那么 TierCritical 最多 100 个, TierHigh 最多 95 个, 其他优先级最多 75 个.
+type Policy struct {
+	classifier *Classifier
+	reserved   map[Tier]int64
+}
+
+func NewPolicy(classifier *Classifier) *Policy {
+	return &Policy{
+		classifier: classifier,
+		reserved:   make(map[Tier]int64),
+	}
+}
+
+// SetReserved 为 tier 预留 n 个容量
+func (p *Policy) SetReserved(tier Tier, n int64) *Policy {
+	p.reserved[tier] = n
+	return p
+}
+
+// Limit 返回请求的优先级和这个优先级可以使用的最大活跃请求数
+func (p *Policy) Limit(ctx *gin.Context, maxActive int64) (Tier, int64) {
+	tier := p.classifier.Classify(ctx)
+	return tier, p.TierLimit(tier, maxActive)
+}
+
+// TierLimit maxActive 减去为更高优先级预留的容量, 最小为 0
+func (p *Policy) TierLimit(tier Tier, maxActive int64) int64 {
+	res := maxActive
+	for t, n := range p.reserved {
+		if t > tier {
+			res -= n
+		}
+	}
+	return max(res, 0)
+}
+
+// Classify 返回请求的优先级
+func (p *Policy) Classify(ctx *gin.Context) Tier {
+	return p.classifier.Classify(ctx)
+}
@@ -0,0 +1,55 @@
+package priority
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicy_TierLimit(t *testing.T) {
+	p := NewPolicy(NewClassifier(TierNormal)).
+		SetReserved(TierCritical, 5).
+		SetReserved(TierHigh, 20)
+	testCases := []struct {
+		name      string
+		tier      Tier
+		maxActive int64
+
+		want int64
+	}{
+		{
+			name:      "最高优先级使用全部容量",
+			tier:      TierCritical,
+			maxActive: 100,
+			want:      100,
+		},
+		{
+			name:      "不能使用更高优先级预留的容量",
+			tier:      TierHigh,
+			maxActive: 100,
+			want:      95,
+		},
+		{
+			name:      "没有预留容量的优先级",
+			tier:      TierNormal,
+			maxActive: 100,
+			want:      75,
+		},
+		{
+			name:      "最低优先级",
+			tier:      TierLow,
+			maxActive: 100,
+			want:      75,
+		},
+		{
+			name:      "容量不够预留",
+			tier:      TierLow,
+			maxActive: 10,
+			want:      0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, p.TierLimit(tc.tier, tc.maxActive))
+		})
+	}
+}
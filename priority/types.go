@@ -0,0 +1,31 @@
+package priority
+
+// Tier 请求的优先级, 越大越重要, 过载时优先丢弃低优先级的请求.
+// 除了预定义的几个优先级, 也可以使用任意的整数.
+type Tier int
+
+const (
+	// TierLow 例如后台同步, 报表导出
+	TierLow Tier = iota
+	// TierNormal 普通的业务请求
+	TierNormal
+	// TierHigh 例如下单, 支付
+	TierHigh
+	// TierCritical 例如健康检查, 丢弃之后实例会被摘除
+	TierCritical
+)
+
+func (t Tier) String() string {
+	switch t {
+	case TierLow:
+		return "low"
+	case TierNormal:
+		return "normal"
+	case TierHigh:
+		return "high"
+	case TierCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}